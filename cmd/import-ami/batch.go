@@ -0,0 +1,236 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	DefaultBatchConcurrency = 4
+)
+
+// batchEntry is a single import of a batch manifest. Namespace and size
+// default to --pvc-namespace and --pvc-size, the pvc name to the AMI id.
+type batchEntry struct {
+	AmiId     string `json:"amiId"`
+	PvcName   string `json:"pvcName,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Size      string `json:"size,omitempty"`
+}
+
+type batchResult struct {
+	entry    batchEntry
+	err      error
+	duration time.Duration
+}
+
+// readBatchManifest reads a YAML or JSON list of entries from path, or from
+// stdin when path is "-".
+func readBatchManifest(path string) ([]batchEntry, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []batchEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// runBatch imports every entry of a manifest with a bounded number of
+// concurrent imports sharing one set of AWS and CDI clients.
+func runBatch(args []string) {
+	var importOpts importFlags
+	var manifest string
+	var concurrency int
+	var stateDir string
+
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	addImportFlags(fs, &importOpts)
+	fs.StringVar(&manifest, "manifest", "", "YAML or JSON list of imports, each with amiId, pvcName, namespace and size. - reads from stdin")
+	fs.IntVar(&concurrency, "concurrency", DefaultBatchConcurrency, "Maximum number of imports running at once")
+	fs.StringVar(&stateDir, "state-dir", "", "Directory the progress of each import is saved to, so that a rerun of the batch resumes where each import stopped")
+
+	fs.Parse(args)
+	importOpts.log.setup()
+	if manifest == "" {
+		log.Fatalf("--manifest is required")
+	} else if concurrency < 1 {
+		log.Fatalf("--concurrency must be at least 1")
+	}
+	if err := importOpts.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	entries, err := readBatchManifest(manifest)
+	if err != nil {
+		log.Fatalf("err encountered reading manifest %s: %v", manifest, err)
+	} else if len(entries) == 0 {
+		log.Fatalf("manifest %s has no entries", manifest)
+	}
+
+	baseOpts, err := importOpts.options()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	pvcs := map[string]bool{}
+	importOptions := make([]importer.Options, len(entries))
+	for idx := range entries {
+		entry := &entries[idx]
+		if entry.AmiId == "" {
+			log.Fatalf("entry %d of manifest %s is missing amiId", idx, manifest)
+		}
+		if entry.PvcName == "" {
+			entry.PvcName = entry.AmiId
+		}
+		if entry.Namespace == "" {
+			entry.Namespace = baseOpts.PvcNamespace
+		}
+
+		pvc := fmt.Sprintf("%s/%s", entry.Namespace, entry.PvcName)
+		if pvcs[pvc] {
+			log.Fatalf("pvc %s is the target of more than one entry of manifest %s", pvc, manifest)
+		}
+		pvcs[pvc] = true
+
+		opts := baseOpts
+		opts.AmiId = entry.AmiId
+		opts.PvcName = entry.PvcName
+		opts.PvcNamespace = entry.Namespace
+		if entry.Size != "" {
+			opts.PvcSize, err = resource.ParseQuantity(entry.Size)
+			if err != nil {
+				log.Fatalf("invalid size of entry %d of manifest %s: %v", idx, manifest, err)
+			}
+		}
+		importOptions[idx] = opts
+	}
+
+	cdiCli, err := cdi.NewClient(importOpts.master, importOpts.kubeconfig)
+	if err != nil {
+		log.Fatalf("err encountered creation of cdi client: %v", err)
+	}
+
+	newClients, err := importOpts.awsClients(cdiCli)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	tracer, err := importOpts.trace.tracer()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	notifier, err := importOpts.notify.notifier(importOpts.retry)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if stateDir != "" {
+		if err := os.MkdirAll(stateDir, 0700); err != nil {
+			log.Fatalf("err encountered creating state directory %s: %v", stateDir, err)
+		}
+	}
+
+	// imports of the same AMI run one after the other, so that the second
+	// reuses the copy and export of the first rather than racing it
+	amiLocks := map[string]*sync.Mutex{}
+	for _, entry := range entries {
+		if amiLocks[entry.AmiId] == nil {
+			amiLocks[entry.AmiId] = &sync.Mutex{}
+		}
+	}
+
+	results := make([]batchResult, len(entries))
+	work := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < concurrency && w < len(entries); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range work {
+				entry := entries[idx]
+
+				stateStore := importer.NewMemoryStateStore()
+				if stateDir != "" {
+					stateStore = importer.NewFileStateStore(filepath.Join(stateDir, fmt.Sprintf("%s-%s.json", entry.Namespace, entry.PvcName)))
+				}
+
+				lock := amiLocks[entry.AmiId]
+				lock.Lock()
+				// every import is its own trace, recorded through
+				// copies of the shared clients
+				opts := importOptions[idx]
+				opts.Trace = tracer.NewScope()
+				logger := importLogger(opts)
+				clients := newClients(opts.Trace, logger)
+				clients.CDI = cdiCli.WithTraceScope(opts.Trace).WithLogger(logger)
+
+				logger = logger.WithValues(logging.KeyAmi, entry.AmiId)
+				logger.Info("Importing AMI into pvc")
+				start := time.Now()
+
+				imp := importer.New(opts, clients, stateStore)
+				imp.AddObserver(importer.NewEventRecorder(cdiCli, nil))
+				err := imp.Run()
+				lock.Unlock()
+
+				if err != nil {
+					logger.Error(err, "Import of AMI into pvc failed")
+				} else {
+					logger.Info("Imported AMI into pvc")
+				}
+				sendNotification(notifier, imp.Result(err))
+				results[idx] = batchResult{entry: entry, err: err, duration: time.Since(start)}
+			}
+		}()
+	}
+	for idx := range entries {
+		work <- idx
+	}
+	close(work)
+	wg.Wait()
+	importOpts.pushMetrics()
+	tracer.Shutdown()
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AMI\tPVC\tRESULT\tDURATION\tDETAIL")
+	for _, result := range results {
+		status := "SUCCEEDED"
+		detail := ""
+		if result.err != nil {
+			status = "FAILED"
+			detail = result.err.Error()
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s/%s\t%s\t%s\t%s\n", result.entry.AmiId, result.entry.Namespace, result.entry.PvcName, status, result.duration.Round(time.Second), detail)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		log.Printf("%d of %d imports failed", failed, len(results))
+		os.Exit(1)
+	}
+}
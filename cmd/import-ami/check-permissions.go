@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+)
+
+type accessCheck struct {
+	group    string
+	resource string
+	verb     string
+}
+
+type permissionRow struct {
+	permission string
+	resource   string
+	method     string
+	allowed    bool
+	detail     string
+}
+
+// runCheckPermissions verifies up front that every AWS and Kubernetes call an
+// import makes is permitted, and prints the outcome as a single table.
+func runCheckPermissions(args []string) {
+	var region string
+	var amiId string
+	var s3Bucket string
+	var s3ReaderRoleArn string
+	var kmsKeyArn string
+	var awsCreds aws.Credentials
+	var awsCredentialsSecret string
+
+	var kubeconfig string
+	var master string
+	var pvcNamespace string
+	var logOpts logFlags
+
+	fs := flag.NewFlagSet("check-permissions", flag.ExitOnError)
+	fs.StringVar(&region, "region", "", "The AWS region the AMI resides in")
+	fs.StringVar(&amiId, "ami-id", "", "The ID of the ami to import. Improves the accuracy of the EC2 dry runs")
+	fs.StringVar(&s3Bucket, "s3-bucket", "", "The s3 bucket AMIs are exported to")
+	fs.StringVar(&s3ReaderRoleArn, "s3-reader-role-arn", "", "Check that the role used to mint per-import s3 credentials can be assumed")
+	fs.StringVar(&kmsKeyArn, "kms-key-arn", "", "ARN of the KMS key encrypted copies are made with. The KMS actions of encrypted copies are checked on any key when unset")
+	addAWSCredentialFlags(fs, &awsCreds, &awsCredentialsSecret)
+
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
+	fs.StringVar(&master, "master", "", "k8s master url")
+	fs.StringVar(&pvcNamespace, "pvc-namespace", "default", "namespace the pvcs are imported into")
+
+	addLogFlags(fs, &logOpts)
+
+	fs.Parse(args)
+	logOpts.setup()
+	if s3Bucket == "" {
+		log.Fatalf("--s3-bucket is required")
+	}
+
+	cdiCli, err := cdi.NewClient(master, kubeconfig)
+	if err != nil {
+		log.Fatalf("err encountered creation of cdi client: %v", err)
+	}
+
+	if awsCredentialsSecret != "" {
+		err = loadAWSCredentialsSecret(awsCredentialsSecret, cdiCli, &awsCreds)
+		if err != nil {
+			log.Fatalf("err encountered loading aws credentials from secret %s: %v", awsCredentialsSecret, err)
+		}
+	}
+
+	awsCli, err := aws.NewClient(region, awsCreds)
+	if err != nil {
+		log.Fatalf("err encountered creation of aws client: %v", err)
+	}
+
+	var rows []permissionRow
+
+	checks, err := awsCli.CheckPermissions(amiId, s3Bucket, s3ReaderRoleArn, kmsKeyArn)
+	for _, check := range checks {
+		rows = append(rows, permissionRow{
+			permission: check.Action,
+			resource:   check.Resource,
+			method:     check.Method,
+			allowed:    check.Allowed,
+			detail:     check.Detail,
+		})
+	}
+	if err != nil {
+		rows = append(rows, permissionRow{
+			permission: "iam:SimulatePrincipalPolicy",
+			resource:   "*",
+			method:     aws.PermissionMethodSimulation,
+			detail:     err.Error(),
+		})
+	}
+
+	k8sChecks := []accessCheck{
+		{"cdi.kubevirt.io", "datavolumes", "get"},
+		{"cdi.kubevirt.io", "datavolumes", "create"},
+		{"", "events", "create"},
+		{"", "events", "update"},
+	}
+	if s3ReaderRoleArn != "" {
+		for _, verb := range []string{"get", "create", "update", "patch", "delete"} {
+			k8sChecks = append(k8sChecks, accessCheck{"", "secrets", verb})
+		}
+	}
+
+	for _, check := range k8sChecks {
+		row := permissionRow{
+			permission: fmt.Sprintf("%s %s", check.verb, check.resource),
+			resource:   pvcNamespace,
+			method:     "SelfSubjectAccessReview",
+		}
+		if check.group != "" {
+			row.permission = fmt.Sprintf("%s %s.%s", check.verb, check.resource, check.group)
+		}
+		row.allowed, row.detail, err = cdiCli.CheckAccess(pvcNamespace, check.group, check.resource, check.verb)
+		if err != nil {
+			row.detail = err.Error()
+		}
+		rows = append(rows, row)
+	}
+
+	failed := false
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERMISSION\tRESOURCE\tMETHOD\tRESULT\tDETAIL")
+	for _, row := range rows {
+		result := "PASS"
+		if !row.allowed {
+			result = "FAIL"
+			failed = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", row.permission, row.resource, row.method, result, row.detail)
+	}
+	w.Flush()
+
+	if failed {
+		os.Exit(1)
+	}
+}
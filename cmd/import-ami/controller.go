@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+	"kubevirt.io/kubevirt-cloud-import/pkg/controller"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/metrics"
+	"kubevirt.io/kubevirt-cloud-import/pkg/tracing"
+)
+
+const (
+	DefaultControllerWorkers    = 2
+	DefaultControllerMaxImports = 4
+	DefaultControllerResync     = 30 * time.Second
+	DefaultMetricsBindAddress   = ":8080"
+)
+
+// runController reconciles AMIImport resources until it is signalled to
+// stop.
+func runController(args []string) {
+	var kubeconfig string
+	var master string
+	var namespace string
+	var workers int
+	var maxImports int
+	var resyncPeriod time.Duration
+	var steps stepFlags
+	var metricsBindAddress string
+	var trace traceFlags
+	var logOpts logFlags
+	var notifyOpts notifyFlags
+	var notifyAllowedHosts string
+
+	fs := flag.NewFlagSet("controller", flag.ExitOnError)
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
+	fs.StringVar(&master, "master", "", "k8s master url")
+	fs.StringVar(&namespace, "namespace", "", "Namespace to watch AMIImports in. All namespaces when unset")
+	fs.IntVar(&workers, "workers", DefaultControllerWorkers, "Number of AMIImports reconciled concurrently")
+	fs.IntVar(&maxImports, "max-imports", DefaultControllerMaxImports, "Maximum number of imports running at once")
+	fs.DurationVar(&resyncPeriod, "resync-period", DefaultControllerResync, "How often every AMIImport is reconciled")
+	fs.StringVar(&metricsBindAddress, "metrics-bind-address", DefaultMetricsBindAddress, "Address the /metrics endpoint is served on. Disabled when empty")
+	addStepFlags(fs, &steps)
+	addTraceFlags(fs, &trace)
+	addLogFlags(fs, &logOpts)
+	addNotifyFlags(fs, &notifyOpts)
+	fs.StringVar(&notifyAllowedHosts, "notify-allowed-hosts", "", "Comma separated hosts AMIImports may post their result to. AMIImports can not set notifications of their own when unset")
+
+	fs.Parse(args)
+	logOpts.setup()
+	if workers < 1 {
+		log.Fatalf("--workers must be at least 1")
+	} else if maxImports < 1 {
+		log.Fatalf("--max-imports must be at least 1")
+	}
+	if err := steps.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := trace.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	tracer, err := trace.tracer()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := notifyOpts.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	notifier, err := notifyOpts.notifier(steps.retry)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	cdiCli, err := cdi.NewClient(master, kubeconfig)
+	if err != nil {
+		log.Fatalf("err encountered creation of cdi client: %v", err)
+	}
+
+	newAWSClient := func(region string, creds aws.Credentials, scope *tracing.Scope, log logr.Logger) (importer.AWSClient, error) {
+		awsCli, err := aws.NewClient(region, creds)
+		if err != nil {
+			return nil, err
+		}
+		return awsCli.WithTraceScope(scope).WithLogger(log), nil
+	}
+
+	if metricsBindAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		go func() {
+			log.Printf("Serving metrics on %s/metrics", metricsBindAddress)
+			log.Fatalf("err encountered serving metrics: %v", http.ListenAndServe(metricsBindAddress, mux))
+		}()
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	c := controller.New(cdiCli, newAWSClient, namespace, maxImports, resyncPeriod)
+	c.SetStepOptions(steps.timeouts, steps.pollInterval, steps.retry)
+	c.SetCDIClientFactory(func(scope *tracing.Scope, log logr.Logger) importer.CDIClient {
+		return cdiCli.WithTraceScope(scope).WithLogger(log)
+	})
+	if tracer != nil {
+		c.EnableTracing(tracer)
+		defer tracer.Shutdown()
+	}
+	if notifier != nil {
+		c.EnableNotifications(notifier)
+	}
+	if notifyAllowedHosts != "" {
+		c.AllowNotifyHosts(strings.Split(notifyAllowedHosts, ","))
+	}
+	c.Run(workers, stop)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/disk"
+)
+
+// maxConversionReason bounds the output of a failed tool kept in the
+// termination message, which Kubernetes limits to 4096 bytes.
+const maxConversionReason = 1024
+
+// runConvertDisk runs inside the conversion job. It converts the guest of
+// the imported disk and reports the result as the container's termination
+// message.
+func runConvertDisk(args []string) {
+	var path string
+	var opts disk.ConversionOptions
+	var logOpts logFlags
+
+	fs := flag.NewFlagSet("convert-disk", flag.ExitOnError)
+	fs.StringVar(&path, "path", "", "Path of the imported disk image or block device")
+	fs.StringVar(&opts.Tool, "tool", disk.ConvertToolVirtCustomize, "Tool converting the guest (virt-customize, virt-v2v-in-place)")
+	fs.BoolVar(&opts.RemoveCloudAgents, "remove-cloud-agents", false, "Uninstall agents that only work on EC2, such as the SSM agent")
+	fs.BoolVar(&opts.ResetNetworkNaming, "reset-network-naming", true, "Remove network configuration tied to the MAC address of the EC2 instance")
+
+	addLogFlags(fs, &logOpts)
+
+	fs.Parse(args)
+	logOpts.setup()
+	if path == "" {
+		log.Fatalf("--path is required")
+	}
+	tool, err := disk.ParseConvertTool(opts.Tool)
+	if err != nil {
+		log.Fatalf("invalid --tool: %v", err)
+	}
+	opts.Tool = tool
+
+	script, err := ioutil.TempFile("", "convert-*.sh")
+	if err != nil {
+		log.Fatalf("err encountered creating guest script: %v", err)
+	}
+	defer os.Remove(script.Name())
+	if _, err := script.WriteString(disk.GuestScript(opts)); err != nil {
+		log.Fatalf("err encountered writing guest script: %v", err)
+	}
+	script.Close()
+
+	result := disk.Conversion{Succeeded: true, Tool: opts.Tool, Changes: opts.Changes()}
+	for _, command := range disk.ConversionCommands(path, script.Name(), opts) {
+		log.Printf("Running %s", strings.Join(command, " "))
+		if reason := runConversionCommand(command); reason != "" {
+			result.Succeeded = false
+			result.Reason = reason
+			break
+		}
+	}
+
+	out, err := json.Marshal(result)
+	if err != nil {
+		log.Fatalf("err encountered encoding result: %v", err)
+	}
+	fmt.Println(string(out))
+	if err := ioutil.WriteFile(terminationMessagePath, out, 0644); err != nil {
+		log.Printf("Unable to write termination message: %v", err)
+	}
+
+	if !result.Succeeded {
+		log.Printf("Conversion of disk %s failed: %s", path, result.Reason)
+		os.Exit(1)
+	}
+}
+
+// runConversionCommand runs command with its output passed through, and
+// returns why it failed, ending with the last of its output, or "" when it
+// succeeded.
+func runConversionCommand(command []string) string {
+	var output bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = io.MultiWriter(os.Stdout, &output)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+	err := cmd.Run()
+	if err == nil {
+		return ""
+	}
+
+	tail := strings.TrimSpace(output.String())
+	if len(tail) > maxConversionReason {
+		tail = "..." + tail[len(tail)-maxConversionReason:]
+	}
+	return fmt.Sprintf("%s failed: %v: %s", command[0], err, tail)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	k8sv1 "k8s.io/api/core/v1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+)
+
+type secretGetter interface {
+	GetSecret(name string, namespace string) (*k8sv1.Secret, error)
+}
+
+// addAWSCredentialFlags registers the options selecting how AWS credentials
+// are obtained on fs.
+func addAWSCredentialFlags(fs *flag.FlagSet, creds *aws.Credentials, credentialsSecret *string) {
+	fs.StringVar(&creds.Profile, "profile", "", "Named AWS profile from the shared config and credentials files to authenticate with")
+	fs.StringVar(&creds.RoleArn, "role-arn", "", "ARN of an IAM role to assume for all AWS calls")
+	fs.StringVar(&creds.ExternalId, "external-id", "", "External id to pass when assuming a role")
+	fs.StringVar(&creds.RoleSessionName, "role-session-name", "", "Session name to use when assuming a role. Defaults to kubevirt-cloud-import")
+	fs.StringVar(&creds.WebIdentityTokenFile, "web-identity-token-file", "", "File containing an OIDC token, such as a projected service account token, used to assume the role with AssumeRoleWithWebIdentity")
+	fs.StringVar(credentialsSecret, "aws-credentials-secret", "", "k8s secret, as namespace/name, holding the base AWS credentials under accessKeyId, secretKey and an optional sessionToken")
+	fs.Var(&credentialsDirFlag{creds: creds}, "aws-credentials-dir", "Directory holding the base AWS credentials as accessKeyId, secretKey and an optional sessionToken file, such as a secret mounted as a Tekton workspace, or as AWS shared credentials and config files")
+}
+
+// The files of a directory given to --aws-credentials-dir.
+const (
+	sharedCredentialsFile = "credentials"
+	sharedConfigFile      = "config"
+)
+
+// credentialsDirFlag loads the base AWS credentials from the directory it
+// is set to.
+type credentialsDirFlag struct {
+	dir   string
+	creds *aws.Credentials
+}
+
+func (f *credentialsDirFlag) String() string {
+	return f.dir
+}
+
+// Set ignores an empty dir, which is what an unbound optional Tekton
+// workspace's path resolves to.
+func (f *credentialsDirFlag) Set(dir string) error {
+	f.dir = dir
+	if dir == "" {
+		return nil
+	}
+	return loadAWSCredentialsDir(dir, f.creds)
+}
+
+// loadAWSCredentialsDir reads the base AWS credentials from dir, either from
+// files named after the keys of the s3 secret given to CDI or from AWS
+// shared credentials and config files.
+func loadAWSCredentialsDir(dir string, creds *aws.Credentials) error {
+	readKey := func(key string) (string, error) {
+		value, err := ioutil.ReadFile(filepath.Join(dir, key))
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return strings.TrimSpace(string(value)), err
+	}
+
+	accessKeyId, err := readKey(cdi.S3SecretAccessKeyIdKey)
+	if err != nil {
+		return err
+	}
+	secretKey, err := readKey(cdi.S3SecretKeyKey)
+	if err != nil {
+		return err
+	}
+	if accessKeyId != "" || secretKey != "" {
+		if accessKeyId == "" || secretKey == "" {
+			return fmt.Errorf("directory %s must contain both %s and %s", dir, cdi.S3SecretAccessKeyIdKey, cdi.S3SecretKeyKey)
+		}
+		sessionToken, err := readKey(cdi.S3SecretSessionTokenKey)
+		if err != nil {
+			return err
+		}
+		creds.AccessKeyId = accessKeyId
+		creds.SecretAccessKey = secretKey
+		creds.SessionToken = sessionToken
+		return nil
+	}
+
+	found := false
+	for name, files := range map[string]*[]string{
+		sharedCredentialsFile: &creds.SharedCredentialsFiles,
+		sharedConfigFile:      &creds.SharedConfigFiles,
+	} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		*files = []string{path}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("directory %s contains neither %s and %s nor a %s or %s file", dir, cdi.S3SecretAccessKeyIdKey, cdi.S3SecretKeyKey, sharedCredentialsFile, sharedConfigFile)
+	}
+	return nil
+}
+
+// loadAWSCredentialsSecret reads the base AWS credentials from the secret
+// referenced as namespace/name, in the same format as the s3 secret given
+// to CDI.
+func loadAWSCredentialsSecret(secretRef string, secrets secretGetter, creds *aws.Credentials) error {
+	if creds.AccessKeyId != "" || len(creds.SharedCredentialsFiles) != 0 || len(creds.SharedConfigFiles) != 0 {
+		return fmt.Errorf("--aws-credentials-secret and --aws-credentials-dir are mutually exclusive")
+	}
+
+	parts := strings.Split(secretRef, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("secret reference %q must be in the form namespace/name", secretRef)
+	}
+
+	secret, err := secrets.GetSecret(parts[1], parts[0])
+	if err != nil {
+		return err
+	}
+
+	accessKeyId := string(secret.Data[cdi.S3SecretAccessKeyIdKey])
+	secretKey := string(secret.Data[cdi.S3SecretKeyKey])
+	if accessKeyId == "" || secretKey == "" {
+		return fmt.Errorf("secret %s must contain %s and %s", secretRef, cdi.S3SecretAccessKeyIdKey, cdi.S3SecretKeyKey)
+	}
+
+	creds.AccessKeyId = accessKeyId
+	creds.SecretAccessKey = secretKey
+	creds.SessionToken = string(secret.Data[cdi.S3SecretSessionTokenKey])
+	return nil
+}
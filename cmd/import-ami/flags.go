@@ -0,0 +1,297 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/disk"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+	"kubevirt.io/kubevirt-cloud-import/pkg/metrics"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+	"kubevirt.io/kubevirt-cloud-import/pkg/tracing"
+)
+
+// DefaultPushgatewayJob is the job metrics are pushed under.
+const DefaultPushgatewayJob = "import-ami"
+
+// importFlags are the options shared by every command that imports images.
+type importFlags struct {
+	region       string
+	s3Bucket     string
+	exportFormat string
+	kubeconfig   string
+	master       string
+
+	awsCreds             aws.Credentials
+	awsCredentialsSecret string
+	copyRoleArn          string
+	exportRoleArn        string
+	kmsKeyId             string
+	vmImportRoleName     string
+
+	s3SecretName          string
+	s3ReaderRoleArn       string
+	s3CredentialsDuration time.Duration
+
+	pvcNamespace    string
+	pvcStorageClass string
+	pvcSize         string
+	pvcAccessMode   string
+
+	verify      bool
+	verifyImage string
+
+	convert      bool
+	convertImage string
+	conversion   disk.ConversionOptions
+
+	stepFlags
+
+	pushgatewayUrl string
+	pushgatewayJob string
+
+	trace  traceFlags
+	log    logFlags
+	notify notifyFlags
+}
+
+func addImportFlags(fs *flag.FlagSet, f *importFlags) {
+	fs.StringVar(&f.region, "region", "", "The AWS region the AMI resides in. NOTE: if the AMI is shared from another account, a copy of the AMI will be created in the client's account in order to import to KubeVirt")
+	fs.StringVar(&f.s3Bucket, "s3-bucket", "", "The s3 bucket to use to store and deliver the AMI into kubevirt")
+	fs.StringVar(&f.exportFormat, "export-format", aws.ExportImageFormatVmdk, "The disk format the AMI is exported to s3 in (vmdk, vhd, raw). raw avoids a format conversion during import at the cost of a larger s3 object")
+	fs.StringVar(&f.kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
+	fs.StringVar(&f.master, "master", "", "k8s master url")
+
+	addAWSCredentialFlags(fs, &f.awsCreds, &f.awsCredentialsSecret)
+	fs.StringVar(&f.copyRoleArn, "copy-role-arn", "", "ARN of an IAM role to assume for copying the AMI or snapshot into the client's account. Defaults to --role-arn")
+	fs.StringVar(&f.exportRoleArn, "export-role-arn", "", "ARN of an IAM role to assume for exporting the AMI to s3. Must belong to the same account as the copy role. Defaults to --role-arn")
+
+	fs.StringVar(&f.vmImportRoleName, "role-name", aws.VMImportRoleName, "Name of the VM Import/Export service role the AMI is exported with, as created by setup --role-name")
+	fs.StringVar(&f.kmsKeyId, "kms-key-id", "", "ID or ARN of a KMS key owned by the client's account to encrypt copies of the AMI or snapshot with. Encrypted images are otherwise re-encrypted with the account's default EBS key")
+
+	fs.StringVar(&f.s3SecretName, "s3-secret", "", "The k8s secret containing the access credentials necessary to pull the ami from the s3 bucket")
+	fs.StringVar(&f.s3ReaderRoleArn, "s3-reader-role-arn", "", "ARN of an IAM role able to read the s3 bucket. When set, temporary credentials scoped to the exported object are minted from it into a per-import secret instead of using --s3-secret")
+	fs.DurationVar(&f.s3CredentialsDuration, "s3-credentials-duration", time.Hour, "Lifetime of the credentials minted with --s3-reader-role-arn. Must cover the DataVolume import and be allowed by the role's maximum session duration")
+
+	fs.StringVar(&f.pvcNamespace, "pvc-namespace", "default", "namespace of pvc to be created to store AMI")
+	fs.StringVar(&f.pvcSize, "pvc-size", "6Gi", "size of pvc to store AMI")
+	fs.StringVar(&f.pvcStorageClass, "pvc-storageclass", "", "storage class to use for pvc")
+	fs.StringVar(&f.pvcAccessMode, "pvc-accessmode", "ReadWriteOnce", "Access mode to use for pvc")
+
+	fs.BoolVar(&f.verify, "verify", false, "Verify the imported pvc against the exported image by comparing virtual size and content hash. Requires the client to be able to read the s3 object")
+	fs.StringVar(&f.verifyImage, "verify-image", importer.DefaultVerifyImage, "Image of the Job verifying the imported pvc")
+
+	fs.BoolVar(&f.convert, "convert", false, "Convert the guest of the imported pvc for KubeVirt once it is imported and verified, with a Job ensuring virtio drivers are in the initramfs of every kernel. Linux guests only, unless --convert-tool is virt-v2v-in-place")
+	fs.StringVar(&f.conversion.Tool, "convert-tool", disk.ConvertToolVirtCustomize, "Tool converting the guest (virt-customize, virt-v2v-in-place). virt-v2v-in-place also converts Windows guests and requires an image with virt-v2v 2.0 or later")
+	fs.StringVar(&f.convertImage, "convert-image", importer.DefaultConvertImage, "Image of the Job converting the guest of the imported pvc. It must provide libguestfs and the --convert-tool")
+	fs.BoolVar(&f.conversion.RemoveCloudAgents, "convert-remove-cloud-agents", false, "Uninstall agents that only work on EC2, such as the SSM and CloudWatch agents, when converting the guest")
+	fs.BoolVar(&f.conversion.ResetNetworkNaming, "convert-reset-network-naming", true, "Remove network configuration tied to the MAC address of the EC2 instance, such as persistent net udev rules, when converting the guest")
+
+	addStepFlags(fs, &f.stepFlags)
+
+	fs.StringVar(&f.pushgatewayUrl, "pushgateway-url", "", "URL of a Prometheus Pushgateway the metrics of the run are pushed to once it ends, such as http://pushgateway.monitoring:9091")
+	fs.StringVar(&f.pushgatewayJob, "pushgateway-job", DefaultPushgatewayJob, "Job the metrics pushed to --pushgateway-url are grouped under, alongside an instance label set to the host name")
+
+	addTraceFlags(fs, &f.trace)
+	addLogFlags(fs, &f.log)
+	addNotifyFlags(fs, &f.notify)
+}
+
+// stepFlags bound the steps of imports, for the commands running them and
+// the controller.
+type stepFlags struct {
+	timeouts     importer.Timeouts
+	pollInterval time.Duration
+	retry        retry.Policy
+}
+
+func addStepFlags(fs *flag.FlagSet, f *stepFlags) {
+	fs.DurationVar(&f.timeouts.Copy, "copy-timeout", importer.DefaultTimeout, "Time allowed for the copy of a snapshot shared from another account")
+	fs.DurationVar(&f.timeouts.Available, "available-timeout", importer.DefaultTimeout, "Time allowed for a copied or registered AMI to become available")
+	fs.DurationVar(&f.timeouts.Export, "export-timeout", importer.DefaultTimeout, "Time allowed for the export of the AMI to s3. Exports of large images take hours")
+	fs.DurationVar(&f.timeouts.Import, "import-timeout", importer.DefaultTimeout, "Time allowed for CDI to import the exported image into the pvc")
+	fs.DurationVar(&f.timeouts.Verify, "verify-timeout", importer.DefaultTimeout, "Time allowed for the Job verifying the imported pvc")
+	fs.DurationVar(&f.timeouts.Convert, "convert-timeout", importer.DefaultTimeout, "Time allowed for the Job converting the guest of the imported pvc. Conversions are much slower on nodes without /dev/kvm")
+	fs.DurationVar(&f.pollInterval, "poll-interval", importer.DefaultPollInterval, "How often the progress of the copy, export, import and verification is polled")
+
+	defaultRetry := retry.DefaultPolicy()
+	fs.IntVar(&f.retry.MaxAttempts, "retry-attempts", defaultRetry.MaxAttempts, "Number of times a step failing with a throttling, server or network error is attempted. 1 disables retries")
+	fs.DurationVar(&f.retry.InitialBackoff, "retry-initial-backoff", defaultRetry.InitialBackoff, "Wait before the first retry of a step, doubled for each further retry")
+	fs.DurationVar(&f.retry.MaxBackoff, "retry-max-backoff", defaultRetry.MaxBackoff, "Maximum wait between retries of a step")
+	f.retry.Multiplier = defaultRetry.Multiplier
+	f.retry.Jitter = defaultRetry.Jitter
+}
+
+func (f *stepFlags) validate() error {
+	for name, timeout := range map[string]time.Duration{
+		"copy-timeout":      f.timeouts.Copy,
+		"available-timeout": f.timeouts.Available,
+		"export-timeout":    f.timeouts.Export,
+		"import-timeout":    f.timeouts.Import,
+		"verify-timeout":    f.timeouts.Verify,
+		"convert-timeout":   f.timeouts.Convert,
+		"poll-interval":     f.pollInterval,
+	} {
+		if timeout <= 0 {
+			return fmt.Errorf("--%s must be positive", name)
+		}
+	}
+	if f.retry.MaxAttempts < 1 {
+		return fmt.Errorf("--retry-attempts must be at least 1")
+	}
+	return nil
+}
+
+// pushMetrics pushes the metrics of the run to --pushgateway-url, if set.
+// A failed push is logged, it does not fail the run.
+func (f *importFlags) pushMetrics() {
+	if f.pushgatewayUrl == "" {
+		return
+	}
+
+	instance, err := os.Hostname()
+	if err != nil {
+		logging.Default().Error(err, "Unable to determine host name for metrics")
+	}
+	err = metrics.Push(f.pushgatewayUrl, f.pushgatewayJob, map[string]string{"instance": instance}, metrics.Registry)
+	if err != nil {
+		logging.Default().Error(err, "Error encountered pushing metrics", "pushgateway", f.pushgatewayUrl)
+	}
+}
+
+// validate checks the flags and fills in defaults for those left empty.
+func (f *importFlags) validate() error {
+	if f.s3Bucket == "" {
+		return fmt.Errorf("--s3-bucket is required")
+	} else if f.s3ReaderRoleArn != "" && f.s3SecretName != "" {
+		return fmt.Errorf("--s3-reader-role-arn and --s3-secret are mutually exclusive")
+	}
+
+	exportFormat, err := aws.ParseExportImageFormat(f.exportFormat)
+	if err != nil {
+		return fmt.Errorf("invalid --export-format: %v", err)
+	}
+	f.exportFormat = exportFormat
+	if f.verify && !disk.SupportsDigest(exportFormat) {
+		return fmt.Errorf("--verify is not supported with --export-format %s, the content of %s exports can not be computed", exportFormat, exportFormat)
+	}
+
+	convertTool, err := disk.ParseConvertTool(f.conversion.Tool)
+	if err != nil {
+		return fmt.Errorf("invalid --convert-tool: %v", err)
+	}
+	f.conversion.Tool = convertTool
+
+	if f.pvcNamespace == "" {
+		f.pvcNamespace = "default"
+	}
+	if f.pvcAccessMode == "" {
+		f.pvcAccessMode = "ReadWriteOnce"
+	}
+	if f.pvcSize == "" {
+		f.pvcSize = "6Gi"
+	}
+
+	if err := f.stepFlags.validate(); err != nil {
+		return err
+	}
+	if err := f.trace.validate(); err != nil {
+		return err
+	}
+	return f.notify.validate()
+}
+
+// options returns the import options set by the flags. The source and pvc
+// name are left to the caller.
+func (f *importFlags) options() (importer.Options, error) {
+	pvcSize, err := resource.ParseQuantity(f.pvcSize)
+	if err != nil {
+		return importer.Options{}, fmt.Errorf("invalid --pvc-size: %v", err)
+	}
+
+	return importer.Options{
+		Region:                f.region,
+		S3Bucket:              f.s3Bucket,
+		ExportFormat:          f.exportFormat,
+		KmsKeyId:              f.kmsKeyId,
+		VMImportRoleName:      f.vmImportRoleName,
+		S3SecretName:          f.s3SecretName,
+		S3ReaderRoleArn:       f.s3ReaderRoleArn,
+		S3CredentialsDuration: f.s3CredentialsDuration,
+		PvcNamespace:          f.pvcNamespace,
+		PvcStorageClass:       f.pvcStorageClass,
+		PvcAccessMode:         f.pvcAccessMode,
+		PvcSize:               pvcSize,
+		Verify:                f.verify,
+		VerifyImage:           f.verifyImage,
+		Convert:               f.convert,
+		ConvertImage:          f.convertImage,
+		Conversion:            f.conversion,
+		Timeouts:              f.timeouts,
+		PollInterval:          f.pollInterval,
+		Retry:                 f.retry,
+	}, nil
+}
+
+// baseAWSCredentials returns the credentials given by flags, with the base
+// credentials read from --aws-credentials-secret through secrets when it is
+// set.
+func (f *importFlags) baseAWSCredentials(secrets secretGetter) (aws.Credentials, error) {
+	awsCreds := f.awsCreds
+	if f.awsCredentialsSecret != "" {
+		err := loadAWSCredentialsSecret(f.awsCredentialsSecret, secrets, &awsCreds)
+		if err != nil {
+			return awsCreds, fmt.Errorf("err encountered loading aws credentials from secret %s: %v", f.awsCredentialsSecret, err)
+		}
+	}
+	return awsCreds, nil
+}
+
+// awsClients creates the aws clients of imports. The base credentials are
+// read from --aws-credentials-secret through secrets when it is set. The
+// cdi client is left to the caller.
+func (f *importFlags) awsClients(secrets secretGetter) (scopedClients, error) {
+	awsCreds, err := f.baseAWSCredentials(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	awsCli, err := aws.NewClient(f.region, awsCreds)
+	if err != nil {
+		return nil, fmt.Errorf("err encountered creation of aws client: %v", err)
+	}
+	copyCli := awsCli
+	exportCli := awsCli
+
+	if f.copyRoleArn != "" {
+		copyCreds := awsCreds
+		copyCreds.RoleArn = f.copyRoleArn
+		copyCli, err = aws.NewClient(f.region, copyCreds)
+		if err != nil {
+			return nil, fmt.Errorf("err encountered creation of aws client for copy role: %v", err)
+		}
+	}
+
+	if f.exportRoleArn != "" {
+		exportCreds := awsCreds
+		exportCreds.RoleArn = f.exportRoleArn
+		exportCli, err = aws.NewClient(f.region, exportCreds)
+		if err != nil {
+			return nil, fmt.Errorf("err encountered creation of aws client for export role: %v", err)
+		}
+	}
+
+	return func(scope *tracing.Scope, log logr.Logger) importer.Clients {
+		return importer.Clients{
+			AWS:    awsCli.WithTraceScope(scope).WithLogger(log),
+			Copy:   copyCli.WithTraceScope(scope).WithLogger(log),
+			Export: exportCli.WithTraceScope(scope).WithLogger(log),
+		}
+	}, nil
+}
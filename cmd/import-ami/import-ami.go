@@ -4,17 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"time"
+	"os"
 
-	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
+	sdkaws "github.com/aws/aws-sdk-go-v2/aws"
 	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
 	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
-)
-
-const (
-	ExportImageFormat = "vmdk"
-	S3PrefixFormat    = "kubevirt-image-exports/orig-%s-"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
 )
 
 // TODO
@@ -22,178 +18,209 @@ const (
 // Require pvc-size or auto detect an approperiate size
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "setup":
+			runSetup(os.Args[2:])
+			return
+		case "check-permissions":
+			runCheckPermissions(os.Args[2:])
+			return
+		case "batch":
+			runBatch(os.Args[2:])
+			return
+		case "sync":
+			runSync(os.Args[2:])
+			return
+		case "verify-disk":
+			runVerifyDisk(os.Args[2:])
+			return
+		case "convert-disk":
+			runConvertDisk(os.Args[2:])
+			return
+		case "controller":
+			runController(os.Args[2:])
+			return
+		}
+	}
 
-	var region string
+	var importOpts importFlags
 	var amiId string
-	var s3Bucket string
-	var kubeconfig string
-	var master string
-
-	var s3SecretName string
-
+	var snapshotId string
+	var snapshotArch string
+	var snapshotBootMode string
 	var pvcName string
-	var pvcNamespace string
-	var pvcStorageClass string
-	var pvcSize string
-	var pvcAccessMode string
 
-	flag.StringVar(&region, "region", "", "The AWS region the AMI resides in. NOTE: if the AMI is shared from another account, a copy of the AMI will be created in the client's account in order to import to KubeVirt")
+	var stateFile string
+	var stateConfigMap string
+	var selector aws.ImageSelector
+	var dryRun bool
+	var output string
+	var resultsDirFlag string
+
+	addImportFlags(flag.CommandLine, &importOpts)
+	addImageSelectorFlags(flag.CommandLine, &selector)
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the plan of the import, including the DataVolume it would create, without changing anything in AWS or the cluster")
+	flag.StringVar(&output, "output", outputText, "Format of the outcome of the import (text, json). json prints a result document to stdout, also when the import fails, and the plan of --dry-run as json")
+	flag.StringVar(&resultsDirFlag, "results-dir", "", "Directory the pvc name and namespace, exported s3 path, copied AMI id, architecture and boot mode are written to as one file each once the import succeeds. Defaults to "+tektonResultsDir+" when running in a Tekton task")
 	flag.StringVar(&amiId, "ami-id", "", "The ID of the ami to import")
-	flag.StringVar(&s3Bucket, "s3-bucket", "", "The s3 bucket to use to store and deliver the AMI into kubevirt")
-	flag.StringVar(&kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
-	flag.StringVar(&master, "master", "", "k8s master url")
-
-	flag.StringVar(&s3SecretName, "s3-secret", "", "The k8s secret containing the access credentials necessary to pull the ami from the s3 bucket")
+	flag.StringVar(&snapshotId, "snapshot-id", "", "The ID of an EBS snapshot to import. A temporary AMI is registered from the snapshot and removed once the import completes. Mutually exclusive with --ami-id")
+	flag.StringVar(&snapshotArch, "snapshot-architecture", "", "Architecture of the AMI registered from --snapshot-id (x86_64, arm64, i386). Detected from an existing AMI backed by the snapshot when unset")
+	flag.StringVar(&snapshotBootMode, "snapshot-boot-mode", "", "Boot mode of the AMI registered from --snapshot-id (legacy-bios, uefi). Detected from an existing AMI backed by the snapshot when unset")
+	flag.StringVar(&pvcName, "pvc-name", "", "name of pvc to be created to store AMI. Defautls to the --ami-id or --snapshot-id")
 
-	flag.StringVar(&pvcName, "pvc-name", "", "name of pvc to be created to store AMI. Defautls to the --ami-id")
-	flag.StringVar(&pvcNamespace, "pvc-namespace", "default", "namespace of pvc to be created to store AMI")
-	flag.StringVar(&pvcSize, "pvc-size", "6Gi", "size of pvc to store AMI")
-	flag.StringVar(&pvcStorageClass, "pvc-storageclass", "", "storage class to use for pvc")
-	flag.StringVar(&pvcAccessMode, "pvc-accessmode", "ReadWriteOnce", "Access mode to use for pvc")
+	flag.StringVar(&stateFile, "state-file", "", "Local file the progress of the import is saved to after every step, so that a rerun resumes where it stopped")
+	flag.StringVar(&stateConfigMap, "state-configmap", "", "Name of a config map in --pvc-namespace the progress of the import is saved to after every step, so that a rerun resumes where it stopped")
 
 	flag.Parse()
-	if amiId == "" {
-		log.Fatalf("--ami-id is required")
-	} else if s3Bucket == "" {
-		log.Fatalf("--s3-bucket is required")
+	importOpts.log.setup()
+	if err := validateOutput(output); err != nil {
+		log.Fatalf("%v", err)
+	}
+	printer := &resultPrinter{
+		output: output,
+		opts:   &importer.Options{AmiId: amiId, SnapshotId: snapshotId, PvcName: pvcName, PvcNamespace: importOpts.pvcNamespace},
 	}
 
-	if pvcName == "" {
-		pvcName = amiId
+	selected := 0
+	for _, set := range []bool{amiId != "", snapshotId != "", !selector.Empty()} {
+		if set {
+			selected++
+		}
 	}
-	if pvcNamespace == "" {
-		pvcNamespace = "default"
+	if selected == 0 {
+		err := fmt.Errorf("--ami-id, --snapshot-id or an ami selector (--ami-name, --owner, --filter, --ssm-parameter) is required")
+		printer.fatal(importer.ErrorCodeInvalidArgument, err, "%v", err)
+	} else if selected > 1 {
+		err := fmt.Errorf("--ami-id, --snapshot-id and the ami selector flags are mutually exclusive")
+		printer.fatal(importer.ErrorCodeInvalidArgument, err, "%v", err)
+	} else if stateFile != "" && stateConfigMap != "" {
+		err := fmt.Errorf("--state-file and --state-configmap are mutually exclusive")
+		printer.fatal(importer.ErrorCodeInvalidArgument, err, "%v", err)
 	}
-	if pvcAccessMode == "" {
-		pvcAccessMode = "ReadWriteOnce"
+	if err := validateImageSelector(&selector); err != nil {
+		printer.fatal(importer.ErrorCodeInvalidArgument, err, "%v", err)
 	}
-	if pvcSize == "" {
-		pvcSize = "6Gi"
+	if err := importOpts.validate(); err != nil {
+		printer.fatal(importer.ErrorCodeInvalidArgument, err, "%v", err)
 	}
 
-	pvcSizeQuantity := resource.MustParse(pvcSize)
-
-	awsCli, err := aws.NewClient(region)
+	opts, err := importOpts.options()
 	if err != nil {
-		log.Fatalf("err encountered creation of aws client: %v", err)
+		printer.fatal(importer.ErrorCodeInvalidArgument, err, "%v", err)
 	}
+	opts.AmiId = amiId
+	opts.SnapshotId = snapshotId
+	opts.PvcName = pvcName
+	printer.opts = &opts
 
-	cdiCli, err := cdi.NewClient(master, kubeconfig)
+	notifier, err := importOpts.notify.notifier(importOpts.retry)
 	if err != nil {
-		log.Fatalf("err encountered creation of cdi client: %v", err)
+		printer.fatal(importer.ErrorCodeInvalidArgument, err, "%v", err)
 	}
+	printer.notifier = notifier
 
-	// STEPS
-	// 1. Find AMI and determine who owns it
-	// 2. Copy AMI to client's account if owned by another account and shared with client
-	// 3. Export AMI to s3 bucket
-	// 4. Import AMI to KubeVirt using Datavolume
-
-	// ----------------
-	// Step 1: Find AMI
-	// ----------------
-	image, err := awsCli.FindGlobalImageById(amiId)
+	cdiCli, err := cdi.NewClient(importOpts.master, importOpts.kubeconfig)
 	if err != nil {
-		log.Fatalf("err encountered looking up ami %s: %v", amiId, err)
-	} else if image.OwnerId == nil {
-		log.Fatalf("Image is missing owner id")
+		printer.fatal("", err, "err encountered creation of cdi client: %v", err)
 	}
-	imageOwnerAccount := *image.OwnerId
-	myAccount, err := awsCli.GetMyAccountId()
+
+	newClients, err := importOpts.awsClients(cdiCli)
 	if err != nil {
-		log.Fatalf("Unable to detect account id: %v", err)
-	}
-
-	// ----------------
-	// Step 2: Copy AMI into client's account if owned by another account
-	// ----------------
-	amiToExport := ""
-	if imageOwnerAccount == myAccount {
-		log.Printf("Image is owned by client's account: %s", myAccount)
-		amiToExport = amiId
-	} else {
-		log.Printf("Image is owned by another account %s. Client account is %s", imageOwnerAccount, myAccount)
-		imageCopyName := awsCli.CopyImageName(amiId)
-		imageCopy, exists, err := awsCli.FindImageByName(imageCopyName, myAccount)
+		printer.fatal("", err, "%v", err)
+	}
+
+	if !selector.Empty() {
+		awsCreds, err := importOpts.baseAWSCredentials(cdiCli)
 		if err != nil {
-			log.Fatalf("Error encountered while searching for image by name: %v", err)
+			printer.fatal("", err, "%v", err)
 		}
-		if exists {
-			// see if we've already created a copy
-			if imageCopy.ImageId == nil {
-				log.Fatalf("Image id is nil on ami describe")
-			}
-			amiToExport = *imageCopy.ImageId
-			log.Printf("Found local copy of image named [%s] in client's account", amiToExport)
-		} else {
-			// if no copy exists, create it
-			amiToExport, err = awsCli.CopyImage(amiId, imageCopyName)
-			if err != nil {
-				log.Fatalf("Error copying ami %s: %v", amiId, err)
-			}
-			log.Printf("Made copy of ami id %s in client's account. New ami copy is called [%s]", amiId, amiToExport)
+		awsCli, err := aws.NewClient(importOpts.region, awsCreds)
+		if err != nil {
+			printer.fatal("", err, "err encountered creation of aws client: %v", err)
+		}
+		image, err := awsCli.ResolveImage(selector)
+		if err != nil {
+			printer.fatal("", err, "Error encountered resolving ami: %v", err)
 		}
+		amiId = sdkaws.ToString(image.ImageId)
+		logging.Default().Info("Resolved ami", logging.KeyAmi, amiId, "name", sdkaws.ToString(image.Name), "created", sdkaws.ToString(image.CreationDate))
 	}
 
-	err = awsCli.WaitForImageToBecomeAvailable(amiToExport, time.Minute*15)
-	if err != nil {
-		log.Fatalf("Error encountered while waiting for ami %s to become available: %v", amiToExport, err)
+	if pvcName == "" {
+		pvcName = amiId
+		if snapshotId != "" {
+			pvcName = snapshotId
+		}
+	}
+	pvcNamespace := importOpts.pvcNamespace
+
+	opts.AmiId = amiId
+	opts.SnapshotId = snapshotId
+	opts.SnapshotArchitecture = snapshotArch
+	opts.SnapshotBootMode = snapshotBootMode
+	opts.PvcName = pvcName
+
+	var stateStore importer.StateStore
+	switch {
+	case stateFile != "":
+		stateStore = importer.NewFileStateStore(stateFile)
+	case stateConfigMap != "":
+		stateStore = importer.NewConfigMapStateStore(cdiCli, stateConfigMap, pvcNamespace)
+	default:
+		stateStore = importer.NewMemoryStateStore()
 	}
 
-	// ----------------
-	// Step 3: Export AMI to s3 bucket
-	// ----------------
-	foundS3Bucket, foundS3FilePath, completed, exists, err := awsCli.GetExportTaskStatus("", amiToExport, ExportImageFormat)
-	if !exists {
-		log.Printf("Exporting ami %s to s3 bucket %s", amiToExport, s3Bucket)
-		s3Prefix := fmt.Sprintf(S3PrefixFormat, amiToExport)
-
-		taskId, err := awsCli.ExportImage(amiToExport, s3Bucket, s3Prefix, ExportImageFormat)
+	if dryRun {
+		// a dry run imports nothing to notify of
+		printer.notifier = nil
+		clients := newClients(nil, logging.Default())
+		clients.CDI = cdiCli
+		plan, err := importer.New(opts, clients, stateStore).Plan()
 		if err != nil {
-			log.Fatalf("Creation of export task for AMI %s to s3 failed: %v", amiToExport, err)
+			printer.fatal("", err, "Error encountered planning import into pvc [%s/%s]: %v", pvcNamespace, pvcName, err)
 		}
-
-		foundS3Bucket, foundS3FilePath, err = awsCli.WaitForExportImageCompletion(amiToExport, taskId, ExportImageFormat, time.Minute*15)
-		if err != nil {
-			log.Fatalf("Exporting of AMI %s to s3 failed: %v", amiToExport, err)
+		if output == outputJSON {
+			err = printJSON(os.Stdout, plan)
+		} else {
+			err = printPlan(os.Stdout, plan)
 		}
-	} else if !completed {
-		log.Printf("Waiting for existing image export job to complete")
-		foundS3Bucket, foundS3FilePath, err = awsCli.WaitForExportImageCompletion(amiToExport, "", ExportImageFormat, time.Minute*15)
 		if err != nil {
-			log.Fatalf("Exporting of AMI %s to s3 failed: %v", amiToExport, err)
+			printer.fatal("", err, "Error encountered printing plan: %v", err)
+		}
+		if len(plan.Blockers) != 0 {
+			os.Exit(1)
 		}
-	} else {
-		log.Printf("Found existing s3 export for ami %s", amiToExport)
+		return
 	}
 
-	log.Printf("AMI is exported to s3 bucket: [%s] at file path [%s]", foundS3Bucket, foundS3FilePath)
-
-	// ----------------
-	// Step 4: Import AMI to PVC using DataVolume
-	// ----------------
-
-	err = cdiCli.ImportFromS3IntoPvc(pvcName,
-		pvcNamespace,
-		pvcStorageClass,
-		pvcAccessMode,
-		foundS3Bucket,
-		foundS3FilePath,
-		region,
-		s3SecretName,
-		pvcSizeQuantity)
-
-	if err != nil && !errors.IsAlreadyExists(err) {
-		log.Fatalf("Error encountered creating DataVolume: %v", err)
+	tracer, err := importOpts.trace.tracer()
+	if err != nil {
+		printer.fatal("", err, "%v", err)
 	}
-
-	log.Printf("Created DataVolume to import AMI [%s] to pvc [%s/%s]", amiId, pvcNamespace, pvcName)
-
-	err = cdiCli.WaitForS3ImportCompletion(pvcName, pvcNamespace, 15*time.Minute)
+	scope := tracer.NewScope()
+	opts.Trace = scope
+	logger := importLogger(opts)
+	clients := newClients(scope, logger)
+	clients.CDI = cdiCli.WithTraceScope(scope).WithLogger(logger)
+
+	imp := importer.New(opts, clients, stateStore)
+	imp.AddObserver(importer.NewEventRecorder(cdiCli, nil))
+	printer.imp = imp
+	err = imp.Run()
+	importOpts.pushMetrics()
+	tracer.Shutdown()
 	if err != nil {
-		log.Fatalf("Error encountered while waiting on PVC import: %v", err)
+		printer.fatal("", err, "Error encountered importing into pvc [%s/%s]: %v", pvcNamespace, pvcName, err)
 	}
 
-	log.Printf("Success! AMI [%s] imported into PVC [%s/%s]", amiId, pvcNamespace, pvcName)
-
+	logging.Default().Info("Success! Imported into pvc", logging.KeyAmi, amiId, logging.KeySnapshot, snapshotId, logging.KeyPvc, pvcName, logging.KeyNamespace, pvcNamespace)
+	result := imp.Result(nil)
+	if dir := resultsDir(resultsDirFlag); dir != "" {
+		if err := writeTaskResults(dir, result); err != nil {
+			printer.fatal("", err, "Error encountered writing results to %s: %v", dir, err)
+		}
+	}
+	sendNotification(notifier, result)
+	printer.succeeded(result)
 }
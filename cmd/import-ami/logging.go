@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/go-logr/logr"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+)
+
+// logFlags are the options of the log every command writes to stderr.
+type logFlags struct {
+	format    string
+	verbosity int
+}
+
+// addLogFlags registers the log options on fs.
+func addLogFlags(fs *flag.FlagSet, f *logFlags) {
+	fs.StringVar(&f.format, "log-format", logging.FormatText, "Format of the log written to stderr (text, json). json writes one object per line with the ami, copyAmi, taskId, dv and step of the import it is about")
+	fs.IntVar(&f.verbosity, "v", 0, "Verbosity of the log. 1 also logs every poll of AWS and CDI")
+}
+
+// setup makes the logger set by the flags the default logger, and writes
+// what is logged through the standard log package with it.
+func (f *logFlags) setup() {
+	format, err := logging.ParseFormat(f.format)
+	if err != nil {
+		log.Fatalf("invalid --log-format: %v", err)
+	}
+	logger := logging.New(os.Stderr, format, f.verbosity)
+	logging.SetDefault(logger)
+	logging.RedirectStdLog(logger)
+}
+
+// importLogger returns the logger the clients of the import described by
+// opts log to.
+func importLogger(opts importer.Options) logr.Logger {
+	return logging.Default().WithValues(logging.KeyPvc, opts.PvcName, logging.KeyNamespace, opts.PvcNamespace)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+	"kubevirt.io/kubevirt-cloud-import/pkg/notify"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+)
+
+// notifyFlags are the options posting the result of imports to a webhook.
+type notifyFlags struct {
+	url          string
+	format       string
+	templateFile string
+	secretFile   string
+}
+
+// addNotifyFlags registers the notification options on fs.
+func addNotifyFlags(fs *flag.FlagSet, f *notifyFlags) {
+	fs.StringVar(&f.url, "notify-url", "", "Webhook the result of every import is posted to once it succeeds or fails")
+	fs.StringVar(&f.format, "notify-format", notify.FormatGeneric, "Payload posted to --notify-url (generic, slack, teams). generic posts the json result document, slack and teams a message for their incoming webhooks")
+	fs.StringVar(&f.templateFile, "notify-template", "", "File holding a Go template of the payload posted to --notify-url, executed against the json result document, in place of --notify-format")
+	fs.StringVar(&f.secretFile, "notify-secret-file", "", "File holding a key the payloads posted to --notify-url are signed with, as the HMAC-SHA256 of the body in the "+notify.SignatureHeader+" header")
+}
+
+func (f *notifyFlags) validate() error {
+	if f.url == "" && (f.templateFile != "" || f.secretFile != "") {
+		return fmt.Errorf("--notify-template and --notify-secret-file require --notify-url")
+	}
+	_, err := notify.ParseFormat(f.format)
+	if err != nil {
+		return fmt.Errorf("invalid --notify-format: %v", err)
+	}
+	return nil
+}
+
+// notifier returns the notifier posting to --notify-url with policy, or nil
+// when it is unset. A nil notifier posts nothing.
+func (f *notifyFlags) notifier(policy retry.Policy) (*notify.Notifier, error) {
+	if f.url == "" {
+		return nil, nil
+	}
+
+	opts := notify.Options{Url: f.url, Format: f.format, Retry: policy}
+	if f.templateFile != "" {
+		text, err := ioutil.ReadFile(f.templateFile)
+		if err != nil {
+			return nil, fmt.Errorf("err encountered reading notification template %s: %v", f.templateFile, err)
+		}
+		opts.Template = string(text)
+	}
+	if f.secretFile != "" {
+		secret, err := ioutil.ReadFile(f.secretFile)
+		if err != nil {
+			return nil, fmt.Errorf("err encountered reading notification secret %s: %v", f.secretFile, err)
+		}
+		// files written by editors and mounted from secrets often end in a
+		// newline that is not part of the key
+		opts.Secret = bytes.TrimSpace(secret)
+	}
+	return notify.New(opts)
+}
+
+// sendNotification posts result with notifier. A failed notification is
+// logged, it does not fail the import.
+func sendNotification(notifier *notify.Notifier, result *importer.Result) {
+	if err := notifier.Notify(result); err != nil {
+		logging.Default().Error(err, "Error encountered sending notification", logging.KeyPvc, result.PvcName, logging.KeyNamespace, result.PvcNamespace)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/notify"
+)
+
+// The formats of --output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+func validateOutput(output string) error {
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("--output must be one of %s, %s", outputText, outputJSON)
+	}
+	return nil
+}
+
+// printJSON writes v to w as an indented json document.
+func printJSON(w io.Writer, v interface{}) error {
+	doc, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", doc)
+	return err
+}
+
+// resultPrinter ends an import in the --output format. With json the
+// outcome, successful or not, is written to stdout as a result document
+// while logs keep going to stderr.
+type resultPrinter struct {
+	output string
+	opts   *importer.Options
+	imp    *importer.Importer
+	// notifier, when set, is sent the result of failures too.
+	notifier *notify.Notifier
+}
+
+// fatal ends the import with err. Failures before the importer is created
+// are reported with code, the code of err is used otherwise.
+func (p *resultPrinter) fatal(code string, err error, format string, args ...interface{}) {
+	if p.output != outputJSON && p.notifier == nil {
+		log.Fatalf(format, args...)
+	}
+
+	var result *importer.Result
+	if p.imp != nil {
+		result = p.imp.Result(err)
+	} else {
+		result = importer.NewFailedResult(*p.opts, err)
+		if code != "" {
+			result.ErrorCode = code
+		}
+	}
+	log.Printf(format, args...)
+	sendNotification(p.notifier, result)
+	if p.output != outputJSON {
+		os.Exit(1)
+	}
+	if err := printJSON(os.Stdout, result); err != nil {
+		log.Printf("Error encountered printing result: %v", err)
+	}
+	os.Exit(1)
+}
+
+// succeeded prints the result of a completed import.
+func (p *resultPrinter) succeeded(result *importer.Result) {
+	if p.output != outputJSON {
+		return
+	}
+	if err := printJSON(os.Stdout, result); err != nil {
+		log.Fatalf("Error encountered printing result: %v", err)
+	}
+}
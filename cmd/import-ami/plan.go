@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"sigs.k8s.io/yaml"
+)
+
+// printPlan writes the actions of plan followed by the manifest of the
+// DataVolume it would create.
+func printPlan(w io.Writer, plan *importer.Plan) error {
+	source := plan.SourceAmiId
+	if plan.SnapshotId != "" {
+		source = plan.SnapshotId
+	}
+	fmt.Fprintf(w, "# Plan for the import of %s in account %s\n", source, plan.AccountId)
+	if plan.ResumeStep != "" {
+		fmt.Fprintf(w, "# A saved state resumes the import at step %s\n", plan.ResumeStep)
+	}
+	for idx, action := range plan.Actions {
+		fmt.Fprintf(w, "# %d. %s\n", idx+1, action)
+	}
+	for _, blocker := range plan.Blockers {
+		fmt.Fprintf(w, "# BLOCKER: %s\n", blocker)
+	}
+
+	dvYaml, err := yaml.Marshal(plan.DataVolume)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "---\n%s", dvYaml)
+	return nil
+}
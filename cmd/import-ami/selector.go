@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+)
+
+// filterFlag collects repeated --filter flags into the filters of an image
+// selector.
+type filterFlag struct {
+	filters map[string][]string
+	values  []string
+}
+
+func (f *filterFlag) String() string {
+	return strings.Join(f.values, " ")
+}
+
+func (f *filterFlag) Set(value string) error {
+	if err := aws.ParseImageFilter(value, f.filters); err != nil {
+		return err
+	}
+	f.values = append(f.values, value)
+	return nil
+}
+
+// ownersFlag parses a comma separated list of image owners.
+type ownersFlag struct {
+	owners *[]string
+}
+
+func (f *ownersFlag) String() string {
+	if f.owners == nil {
+		return ""
+	}
+	return strings.Join(*f.owners, ",")
+}
+
+func (f *ownersFlag) Set(value string) error {
+	for _, owner := range strings.Split(value, ",") {
+		if owner != "" {
+			*f.owners = append(*f.owners, owner)
+		}
+	}
+	return nil
+}
+
+// addImageSelectorFlags registers the options choosing an AMI by name,
+// owner, filters or SSM parameter on fs.
+func addImageSelectorFlags(fs *flag.FlagSet, selector *aws.ImageSelector) {
+	selector.Filters = map[string][]string{}
+	fs.StringVar(&selector.Name, "ami-name", "", "Name of the ami to import, with * and ? wildcards. The newest matching ami is imported")
+	fs.Var(&ownersFlag{owners: &selector.Owners}, "owner", "Comma separated account ids, or self, amazon or aws-marketplace, owning the ami to import")
+	fs.Var(&filterFlag{filters: selector.Filters}, "filter", "DescribeImages filter the ami to import must match, as name=value1,value2. May be repeated")
+	fs.StringVar(&selector.SSMParameter, "ssm-parameter", "", "SSM parameter holding the id of the ami to import, such as /aws/service/ami-amazon-linux-latest/amzn2-ami-hvm-x86_64-gp2")
+}
+
+func validateImageSelector(selector *aws.ImageSelector) error {
+	if selector.SSMParameter != "" && (selector.Name != "" || len(selector.Owners) != 0 || len(selector.Filters) != 0) {
+		return fmt.Errorf("--ssm-parameter is mutually exclusive with --ami-name, --owner and --filter")
+	} else if (selector.Name != "" || len(selector.Filters) != 0) && len(selector.Owners) == 0 {
+		// anyone can publish a public ami under any name
+		return fmt.Errorf("--owner is required with --ami-name and --filter")
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+)
+
+func TestValidateImageSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector aws.ImageSelector
+		wantErr  bool
+	}{
+		{name: "name and owner", selector: aws.ImageSelector{Name: "fedora-*", Owners: []string{"amazon"}}},
+		{name: "filter and owner", selector: aws.ImageSelector{Owners: []string{"self"}, Filters: map[string][]string{"architecture": {"x86_64"}}}},
+		{name: "ssm parameter", selector: aws.ImageSelector{SSMParameter: "/aws/service/ami"}},
+		{name: "name without owner", selector: aws.ImageSelector{Name: "fedora-*"}, wantErr: true},
+		{name: "filter without owner", selector: aws.ImageSelector{Filters: map[string][]string{"tag:Environment": {"prod"}}}, wantErr: true},
+		{name: "ssm parameter and owner", selector: aws.ImageSelector{SSMParameter: "/aws/service/ami", Owners: []string{"amazon"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := validateImageSelector(&tt.selector)
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: validateImageSelector() succeeded, want an error", tt.name)
+		} else if !tt.wantErr && err != nil {
+			t.Errorf("%s: validateImageSelector() returned error: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	DefaultS3SecretName = "s3-readonly-cred"
+)
+
+// runSetup provisions, or validates, the prerequisites of an AMI import: the
+// vmimport service role, the export bucket and its policy, and the secret CDI
+// uses to read from the bucket.
+func runSetup(args []string) {
+	var region string
+	var s3Bucket string
+	var roleName string
+	var kmsKeyId string
+	var accountId string
+	var awsCreds aws.Credentials
+	var awsCredentialsSecret string
+
+	var kubeconfig string
+	var master string
+	var secretName string
+	var secretNamespace string
+	var s3AccessKeyId string
+	var s3SecretKey string
+
+	var printOnly bool
+	var logOpts logFlags
+
+	fs := flag.NewFlagSet("setup", flag.ExitOnError)
+	fs.StringVar(&region, "region", "", "The AWS region the bucket is created in")
+	fs.StringVar(&s3Bucket, "s3-bucket", "", "The s3 bucket AMIs are exported to")
+	fs.StringVar(&roleName, "role-name", aws.VMImportRoleName, "Name of the VM Import/Export service role")
+	fs.StringVar(&kmsKeyId, "kms-key-id", "", "ARN of a KMS key the service role must be able to use for encrypted AMIs")
+	fs.StringVar(&accountId, "account-id", "", "AWS account id used in the emitted policies with --print-only. Detected from the credentials otherwise")
+	addAWSCredentialFlags(fs, &awsCreds, &awsCredentialsSecret)
+
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
+	fs.StringVar(&master, "master", "", "k8s master url")
+	fs.StringVar(&secretName, "s3-secret", DefaultS3SecretName, "Name of the k8s secret CDI reads the s3 bucket with")
+	fs.StringVar(&secretNamespace, "namespace", "default", "Namespace of the k8s secret, which must match the namespace of the imported pvcs")
+	fs.StringVar(&s3AccessKeyId, "s3-access-key-id", "", "Access key id stored in the k8s secret. The secret is only validated when unset")
+	fs.StringVar(&s3SecretKey, "s3-secret-key", "", "Secret access key stored in the k8s secret")
+
+	fs.BoolVar(&printOnly, "print-only", false, "Print the IAM policies and k8s secret instead of creating them")
+
+	addLogFlags(fs, &logOpts)
+
+	fs.Parse(args)
+	logOpts.setup()
+	if s3Bucket == "" {
+		log.Fatalf("--s3-bucket is required")
+	} else if (s3AccessKeyId == "") != (s3SecretKey == "") {
+		log.Fatalf("--s3-access-key-id and --s3-secret-key must be set together")
+	}
+
+	if printOnly {
+		if accountId == "" {
+			accountId = "<ACCOUNT_ID>"
+		}
+		secret := cdi.NewS3CredentialSecret(secretName, secretNamespace, s3AccessKeyId, s3SecretKey, "")
+		secretYaml, err := yaml.Marshal(secret)
+		if err != nil {
+			log.Fatalf("err encountered rendering secret: %v", err)
+		}
+
+		fmt.Printf("# IAM role %s trust policy\n%s\n\n", roleName, aws.VMImportTrustPolicy())
+		fmt.Printf("# IAM role %s permission policy\n%s\n\n", roleName, aws.VMImportRolePolicy(s3Bucket, kmsKeyId))
+		fmt.Printf("# s3 bucket %s policy\n%s\n\n", s3Bucket, aws.VMImportBucketPolicy(s3Bucket, aws.VMImportRoleArn(accountId, roleName)))
+		fmt.Printf("# k8s secret %s/%s\n---\n%s", secretNamespace, secretName, secretYaml)
+		return
+	}
+
+	cdiCli, err := cdi.NewClient(master, kubeconfig)
+	if err != nil {
+		log.Fatalf("err encountered creation of cdi client: %v", err)
+	}
+
+	if awsCredentialsSecret != "" {
+		err = loadAWSCredentialsSecret(awsCredentialsSecret, cdiCli, &awsCreds)
+		if err != nil {
+			log.Fatalf("err encountered loading aws credentials from secret %s: %v", awsCredentialsSecret, err)
+		}
+	}
+
+	awsCli, err := aws.NewClient(region, awsCreds)
+	if err != nil {
+		log.Fatalf("err encountered creation of aws client: %v", err)
+	}
+
+	role, created, err := awsCli.EnsureVMImportRole(roleName, s3Bucket, kmsKeyId)
+	if err != nil {
+		log.Fatalf("Error encountered setting up role %s: %v", roleName, err)
+	} else if created {
+		log.Printf("Created role %s", role.Arn)
+	} else {
+		log.Printf("Validated role %s", role.Arn)
+	}
+
+	created, err = awsCli.EnsureBucket(s3Bucket)
+	if err != nil {
+		log.Fatalf("Error encountered setting up bucket %s: %v", s3Bucket, err)
+	} else if created {
+		log.Printf("Created s3 bucket %s", s3Bucket)
+	} else {
+		log.Printf("Found s3 bucket %s", s3Bucket)
+	}
+
+	updated, err := awsCli.EnsureBucketPolicy(s3Bucket, role.Arn)
+	if err != nil {
+		log.Fatalf("Error encountered setting up policy of bucket %s: %v", s3Bucket, err)
+	} else if updated {
+		log.Printf("Granted role %s access to s3 bucket %s", role.Arn, s3Bucket)
+	} else {
+		log.Printf("Validated policy of s3 bucket %s", s3Bucket)
+	}
+
+	if s3AccessKeyId != "" {
+		created, err = cdiCli.CreateOrUpdateSecret(cdi.NewS3CredentialSecret(secretName, secretNamespace, s3AccessKeyId, s3SecretKey, ""))
+		if err != nil {
+			log.Fatalf("Error encountered setting up secret %s/%s: %v", secretNamespace, secretName, err)
+		} else if created {
+			log.Printf("Created secret %s/%s", secretNamespace, secretName)
+		} else {
+			log.Printf("Updated secret %s/%s", secretNamespace, secretName)
+		}
+	} else {
+		secret, err := cdiCli.GetSecret(secretName, secretNamespace)
+		if err != nil {
+			log.Fatalf("Error encountered validating secret %s/%s, pass --s3-access-key-id and --s3-secret-key to create it: %v", secretNamespace, secretName, err)
+		}
+		for _, key := range []string{cdi.S3SecretAccessKeyIdKey, cdi.S3SecretKeyKey} {
+			if len(secret.Data[key]) == 0 {
+				log.Fatalf("Secret %s/%s is missing key %s", secretNamespace, secretName, key)
+			}
+		}
+		log.Printf("Validated secret %s/%s", secretNamespace, secretName)
+	}
+
+	log.Printf("Setup complete")
+}
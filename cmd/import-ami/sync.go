@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	sdkaws "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+)
+
+const (
+	DefaultSyncKeep = 3
+
+	// SyncLabel marks the pvcs imported by a sync with the sync's name.
+	SyncLabel = "cloud-import.kubevirt.io/sync"
+
+	AnnSourceAmiId           = "cloud-import.kubevirt.io/source-ami-id"
+	AnnSourceAmiName         = "cloud-import.kubevirt.io/source-ami-name"
+	AnnSourceAmiCreationDate = "cloud-import.kubevirt.io/source-ami-creation-date"
+
+	syncVersionFormat = "20060102150405"
+	// a pvc name is a DNS label, leaving room for the version suffix
+	maxSyncNameLength = 63 - len(syncVersionFormat) - 1
+)
+
+// syncPvcName names the pvc of a version of a synced image after the
+// creation date of its AMI, so that versions sort by age.
+func syncPvcName(name string, image *types.Image) (string, error) {
+	creationTime, err := aws.ImageCreationTime(image)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s", name, creationTime.UTC().Format(syncVersionFormat)), nil
+}
+
+// runSync imports the newest AMI matching a name pattern when it has not
+// been imported yet and removes all but the most recent versions. It is
+// meant to run periodically, such as from a CronJob.
+func runSync(args []string) {
+	var importOpts importFlags
+	var owners string
+	var namePattern string
+	var name string
+	var keep int
+
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	addImportFlags(fs, &importOpts)
+	fs.StringVar(&owners, "owner", "", "Comma separated AWS account ids or aliases (amazon, aws-marketplace) owning the tracked AMIs")
+	fs.StringVar(&namePattern, "name-pattern", "", "Name of the tracked AMIs, with * and ? wildcards. The newest matching AMI by creation date is imported")
+	fs.StringVar(&name, "name", "", "Name of the sync. Versions are imported into pvcs named <name>-<creation date of the AMI>")
+	fs.IntVar(&keep, "keep", DefaultSyncKeep, "Number of most recent versions kept, older versions are deleted")
+
+	fs.Parse(args)
+	importOpts.log.setup()
+	if owners == "" {
+		log.Fatalf("--owner is required")
+	} else if namePattern == "" {
+		log.Fatalf("--name-pattern is required")
+	} else if name == "" {
+		log.Fatalf("--name is required")
+	} else if len(name) > maxSyncNameLength {
+		log.Fatalf("--name must be at most %d characters", maxSyncNameLength)
+	} else if keep < 1 {
+		log.Fatalf("--keep must be at least 1")
+	}
+	if err := importOpts.validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	opts, err := importOpts.options()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	namespace := opts.PvcNamespace
+
+	cdiCli, err := cdi.NewClient(importOpts.master, importOpts.kubeconfig)
+	if err != nil {
+		log.Fatalf("err encountered creation of cdi client: %v", err)
+	}
+
+	newClients, err := importOpts.awsClients(cdiCli)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	awsCreds, err := importOpts.baseAWSCredentials(cdiCli)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	awsCli, err := aws.NewClient(importOpts.region, awsCreds)
+	if err != nil {
+		log.Fatalf("err encountered creation of aws client: %v", err)
+	}
+
+	image, err := awsCli.FindNewestImage(strings.Split(owners, ","), namePattern)
+	if err != nil {
+		log.Fatalf("Error encountered finding newest AMI named %s: %v", namePattern, err)
+	}
+	amiId := sdkaws.ToString(image.ImageId)
+	pvcName, err := syncPvcName(name, image)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	logging.Default().Info("Found newest AMI", "namePattern", namePattern, logging.KeyAmi, amiId, "name", sdkaws.ToString(image.Name), "created", sdkaws.ToString(image.CreationDate))
+
+	// the pvc, rather than its DataVolume, records the import since CDI
+	// may garbage collect the DataVolumes of completed imports
+	pvc, err := cdiCli.GetPvc(pvcName, namespace)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Fatalf("Error encountered looking up pvc %s/%s: %v", namespace, pvcName, err)
+	}
+
+	if err == nil && pvc.Labels[SyncLabel] == name {
+		logging.Default().Info("AMI is already imported into pvc", logging.KeyAmi, amiId, logging.KeyPvc, pvcName, logging.KeyNamespace, namespace)
+	} else {
+		opts.AmiId = amiId
+		opts.PvcName = pvcName
+		stateStore := importer.NewConfigMapStateStore(cdiCli, fmt.Sprintf(importer.StateConfigMapNameFormat, pvcName), namespace)
+
+		tracer, err := importOpts.trace.tracer()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		notifier, err := importOpts.notify.notifier(importOpts.retry)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		scope := tracer.NewScope()
+		opts.Trace = scope
+		logger := importLogger(opts)
+		clients := newClients(scope, logger)
+		clients.CDI = cdiCli.WithTraceScope(scope).WithLogger(logger)
+
+		logger = logger.WithValues(logging.KeyAmi, amiId)
+		logger.Info("Importing AMI into pvc")
+
+		imp := importer.New(opts, clients, stateStore)
+		imp.AddObserver(importer.NewEventRecorder(cdiCli, nil))
+		err = imp.Run()
+		importOpts.pushMetrics()
+		tracer.Shutdown()
+		sendNotification(notifier, imp.Result(err))
+		if err != nil {
+			log.Fatalf("Import of AMI [%s] into pvc [%s/%s] failed: %v", amiId, namespace, pvcName, err)
+		}
+		logger.Info("Imported AMI into pvc")
+	}
+
+	// versions are only labeled once imported, so that an unfinished
+	// import is neither counted as a kept version nor skipped by a rerun
+	err = cdiCli.LabelPvc(pvcName, namespace,
+		map[string]string{SyncLabel: name},
+		map[string]string{
+			AnnSourceAmiId:           amiId,
+			AnnSourceAmiName:         sdkaws.ToString(image.Name),
+			AnnSourceAmiCreationDate: sdkaws.ToString(image.CreationDate),
+		})
+	if err != nil {
+		log.Fatalf("Error encountered labeling pvc %s/%s: %v", namespace, pvcName, err)
+	}
+
+	err = pruneSyncVersions(cdiCli, name, namespace, keep, pvcName)
+	if err != nil {
+		log.Fatalf("Error encountered removing old versions of %s: %v", name, err)
+	}
+}
+
+type syncPvcClient interface {
+	ListPvcs(namespace string, selector string) ([]k8sv1.PersistentVolumeClaim, error)
+	DeleteDataVolume(name string, namespace string) error
+	DeletePvc(name string, namespace string) error
+}
+
+// pruneSyncVersions deletes the pvcs of all but the keep most recent
+// versions of a sync, along with their DataVolumes when CDI has not garbage
+// collected them. current is never deleted.
+func pruneSyncVersions(cdiCli syncPvcClient, name string, namespace string, keep int, current string) error {
+	pvcs, err := cdiCli.ListPvcs(namespace, fmt.Sprintf("%s=%s", SyncLabel, name))
+	if err != nil {
+		return err
+	}
+
+	// the version suffix of the names sorts by creation date of the AMI
+	sort.Slice(pvcs, func(i, j int) bool {
+		return pvcs[i].Name > pvcs[j].Name
+	})
+
+	kept := 0
+	for _, pvc := range pvcs {
+		if pvc.Name == current || kept < keep {
+			kept++
+			continue
+		}
+
+		logging.Default().Info("Deleting version of AMI", logging.KeyPvc, pvc.Name, logging.KeyNamespace, namespace, logging.KeyAmi, pvc.Annotations[AnnSourceAmiId])
+		// the DataVolume goes first, it would otherwise import the pvc again
+		if err := cdiCli.DeleteDataVolume(pvc.Name, namespace); err != nil {
+			return err
+		}
+		if err := cdiCli.DeletePvc(pvc.Name, namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeSyncPvcClient struct {
+	pvcs     []k8sv1.PersistentVolumeClaim
+	selector string
+	deleted  []string
+}
+
+func (c *fakeSyncPvcClient) ListPvcs(namespace string, selector string) ([]k8sv1.PersistentVolumeClaim, error) {
+	c.selector = selector
+	return c.pvcs, nil
+}
+
+func (c *fakeSyncPvcClient) DeleteDataVolume(name string, namespace string) error {
+	c.deleted = append(c.deleted, "datavolume/"+name)
+	return nil
+}
+
+func (c *fakeSyncPvcClient) DeletePvc(name string, namespace string) error {
+	c.deleted = append(c.deleted, "pvc/"+name)
+	return nil
+}
+
+func TestPruneSyncVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		pvcs    []string
+		keep    int
+		current string
+		want    []string
+	}{
+		{
+			name:    "nothing to prune",
+			pvcs:    []string{"fedora-20210101000000", "fedora-20210201000000"},
+			keep:    3,
+			current: "fedora-20210201000000",
+		},
+		{
+			name:    "oldest pruned regardless of listing order",
+			pvcs:    []string{"fedora-20210201000000", "fedora-20210401000000", "fedora-20210101000000", "fedora-20210301000000"},
+			keep:    2,
+			current: "fedora-20210401000000",
+			want: []string{
+				"datavolume/fedora-20210201000000", "pvc/fedora-20210201000000",
+				"datavolume/fedora-20210101000000", "pvc/fedora-20210101000000",
+			},
+		},
+		{
+			name:    "current kept when older than the kept versions",
+			pvcs:    []string{"fedora-20210101000000", "fedora-20210201000000", "fedora-20210301000000"},
+			keep:    1,
+			current: "fedora-20210101000000",
+			want:    []string{"datavolume/fedora-20210201000000", "pvc/fedora-20210201000000"},
+		},
+	}
+
+	for _, tt := range tests {
+		cli := &fakeSyncPvcClient{}
+		for _, name := range tt.pvcs {
+			cli.pvcs = append(cli.pvcs, k8sv1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		}
+
+		if err := pruneSyncVersions(cli, "fedora", "default", tt.keep, tt.current); err != nil {
+			t.Errorf("%s: pruneSyncVersions() returned error: %v", tt.name, err)
+			continue
+		}
+		if cli.selector != SyncLabel+"=fedora" {
+			t.Errorf("%s: pvcs listed with selector %q, want %q", tt.name, cli.selector, SyncLabel+"=fedora")
+		}
+		if !reflect.DeepEqual(cli.deleted, tt.want) {
+			t.Errorf("%s: deleted %v, want %v", tt.name, cli.deleted, tt.want)
+		}
+	}
+}
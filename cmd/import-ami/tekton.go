@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+)
+
+// tektonResultsDir is where Tekton collects the results of a task's steps.
+const tektonResultsDir = "/tekton/results"
+
+// The results of the import-ami task.
+const (
+	resultPvcName        = "pvcName"
+	resultPvcNamespace   = "pvcNamespace"
+	resultExportedS3Path = "exportedS3Path"
+	resultCopiedAmiId    = "copiedAmiId"
+	resultArchitecture   = "architecture"
+	resultBootMode       = "bootMode"
+)
+
+// resultsDir returns the directory results are written to: dir when set, the
+// Tekton results directory when running in a Tekton step, and "" otherwise.
+func resultsDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	if info, err := os.Stat(tektonResultsDir); err == nil && info.IsDir() {
+		return tektonResultsDir
+	}
+	return ""
+}
+
+// writeTaskResults writes the outcome of an import to dir as one file per
+// task result. Every result is written, empty when it does not apply, so
+// that tasks consuming them can always be resolved.
+func writeTaskResults(dir string, result *importer.Result) error {
+	exportedS3Path := ""
+	if result.S3Key != "" {
+		exportedS3Path = fmt.Sprintf("s3://%s/%s", result.S3Bucket, result.S3Key)
+	}
+
+	for name, value := range map[string]string{
+		resultPvcName:        result.PvcName,
+		resultPvcNamespace:   result.PvcNamespace,
+		resultExportedS3Path: exportedS3Path,
+		resultCopiedAmiId:    result.CopiedAmiId,
+		resultArchitecture:   result.Architecture,
+		resultBootMode:       result.BootMode,
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+		if err != nil {
+			return fmt.Errorf("unable to write result %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/tracing"
+)
+
+// traceFlags are the options exporting traces of imports.
+type traceFlags struct {
+	endpoint string
+	file     string
+	headers  map[string]string
+}
+
+// headersFlag parses comma separated key=value headers.
+type headersFlag struct {
+	headers map[string]string
+}
+
+func (f *headersFlag) String() string {
+	var pairs []string
+	for key, value := range f.headers {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f *headersFlag) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		if pair == "" {
+			continue
+		}
+		idx := strings.Index(pair, "=")
+		if idx <= 0 {
+			return fmt.Errorf("header %q is not of the form key=value", pair)
+		}
+		f.headers[strings.TrimSpace(pair[:idx])] = strings.TrimSpace(pair[idx+1:])
+	}
+	return nil
+}
+
+// addTraceFlags registers the options exporting traces on fs.
+func addTraceFlags(fs *flag.FlagSet, f *traceFlags) {
+	f.headers = map[string]string{}
+	fs.StringVar(&f.endpoint, "trace-endpoint", "", "OTLP/HTTP endpoint, such as http://otel-collector.monitoring:4318, the trace of every import is exported to. Each import, its steps and the AWS and Kubernetes calls they make appear as one trace")
+	fs.StringVar(&f.file, "trace-file", "", "Local file the trace of every import is appended to as JSON, one span per line. Mutually exclusive with --trace-endpoint")
+	fs.Var(&headersFlag{headers: f.headers}, "trace-headers", "Comma separated key=value headers added to the requests to --trace-endpoint, such as authorization tokens")
+}
+
+func (f *traceFlags) validate() error {
+	if f.endpoint != "" && f.file != "" {
+		return fmt.Errorf("--trace-endpoint and --trace-file are mutually exclusive")
+	}
+	return nil
+}
+
+// tracer returns the tracer exporting to --trace-endpoint or --trace-file,
+// or nil when tracing is disabled. A nil tracer records nothing.
+func (f *traceFlags) tracer() (*tracing.Tracer, error) {
+	switch {
+	case f.endpoint != "":
+		exporter, err := tracing.NewOTLPExporter(f.endpoint, f.headers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --trace-endpoint: %v", err)
+		}
+		return tracing.NewTracer(exporter), nil
+	case f.file != "":
+		exporter, err := tracing.NewFileExporter(f.file)
+		if err != nil {
+			return nil, fmt.Errorf("err encountered opening trace file %s: %v", f.file, err)
+		}
+		return tracing.NewTracer(exporter), nil
+	}
+	return nil, nil
+}
+
+// scopedClients returns the clients of an import recording their calls into
+// the trace scope given and logging to the logger given.
+type scopedClients func(scope *tracing.Scope, log logr.Logger) importer.Clients
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/disk"
+)
+
+const (
+	terminationMessagePath = "/dev/termination-log"
+)
+
+// runVerifyDisk runs inside the verification job. It hashes the imported
+// disk and reports the result as the container's termination message.
+func runVerifyDisk(args []string) {
+	var path string
+	var virtualSize int64
+	var sha256 string
+	var logOpts logFlags
+
+	fs := flag.NewFlagSet("verify-disk", flag.ExitOnError)
+	fs.StringVar(&path, "path", "", "Path of the imported disk image or block device")
+	fs.Int64Var(&virtualSize, "virtual-size", 0, "Virtual size in bytes of the source disk")
+	fs.StringVar(&sha256, "sha256", "", "sha256 of the source disk's raw content")
+
+	addLogFlags(fs, &logOpts)
+
+	fs.Parse(args)
+	logOpts.setup()
+	if path == "" || virtualSize <= 0 || sha256 == "" {
+		log.Fatalf("--path, --virtual-size and --sha256 are required")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("err encountered opening disk %s: %v", path, err)
+	}
+	defer file.Close()
+
+	result, err := disk.Verify(file, virtualSize, sha256)
+	if err != nil {
+		log.Fatalf("err encountered reading disk %s: %v", path, err)
+	}
+
+	out, err := json.Marshal(result)
+	if err != nil {
+		log.Fatalf("err encountered encoding result: %v", err)
+	}
+	fmt.Println(string(out))
+	if err := ioutil.WriteFile(terminationMessagePath, out, 0644); err != nil {
+		log.Printf("Unable to write termination message: %v", err)
+	}
+
+	if !result.Passed {
+		log.Printf("Verification of disk %s failed: %s", path, result.Reason)
+		os.Exit(1)
+	}
+}
@@ -3,14 +3,29 @@ module kubevirt.io/kubevirt-cloud-import
 go 1.15
 
 require (
+	github.com/aws/aws-sdk-go-v2 v1.8.1
 	github.com/aws/aws-sdk-go-v2/config v1.6.1
+	github.com/aws/aws-sdk-go-v2/credentials v1.3.3
 	github.com/aws/aws-sdk-go-v2/service/ec2 v1.14.0
+	github.com/aws/aws-sdk-go-v2/service/iam v1.8.1
+	github.com/aws/aws-sdk-go-v2/service/kms v1.4.3
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.13.0
+	github.com/aws/aws-sdk-go-v2/service/ssm v1.9.0
 	github.com/aws/aws-sdk-go-v2/service/sts v1.6.2
+	github.com/aws/smithy-go v1.7.0
+	github.com/go-logr/logr v0.4.0
+	github.com/prometheus/client_golang v1.11.0
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+	k8s.io/api v0.22.1
 	k8s.io/apimachinery v0.22.1
 	k8s.io/client-go v12.0.0+incompatible
 	kubevirt.io/client-go v0.44.1
 	kubevirt.io/containerized-data-importer v1.38.0
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace (
@@ -52,3 +67,5 @@ replace (
 replace github.com/googleapis/gnostic => github.com/googleapis/gnostic v0.5.5 // indirect
 
 exclude k8s.io/cluster-bootstrap v0.0.0
+
+replace bitbucket.org/ww/goautoneg => github.com/munnerz/goautoneg v0.0.0-20120707110453-a547fc61f48d
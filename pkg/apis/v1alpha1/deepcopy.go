@@ -0,0 +1,109 @@
+package v1alpha1
+
+import (
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func (in *AMIImport) DeepCopyInto(out *AMIImport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *AMIImport) DeepCopy() *AMIImport {
+	if in == nil {
+		return nil
+	}
+	out := new(AMIImport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *AMIImport) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *AMIImportList) DeepCopyInto(out *AMIImportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]AMIImport, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *AMIImportList) DeepCopy() *AMIImportList {
+	if in == nil {
+		return nil
+	}
+	out := new(AMIImportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *AMIImportList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *AMIImportSpec) DeepCopyInto(out *AMIImportSpec) {
+	*out = *in
+	if in.CredentialsSecretRef != nil {
+		out.CredentialsSecretRef = new(k8sv1.LocalObjectReference)
+		*out.CredentialsSecretRef = *in.CredentialsSecretRef
+	}
+	if in.S3SecretRef != nil {
+		out.S3SecretRef = new(k8sv1.LocalObjectReference)
+		*out.S3SecretRef = *in.S3SecretRef
+	}
+	out.Pvc = in.Pvc
+	out.Pvc.Size = in.Pvc.Size.DeepCopy()
+	if in.Convert != nil {
+		out.Convert = new(ConvertSpec)
+		in.Convert.DeepCopyInto(out.Convert)
+	}
+	if in.Notify != nil {
+		out.Notify = new(NotifySpec)
+		in.Notify.DeepCopyInto(out.Notify)
+	}
+}
+
+func (in *ConvertSpec) DeepCopyInto(out *ConvertSpec) {
+	*out = *in
+	if in.ResetNetworkNaming != nil {
+		out.ResetNetworkNaming = new(bool)
+		*out.ResetNetworkNaming = *in.ResetNetworkNaming
+	}
+}
+
+func (in *NotifySpec) DeepCopyInto(out *NotifySpec) {
+	*out = *in
+	if in.SecretRef != nil {
+		out.SecretRef = new(k8sv1.LocalObjectReference)
+		*out.SecretRef = *in.SecretRef
+	}
+}
+
+func (in *AMIImportStatus) DeepCopyInto(out *AMIImportStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		out.Conditions = make([]AMIImportCondition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+	if in.DataVolumeRef != nil {
+		out.DataVolumeRef = new(k8sv1.LocalObjectReference)
+		*out.DataVolumeRef = *in.DataVolumeRef
+	}
+}
+
+func (in *AMIImportCondition) DeepCopyInto(out *AMIImportCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
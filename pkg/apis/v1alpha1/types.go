@@ -0,0 +1,148 @@
+package v1alpha1
+
+import (
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// AMIImportFinalizer holds an AMIImport until the resources its import
+	// created in AWS are removed.
+	AMIImportFinalizer = "cloud-import.kubevirt.io/cleanup"
+)
+
+// AMIImport imports an AMI into a pvc in the namespace of the AMIImport.
+type AMIImport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AMIImportSpec   `json:"spec"`
+	Status AMIImportStatus `json:"status,omitempty"`
+}
+
+// AMIImportList is a list of AMIImports.
+type AMIImportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []AMIImport `json:"items"`
+}
+
+type AMIImportSpec struct {
+	// Region is the AWS region the AMI resides in.
+	Region string `json:"region"`
+	// AmiId is the ID of the AMI to import.
+	AmiId string `json:"amiId"`
+	// S3Bucket is the bucket the AMI is exported to.
+	S3Bucket string `json:"s3Bucket"`
+	// ExportFormat is the disk format of the export: vmdk, vhd or raw.
+	// Defaults to vmdk.
+	ExportFormat string `json:"exportFormat,omitempty"`
+	// KmsKeyId is a KMS key to encrypt copies of encrypted AMIs with.
+	KmsKeyId string `json:"kmsKeyId,omitempty"`
+	// VMImportRoleName is the VM Import/Export service role the AMI is
+	// exported with. Defaults to vmimport.
+	VMImportRoleName string `json:"vmImportRoleName,omitempty"`
+
+	// CredentialsSecretRef names a secret holding the AWS credentials used
+	// for the import under accessKeyId, secretKey and an optional
+	// sessionToken. It is required, the controller has no AWS identity of
+	// its own.
+	CredentialsSecretRef *k8sv1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+	// RoleArn is an IAM role assumed with the credentials.
+	RoleArn string `json:"roleArn,omitempty"`
+
+	// S3SecretRef names the secret CDI reads the export with.
+	S3SecretRef *k8sv1.LocalObjectReference `json:"s3SecretRef,omitempty"`
+	// S3ReaderRoleArn is an IAM role able to read the bucket. When set,
+	// credentials scoped to the export are minted from it instead of using
+	// S3SecretRef.
+	S3ReaderRoleArn string `json:"s3ReaderRoleArn,omitempty"`
+
+	// Pvc describes the pvc the AMI is imported into.
+	Pvc PvcTemplate `json:"pvc"`
+
+	// Verify compares the imported pvc against the export.
+	Verify bool `json:"verify,omitempty"`
+	// Convert converts the guest of the imported pvc for KubeVirt once it
+	// is imported and verified.
+	Convert *ConvertSpec `json:"convert,omitempty"`
+
+	// Notify posts the result of the import to a webhook once it succeeds
+	// or fails, in place of the controller's notification settings. The webhook
+	// must be on a host the controller allows.
+	Notify *NotifySpec `json:"notify,omitempty"`
+}
+
+type ConvertSpec struct {
+	// Tool is virt-customize or virt-v2v-in-place. Defaults to
+	// virt-customize.
+	Tool string `json:"tool,omitempty"`
+	// Image runs the conversion Job. It must provide libguestfs and Tool.
+	Image string `json:"image,omitempty"`
+	// RemoveCloudAgents uninstalls agents that only work on EC2.
+	RemoveCloudAgents bool `json:"removeCloudAgents,omitempty"`
+	// ResetNetworkNaming removes network configuration tied to the MAC
+	// address of the EC2 instance. Defaults to true.
+	ResetNetworkNaming *bool `json:"resetNetworkNaming,omitempty"`
+}
+
+type NotifySpec struct {
+	// Url is the webhook the result is posted to. The url key of SecretRef
+	// takes precedence, for webhooks whose url is their credential.
+	Url string `json:"url,omitempty"`
+	// Format is the payload posted: generic, slack or teams. Defaults to
+	// generic, the result document of the import.
+	Format string `json:"format,omitempty"`
+	// SecretRef names a secret holding an optional url and an optional
+	// hmacKey the payload is signed with.
+	SecretRef *k8sv1.LocalObjectReference `json:"secretRef,omitempty"`
+}
+
+type PvcTemplate struct {
+	// Name defaults to the name of the AMIImport.
+	Name             string                           `json:"name,omitempty"`
+	StorageClassName string                           `json:"storageClassName,omitempty"`
+	AccessMode       k8sv1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+	Size             resource.Quantity                `json:"size"`
+}
+
+type AMIImportPhase string
+
+const (
+	AMIImportPending   AMIImportPhase = "Pending"
+	AMIImportRunning   AMIImportPhase = "Running"
+	AMIImportSucceeded AMIImportPhase = "Succeeded"
+	AMIImportFailed    AMIImportPhase = "Failed"
+	AMIImportDeleting  AMIImportPhase = "Deleting"
+)
+
+type AMIImportStatus struct {
+	Phase AMIImportPhase `json:"phase,omitempty"`
+	// Conditions has one condition per step of the import, with the step
+	// name as its type.
+	Conditions []AMIImportCondition `json:"conditions,omitempty"`
+
+	// CopiedAmiId is the copy of the AMI made in the importing account.
+	CopiedAmiId string `json:"copiedAmiId,omitempty"`
+	// ExportTaskId is the export image task of the AMI.
+	ExportTaskId string `json:"exportTaskId,omitempty"`
+	// ExportLocation is the s3 URL of the export.
+	ExportLocation string `json:"exportLocation,omitempty"`
+	// DataVolumeRef is the DataVolume importing the export.
+	DataVolumeRef *k8sv1.LocalObjectReference `json:"dataVolumeRef,omitempty"`
+	// Progress is the progress of the DataVolume import.
+	Progress string `json:"progress,omitempty"`
+
+	// State is the saved progress of the import the controller resumes from.
+	State string `json:"state,omitempty"`
+}
+
+type AMIImportCondition struct {
+	Type               string                `json:"type"`
+	Status             k8sv1.ConditionStatus `json:"status"`
+	Reason             string                `json:"reason,omitempty"`
+	Message            string                `json:"message,omitempty"`
+	LastTransitionTime metav1.Time           `json:"lastTransitionTime,omitempty"`
+}
@@ -2,62 +2,213 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
+	sdkaws "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/go-logr/logr"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+	"kubevirt.io/kubevirt-cloud-import/pkg/tracing"
 )
 
 type client struct {
+	cfg       sdkaws.Config
 	ec2Client *ec2.Client
 	stsClient *sts.Client
 	s3Client  *s3.Client
+	iamClient *iam.Client
+	kmsClient *kms.Client
+	ssmClient *ssm.Client
 	region    string
+	// scope, when set, records the client's calls as spans.
+	scope *tracing.Scope
+	log   logr.Logger
 }
 
 const (
 	ExportImageFormatTypeKey = "image-format"
 	OrigAmiTagKey            = "original-ami"
+
+	ExportImageFormatVmdk = "vmdk"
+	ExportImageFormatVhd  = "vhd"
+	ExportImageFormatRaw  = "raw"
 )
 
-func NewClient(region string) (*client, error) {
+// ParseExportImageFormat validates a disk format accepted by ExportImage and
+// returns it in the lower case form used for export tags and S3 file paths.
+func ParseExportImageFormat(imageFormat string) (string, error) {
+	format := strings.ToLower(imageFormat)
+	switch format {
+	case ExportImageFormatVmdk, ExportImageFormatVhd, ExportImageFormatRaw:
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported export image format %q, must be one of %s, %s or %s", imageFormat, ExportImageFormatVmdk, ExportImageFormatVhd, ExportImageFormatRaw)
+}
+
+// Credentials selects how the client authenticates against AWS. The zero
+// value uses the SDK's default credential chain, which already honours
+// AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN for IRSA style service accounts.
+type Credentials struct {
+	// Profile is a named profile from the shared config and credentials files.
+	Profile string
+	// RoleArn is an IAM role assumed on top of the base credentials.
+	RoleArn string
+	// ExternalId is passed along when assuming RoleArn.
+	ExternalId string
+	// RoleSessionName identifies the session when assuming RoleArn.
+	RoleSessionName string
+	// WebIdentityTokenFile is a file containing an OIDC token, such as a
+	// projected service account token, used to assume RoleArn with
+	// AssumeRoleWithWebIdentity instead of the base credentials.
+	WebIdentityTokenFile string
+	// AccessKeyId, SecretAccessKey and the optional SessionToken are static
+	// base credentials used in place of the default credential chain.
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	// SharedCredentialsFiles and SharedConfigFiles replace the default
+	// shared credentials and config files when set.
+	SharedCredentialsFiles []string
+	SharedConfigFiles      []string
+}
+
+const defaultRoleSessionName = "kubevirt-cloud-import"
+
+// ErrImageFailed is wrapped by errors for AMIs that reached a terminal
+// failed state, such as a copy that could not decrypt its source snapshots.
+var ErrImageFailed = errors.New("ami failed")
+
+// notFoundGrace is how long after a wait starts the AMI or export task it
+// waits on may still be reported missing. EC2 is eventually consistent, so
+// a resource created moments ago is not always visible yet.
+var notFoundGrace = 2 * time.Minute
+
+var notFoundCodes = map[string]bool{
+	"InvalidAMIID.NotFound":        true,
+	"InvalidExportTaskID.NotFound": true,
+}
+
+// isNotFound reports whether err is EC2 reporting an AMI or export task as
+// missing.
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && notFoundCodes[apiErr.ErrorCode()]
+}
+
+func NewClient(region string, creds Credentials) (*client, error) {
+
+	var loadOptions []func(*config.LoadOptions) error
+	if creds.Profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(creds.Profile))
+	}
+	if len(creds.SharedCredentialsFiles) != 0 {
+		loadOptions = append(loadOptions, config.WithSharedCredentialsFiles(creds.SharedCredentialsFiles))
+	}
+	if len(creds.SharedConfigFiles) != 0 {
+		loadOptions = append(loadOptions, config.WithSharedConfigFiles(creds.SharedConfigFiles))
+	}
+	if creds.AccessKeyId != "" {
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(creds.AccessKeyId, creds.SecretAccessKey, creds.SessionToken)))
+	}
 
 	// Load the SDK's configuration from environment and shared config, and
 	// create the ec2Client with this.
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfg, err := config.LoadDefaultConfig(context.TODO(), loadOptions...)
 	if err != nil {
 		return nil, err
 	}
+	cfg.APIOptions = append(cfg.APIOptions, addTraceMiddleware)
+	// transient errors are retried by the retry.Policy of the caller, retries
+	// of the SDK on top of it would multiply the attempts
+	cfg.Retryer = func() sdkaws.Retryer {
+		return sdkaws.NopRetryer{}
+	}
 
 	if region == "" {
 		region = cfg.Region
 	}
 
+	if creds.WebIdentityTokenFile != "" && creds.RoleArn == "" {
+		return nil, fmt.Errorf("a role arn is required to use web identity token file %s", creds.WebIdentityTokenFile)
+	}
+
+	if creds.RoleArn != "" {
+		roleSessionName := creds.RoleSessionName
+		if roleSessionName == "" {
+			roleSessionName = defaultRoleSessionName
+		}
+
+		// the role is assumed through the region the client operates in
+		baseStsClient := sts.NewFromConfig(cfg, func(o *sts.Options) {
+			if region != "" {
+				o.Region = region
+			}
+		})
+
+		var provider sdkaws.CredentialsProvider
+		if creds.WebIdentityTokenFile != "" {
+			provider = stscreds.NewWebIdentityRoleProvider(baseStsClient, creds.RoleArn, stscreds.IdentityTokenFile(creds.WebIdentityTokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = roleSessionName
+			})
+		} else {
+			provider = stscreds.NewAssumeRoleProvider(baseStsClient, creds.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+				o.RoleSessionName = roleSessionName
+				if creds.ExternalId != "" {
+					o.ExternalID = &creds.ExternalId
+				}
+			})
+		}
+		cfg.Credentials = sdkaws.NewCredentialsCache(provider)
+	}
+
 	ec2Client := ec2.NewFromConfig(cfg)
 	stsClient := sts.NewFromConfig(cfg)
 	s3Client := s3.NewFromConfig(cfg)
+	iamClient := iam.NewFromConfig(cfg)
+	kmsClient := kms.NewFromConfig(cfg)
+	ssmClient := ssm.NewFromConfig(cfg)
 
 	return &client{
+		cfg:       cfg,
 		ec2Client: ec2Client,
 		stsClient: stsClient,
 		s3Client:  s3Client,
+		iamClient: iamClient,
+		kmsClient: kmsClient,
+		ssmClient: ssmClient,
 		region:    region,
+		log:       logging.Default(),
 	}, nil
 }
 
+// WithLogger returns a copy of the client logging to log.
+func (c *client) WithLogger(log logr.Logger) *client {
+	logged := *c
+	logged.log = log
+	return &logged
+}
+
 func (c *client) FindGlobalImageById(amiId string) (*types.Image, error) {
 
 	params := &ec2.DescribeImagesInput{
 		ImageIds: []string{amiId},
 	}
 
-	amiListOutput, err := c.ec2Client.DescribeImages(context.Background(), params, func(o *ec2.Options) {
+	amiListOutput, err := c.ec2Client.DescribeImages(c.context(), params, func(o *ec2.Options) {
 		o.Region = c.region
 	})
 	if err != nil {
@@ -73,14 +224,17 @@ func (c *client) FindGlobalImageById(amiId string) (*types.Image, error) {
 	return &image, nil
 }
 
-func (c *client) ExportImage(amiId string, s3Bucket string, s3Prefix string, imageFormat string) (string, error) {
+// ExportImage starts exporting amiId into s3Bucket. roleName is the VM
+// Import/Export service role the export runs with, AWS uses vmimport when it
+// is empty.
+func (c *client) ExportImage(amiId string, s3Bucket string, s3Prefix string, imageFormat string, roleName string) (string, error) {
 
 	tagAmiKey := OrigAmiTagKey
 	tagImageFormatKey := ExportImageFormatTypeKey
 	tagImageFormatVal := imageFormat
 	description := fmt.Sprintf("Exporting ami %s for import into KubeVirt cluster", amiId)
 	params := &ec2.ExportImageInput{
-		DiskImageFormat: types.DiskImageFormat(imageFormat),
+		DiskImageFormat: types.DiskImageFormat(strings.ToUpper(imageFormat)),
 		ImageId:         &amiId,
 		S3ExportLocation: &types.ExportTaskS3LocationRequest{
 			S3Bucket: &s3Bucket,
@@ -103,8 +257,11 @@ func (c *client) ExportImage(amiId string, s3Bucket string, s3Prefix string, ima
 			},
 		},
 	}
+	if roleName != "" {
+		params.RoleName = &roleName
+	}
 
-	amiExportOutput, err := c.ec2Client.ExportImage(context.Background(), params, func(o *ec2.Options) {
+	amiExportOutput, err := c.ec2Client.ExportImage(c.context(), params, func(o *ec2.Options) {
 		o.Region = c.region
 	})
 
@@ -120,6 +277,26 @@ func (c *client) ExportImage(amiId string, s3Bucket string, s3Prefix string, ima
 }
 
 func (c *client) GetExportTaskStatus(exportTaskId string, amiId string, imageFormat string) (s3Bucket string, s3FilePath string, completed bool, exists bool, err error) {
+	status, err := c.getExportTaskStatus(exportTaskId, amiId, imageFormat)
+	return status.s3Bucket, status.s3FilePath, status.completed, status.exists, err
+}
+
+// ExportProgressFunc is called with the progress, in percent, and status
+// message of an export task while it runs.
+type ExportProgressFunc func(progress string, statusMessage string)
+
+// exportTaskStatus is the state of the export tasks of an ami. progress and
+// statusMessage are those of a task still running.
+type exportTaskStatus struct {
+	s3Bucket      string
+	s3FilePath    string
+	completed     bool
+	exists        bool
+	progress      string
+	statusMessage string
+}
+
+func (c *client) getExportTaskStatus(exportTaskId string, amiId string, imageFormat string) (status exportTaskStatus, err error) {
 
 	filterAmiName := fmt.Sprintf("tag:%s", OrigAmiTagKey)
 	filterAmiValues := []string{amiId}
@@ -143,106 +320,125 @@ func (c *client) GetExportTaskStatus(exportTaskId string, amiId string, imageFor
 		params.ExportImageTaskIds = []string{exportTaskId}
 	}
 
-	exportTaskOutput, err := c.ec2Client.DescribeExportImageTasks(context.Background(), params, func(o *ec2.Options) {
+	exportTaskOutput, err := c.ec2Client.DescribeExportImageTasks(c.context(), params, func(o *ec2.Options) {
 		o.Region = c.region
 	})
 	if err != nil {
-		return "", "", false, false, err
+		return status, err
 	}
 
 	if len(exportTaskOutput.ExportImageTasks) == 0 {
-		return "", "", false, false, nil
+		return status, nil
 	}
 
-	exists = true
+	status.exists = true
 	for _, task := range exportTaskOutput.ExportImageTasks {
+		if task.Status != nil && *task.Status == "active" {
+			status.progress = sdkaws.ToString(task.Progress)
+			status.statusMessage = sdkaws.ToString(task.StatusMessage)
+		}
 		if task.Status == nil || *task.Status != "completed" {
 			continue
 		}
 
-		s3Bucket = *task.S3ExportLocation.S3Bucket
-		s3FilePath = fmt.Sprintf("%s%s.%s", *task.S3ExportLocation.S3Prefix, *task.ExportImageTaskId, strings.ToLower(imageFormat))
-		completed = true
+		status.s3Bucket = *task.S3ExportLocation.S3Bucket
+		status.s3FilePath = fmt.Sprintf("%s%s.%s", *task.S3ExportLocation.S3Prefix, *task.ExportImageTaskId, strings.ToLower(imageFormat))
+		status.completed = true
 		break
 	}
 
-	return s3Bucket, s3FilePath, completed, exists, nil
+	return status, nil
 }
 
-func (c *client) WaitForExportImageCompletion(amiId string, taskId string, imageFormat string, timeout time.Duration) (s3Bucket string, s3FilePath string, err error) {
-	var completed bool
-	var exists bool
+// WaitForExportImageCompletion polls the export task taskId until it
+// completes. progress, when not nil, is called with the progress of the task
+// on every poll.
+func (c *client) WaitForExportImageCompletion(amiId string, taskId string, imageFormat string, timeout time.Duration, pollInterval time.Duration, progress ExportProgressFunc) (s3Bucket string, s3FilePath string, err error) {
 	ticker := time.NewTicker(timeout).C
-	pollTicker := time.NewTicker(time.Second * 15).C
-
-	log.Printf("Polling task id %s to determine if it is completed", taskId)
-	s3Bucket, s3FilePath, completed, _, _ = c.GetExportTaskStatus(taskId, amiId, imageFormat)
-	if completed {
-		return
+	pollTicker := time.NewTicker(pollInterval).C
+	start := time.Now()
+
+	log := c.log.WithValues(logging.KeyAmi, amiId, logging.KeyTaskId, taskId)
+	log.V(1).Info("Polling export task to determine if it is completed")
+	status, _ := c.getExportTaskStatus(taskId, amiId, imageFormat)
+	if status.completed {
+		return status.s3Bucket, status.s3FilePath, nil
+	} else if progress != nil && status.exists {
+		progress(status.progress, status.statusMessage)
 	}
 
 	// if not available, poll until available or timeout is hit
 	for {
 		select {
 		case <-ticker:
-			return "", "", fmt.Errorf("timed out waiting for task id %s to become complete", taskId)
+			return "", "", fmt.Errorf("%w waiting for task id %s to become complete", retry.ErrTimeout, taskId)
 		case <-pollTicker:
-			log.Printf("Polling task id %s to determine if it is completed", taskId)
+			log.V(1).Info("Polling export task to determine if it is completed")
 
-			s3Bucket, s3FilePath, completed, exists, err = c.GetExportTaskStatus(taskId, amiId, imageFormat)
-			if err != nil {
-				log.Printf("err encountered looking up task id %s: %v", taskId, err)
+			status, err := c.getExportTaskStatus(taskId, amiId, imageFormat)
+			if isNotFound(err) && time.Since(start) < notFoundGrace {
+				log.V(1).Info("Export task not found yet, waiting for it to become visible")
+				continue
+			} else if err != nil && !retry.Retryable(err) {
+				return "", "", err
+			} else if err != nil {
+				log.Error(err, "Error encountered looking up export task")
 				continue
-			} else if !exists {
-				log.Printf("Task id %s does not exist, waiting for task to become available", taskId)
+			} else if !status.exists {
+				log.V(1).Info("Export task does not exist, waiting for task to become available")
 				continue
-			} else if completed {
-				log.Printf("Task id %s completed", taskId)
-				return
+			} else if status.completed {
+				log.Info("Export task completed")
+				return status.s3Bucket, status.s3FilePath, nil
+			} else if progress != nil {
+				progress(status.progress, status.statusMessage)
 			}
 		}
 	}
 }
 
+// FindImageByName looks up the AMI named amiName owned by accountId. Should
+// several share the name, the newest is returned.
 func (c *client) FindImageByName(amiName string, accountId string) (*types.Image, bool, error) {
-	filterKeyName := "name"
-	params := &ec2.DescribeImagesInput{
-		Filters: []types.Filter{
-			{
-				Name:   &filterKeyName,
-				Values: []string{amiName},
-			},
-		},
-		Owners: []string{accountId},
-	}
-
-	amiListOutput, err := c.ec2Client.DescribeImages(context.Background(), params, func(o *ec2.Options) {
-		o.Region = c.region
-	})
+	image, err := c.findNewestImage([]string{accountId}, []types.Filter{imageFilter("name", amiName)})
 	if err != nil {
 		return nil, false, err
-	}
-
-	if len(amiListOutput.Images) == 0 {
+	} else if image == nil {
 		return nil, false, nil
 	}
+	return image, true, nil
+}
 
-	image := amiListOutput.Images[0]
-	return &image, true, nil
+// FindNewestImage returns the available AMI owned by one of owners whose
+// name matches namePattern, which may contain the * and ? wildcards, with
+// the most recent CreationDate.
+func (c *client) FindNewestImage(owners []string, namePattern string) (*types.Image, error) {
+	return c.ResolveImage(ImageSelector{Name: namePattern, Owners: owners})
 }
 
 func (c *client) CopyImageName(amiId string) string {
 	return fmt.Sprintf("kubevirt-export-automation-copy-%s", amiId)
 }
 
-func (c *client) CopyImage(amiId string, amiCopyName string) (string, error) {
+// CopyImage copies amiId into the client's account. When encrypt is set the
+// copy is encrypted with kmsKeyId, or with the account's default EBS key when
+// kmsKeyId is empty, which is how encrypted images shared from another account
+// are re-encrypted with a key the client owns.
+func (c *client) CopyImage(amiId string, amiCopyName string, encrypt bool, kmsKeyId string) (string, error) {
 	copyInput := &ec2.CopyImageInput{
 		Name:          &amiCopyName,
 		SourceImageId: &amiId,
 		SourceRegion:  &c.region,
 	}
+	if encrypt || kmsKeyId != "" {
+		encrypted := true
+		copyInput.Encrypted = &encrypted
+		if kmsKeyId != "" {
+			copyInput.KmsKeyId = &kmsKeyId
+		}
+	}
 
-	copyOutput, err := c.ec2Client.CopyImage(context.Background(), copyInput, func(o *ec2.Options) {
+	copyOutput, err := c.ec2Client.CopyImage(c.context(), copyInput, func(o *ec2.Options) {
 		o.Region = c.region
 	})
 
@@ -259,7 +455,7 @@ func (c *client) CopyImage(amiId string, amiCopyName string) (string, error) {
 }
 
 func (c *client) GetMyAccountId() (string, error) {
-	identityOutput, err := c.stsClient.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{}, func(o *sts.Options) {
+	identityOutput, err := c.stsClient.GetCallerIdentity(c.context(), &sts.GetCallerIdentityInput{}, func(o *sts.Options) {
 		o.Region = c.region
 	})
 
@@ -278,18 +474,27 @@ func (c *client) IsImageAvailable(amiId string) (bool, error) {
 		return false, err
 	} else if image.State == types.ImageStateAvailable {
 		return true, nil
+	} else if image.State == types.ImageStateFailed || image.State == types.ImageStateError {
+		reason := ""
+		if image.StateReason != nil && image.StateReason.Message != nil {
+			reason = *image.StateReason.Message
+		}
+		return false, fmt.Errorf("%w: ami %s is in state %s: %s", ErrImageFailed, amiId, image.State, reason)
 	}
 
-	log.Printf("ami %s is in state %s, waiting for state %s", amiId, image.State, types.ImageStateAvailable)
+	c.log.V(1).Info("Waiting for ami to become available", logging.KeyAmi, amiId, "state", image.State)
 	return false, nil
 }
 
-func (c *client) WaitForImageToBecomeAvailable(amiId string, timeout time.Duration) error {
+func (c *client) WaitForImageToBecomeAvailable(amiId string, timeout time.Duration, pollInterval time.Duration) error {
 	ticker := time.NewTicker(timeout).C
-	pollTicker := time.NewTicker(time.Second * 15).C
+	pollTicker := time.NewTicker(pollInterval).C
+	start := time.Now()
 
-	available, _ := c.IsImageAvailable(amiId)
-	if available {
+	available, err := c.IsImageAvailable(amiId)
+	if errors.Is(err, ErrImageFailed) {
+		return err
+	} else if available {
 		return nil
 	}
 
@@ -297,16 +502,21 @@ func (c *client) WaitForImageToBecomeAvailable(amiId string, timeout time.Durati
 	for {
 		select {
 		case <-ticker:
-			return fmt.Errorf("timed out waiting for ami %s to become available", amiId)
+			return fmt.Errorf("%w waiting for ami %s to become available", retry.ErrTimeout, amiId)
 		case <-pollTicker:
-			log.Printf("Polling ami %s to determine if it is available", amiId)
+			c.log.V(1).Info("Polling ami to determine if it is available", logging.KeyAmi, amiId)
 
 			available, err := c.IsImageAvailable(amiId)
-			if err != nil {
-				log.Printf("err encountered looking up ami %s: %v", amiId, err)
+			if isNotFound(err) && time.Since(start) < notFoundGrace {
+				c.log.V(1).Info("Ami not found yet, waiting for it to become visible", logging.KeyAmi, amiId)
+				continue
+			} else if errors.Is(err, ErrImageFailed) || (err != nil && !retry.Retryable(err)) {
+				return err
+			} else if err != nil {
+				c.log.Error(err, "Error encountered looking up ami", logging.KeyAmi, amiId)
 				continue
 			} else if available {
-				log.Printf("ami %s is available", amiId)
+				c.log.Info("Ami is available", logging.KeyAmi, amiId)
 				return nil
 			}
 		}
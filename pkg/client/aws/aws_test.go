@@ -0,0 +1,60 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestParseExportImageFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{format: "vmdk", want: ExportImageFormatVmdk},
+		{format: "VMDK", want: ExportImageFormatVmdk},
+		{format: "vhd", want: ExportImageFormatVhd},
+		{format: "Raw", want: ExportImageFormatRaw},
+		{format: "", wantErr: true},
+		{format: "qcow2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseExportImageFormat(tt.format)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseExportImageFormat(%q) = %q, want an error", tt.format, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseExportImageFormat(%q) returned error: %v", tt.format, err)
+		} else if got != tt.want {
+			t.Errorf("ParseExportImageFormat(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil},
+		{name: "ami", err: &smithy.GenericAPIError{Code: "InvalidAMIID.NotFound"}, want: true},
+		{name: "export task", err: &smithy.GenericAPIError{Code: "InvalidExportTaskID.NotFound"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("describe: %w", &smithy.GenericAPIError{Code: "InvalidAMIID.NotFound"}), want: true},
+		{name: "malformed id", err: &smithy.GenericAPIError{Code: "InvalidAMIID.Malformed"}},
+		{name: "other", err: errors.New("InvalidAMIID.NotFound")},
+	}
+
+	for _, tt := range tests {
+		if got := isNotFound(tt.err); got != tt.want {
+			t.Errorf("%s: isNotFound() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package aws
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// IsNotFound reports whether err is an AWS error for a resource that does
+// not exist, or no longer exists.
+func IsNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	code := apiErr.ErrorCode()
+	switch code {
+	case "NotFound", "NoSuchKey", "InvalidAMIID.Unavailable":
+		return true
+	}
+	return strings.HasSuffix(code, ".NotFound")
+}
+
+// DeleteImageAndSnapshots deregisters amiId and deletes the snapshots backing
+// it, which deregistering alone leaves behind. An AMI that no longer exists
+// is not an error.
+func (c *client) DeleteImageAndSnapshots(amiId string) error {
+	amiListOutput, err := c.ec2Client.DescribeImages(c.context(), &ec2.DescribeImagesInput{ImageIds: []string{amiId}}, func(o *ec2.Options) {
+		o.Region = c.region
+	})
+	if IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if len(amiListOutput.Images) == 0 {
+		return nil
+	}
+
+	var snapshotIds []string
+	for _, mapping := range amiListOutput.Images[0].BlockDeviceMappings {
+		if mapping.Ebs != nil && mapping.Ebs.SnapshotId != nil {
+			snapshotIds = append(snapshotIds, *mapping.Ebs.SnapshotId)
+		}
+	}
+
+	err = c.DeregisterImage(amiId)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+
+	for _, snapshotId := range snapshotIds {
+		err = c.DeleteSnapshot(snapshotId)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelExportTask cancels an export that is still in progress.
+func (c *client) CancelExportTask(exportTaskId string) error {
+	_, err := c.ec2Client.CancelExportTask(c.context(), &ec2.CancelExportTaskInput{ExportTaskId: &exportTaskId}, func(o *ec2.Options) {
+		o.Region = c.region
+	})
+	return err
+}
+
+func (c *client) DeleteS3Object(bucket string, key string) error {
+	_, err := c.s3Client.DeleteObject(c.context(), &s3.DeleteObjectInput{Bucket: &bucket, Key: &key}, func(o *s3.Options) {
+		o.Region = c.region
+	})
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package aws
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// IAMRole is the subset of an IAM role the importer relies on.
+type IAMRole struct {
+	RoleName string
+	Arn      string
+	// AssumeRolePolicyDocument is the role's trust policy, decoded from the
+	// url encoding IAM returns it in.
+	AssumeRolePolicyDocument string
+}
+
+// IsIAMNoSuchEntity reports whether err is IAM's error for a missing entity.
+func IsIAMNoSuchEntity(err error) bool {
+	var noSuchEntity *iamtypes.NoSuchEntityException
+	return errors.As(err, &noSuchEntity)
+}
+
+// iamOptions resolve the endpoint of IAM, a global service, from the
+// partition of the client's region.
+func (c *client) iamOptions(o *iam.Options) {
+	o.Region = c.region
+}
+
+func newIAMRole(role *iamtypes.Role) (*IAMRole, error) {
+	if role == nil {
+		return nil, errors.New("iam returned no role")
+	}
+	decoded := &IAMRole{}
+	if role.RoleName != nil {
+		decoded.RoleName = *role.RoleName
+	}
+	if role.Arn != nil {
+		decoded.Arn = *role.Arn
+	}
+	if role.AssumeRolePolicyDocument != nil {
+		doc, err := url.QueryUnescape(*role.AssumeRolePolicyDocument)
+		if err != nil {
+			return nil, err
+		}
+		decoded.AssumeRolePolicyDocument = doc
+	}
+	return decoded, nil
+}
+
+func (c *client) GetRole(roleName string) (*IAMRole, bool, error) {
+	output, err := c.iamClient.GetRole(c.context(), &iam.GetRoleInput{RoleName: &roleName}, c.iamOptions)
+	if IsIAMNoSuchEntity(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	role, err := newIAMRole(output.Role)
+	if err != nil {
+		return nil, false, err
+	}
+	return role, true, nil
+}
+
+func (c *client) CreateRole(roleName string, trustPolicy string, description string) (*IAMRole, error) {
+	output, err := c.iamClient.CreateRole(c.context(), &iam.CreateRoleInput{
+		RoleName:                 &roleName,
+		AssumeRolePolicyDocument: &trustPolicy,
+		Description:              &description,
+	}, c.iamOptions)
+	if err != nil {
+		return nil, err
+	}
+	return newIAMRole(output.Role)
+}
+
+// PutRolePolicy creates or replaces an inline policy of a role.
+func (c *client) PutRolePolicy(roleName string, policyName string, policy string) error {
+	_, err := c.iamClient.PutRolePolicy(c.context(), &iam.PutRolePolicyInput{
+		RoleName:       &roleName,
+		PolicyName:     &policyName,
+		PolicyDocument: &policy,
+	}, c.iamOptions)
+	return err
+}
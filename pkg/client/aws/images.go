@@ -0,0 +1,157 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	sdkaws "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// ImageSelector chooses an AMI by something other than its id. Either
+// SSMParameter names a parameter whose value is the AMI id, or the
+// available AMIs matching Name, Owners and Filters are looked up and the
+// newest is chosen.
+type ImageSelector struct {
+	// Name is the AMI name, with * and ? wildcards.
+	Name string
+	// Owners are account ids or the aliases self, amazon and
+	// aws-marketplace.
+	Owners []string
+	// Filters are DescribeImages filters by filter name.
+	Filters map[string][]string
+
+	SSMParameter string
+}
+
+// Empty reports whether the selector selects nothing.
+func (s *ImageSelector) Empty() bool {
+	return s.Name == "" && len(s.Owners) == 0 && len(s.Filters) == 0 && s.SSMParameter == ""
+}
+
+// ParseImageFilter parses a filter given as name=value1,value2, such as
+// tag:Environment=prod or architecture=x86_64, and adds it to filters.
+func ParseImageFilter(filter string, filters map[string][]string) error {
+	parts := strings.SplitN(filter, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("filter %q must be in the form name=value1,value2", filter)
+	}
+	filters[parts[0]] = append(filters[parts[0]], strings.Split(parts[1], ",")...)
+	return nil
+}
+
+// ResolveImage returns the AMI chosen by selector.
+func (c *client) ResolveImage(selector ImageSelector) (*types.Image, error) {
+	if selector.SSMParameter != "" {
+		amiId, err := c.GetSSMParameter(selector.SSMParameter)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ssm parameter %s: %w", selector.SSMParameter, err)
+		}
+		return c.FindGlobalImageById(amiId)
+	}
+
+	if len(selector.Owners) == 0 {
+		return nil, fmt.Errorf("an owner is required to select an image by %s", selector.describe())
+	}
+
+	var filters []types.Filter
+	if selector.Name != "" {
+		filters = append(filters, imageFilter("name", selector.Name))
+	}
+	for name, values := range selector.Filters {
+		filters = append(filters, imageFilter(name, values...))
+	}
+	filters = append(filters, imageFilter("state", string(types.ImageStateAvailable)))
+
+	image, err := c.findNewestImage(selector.Owners, filters)
+	if err != nil {
+		return nil, err
+	} else if image == nil {
+		return nil, fmt.Errorf("no available image matches %s", selector.describe())
+	}
+	return image, nil
+}
+
+func (s *ImageSelector) describe() string {
+	var terms []string
+	if s.Name != "" {
+		terms = append(terms, fmt.Sprintf("name %s", s.Name))
+	}
+	if len(s.Owners) != 0 {
+		terms = append(terms, fmt.Sprintf("owner %s", strings.Join(s.Owners, ",")))
+	}
+	for name, values := range s.Filters {
+		terms = append(terms, fmt.Sprintf("%s=%s", name, strings.Join(values, ",")))
+	}
+	return strings.Join(terms, ", ")
+}
+
+func imageFilter(name string, values ...string) types.Filter {
+	return types.Filter{
+		Name:   &name,
+		Values: values,
+	}
+}
+
+// findNewestImage returns the image with the most recent CreationDate of
+// those matching filters and owned by one of owners, or nil when none
+// match. Images created at the same time are ordered by id so that the
+// choice is stable.
+func (c *client) findNewestImage(owners []string, filters []types.Filter) (*types.Image, error) {
+	params := &ec2.DescribeImagesInput{
+		Filters: filters,
+		Owners:  owners,
+	}
+
+	amiListOutput, err := c.ec2Client.DescribeImages(c.context(), params, func(o *ec2.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var newest *types.Image
+	for idx := range amiListOutput.Images {
+		image := &amiListOutput.Images[idx]
+		if newest == nil || imageIsNewer(image, newest) {
+			newest = image
+		}
+	}
+	return newest, nil
+}
+
+// ImageBootMode returns the boot mode instances of image start with. Images
+// that do not specify one boot arm64 with uefi and everything else with
+// legacy-bios.
+func ImageBootMode(image *types.Image) types.BootModeValues {
+	if image.BootMode != "" {
+		return image.BootMode
+	} else if image.Architecture == types.ArchitectureValuesArm64 {
+		return types.BootModeValuesUefi
+	}
+	return types.BootModeValuesLegacyBios
+}
+
+// ImageCreationTime parses the CreationDate of image.
+func ImageCreationTime(image *types.Image) (time.Time, error) {
+	if image.CreationDate == nil {
+		return time.Time{}, fmt.Errorf("image %s has no creation date", sdkaws.ToString(image.ImageId))
+	}
+	return time.Parse(time.RFC3339, *image.CreationDate)
+}
+
+func imageIsNewer(image *types.Image, than *types.Image) bool {
+	imageTime, imageErr := ImageCreationTime(image)
+	thanTime, thanErr := ImageCreationTime(than)
+	switch {
+	case imageErr != nil && thanErr == nil:
+		return false
+	case imageErr == nil && thanErr != nil:
+		return true
+	case imageErr == nil && !imageTime.Equal(thanTime):
+		return imageTime.After(thanTime)
+	}
+	return sdkaws.ToString(image.ImageId) > sdkaws.ToString(than.ImageId)
+}
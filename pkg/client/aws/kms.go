@@ -0,0 +1,106 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/smithy-go"
+)
+
+// kmsSourceKeyActions are the operations the copying account needs on the
+// key of an encrypted source snapshot.
+var kmsSourceKeyActions = []string{"kms:DescribeKey", "kms:Decrypt", "kms:ReEncryptFrom", "kms:CreateGrant"}
+
+// kmsTargetKeyActions are the operations the copying account needs on the
+// key a copy is re-encrypted with.
+var kmsTargetKeyActions = []string{"kms:DescribeKey", "kms:GenerateDataKeyWithoutPlaintext", "kms:ReEncryptTo", "kms:CreateGrant"}
+
+func (c *client) DescribeKmsKey(keyId string) (*kmstypes.KeyMetadata, error) {
+	output, err := c.kmsClient.DescribeKey(c.context(), &kms.DescribeKeyInput{KeyId: &keyId}, func(o *kms.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return nil, err
+	}
+	if output.KeyMetadata == nil {
+		return nil, fmt.Errorf("kms key %s has no metadata", keyId)
+	}
+	return output.KeyMetadata, nil
+}
+
+// CheckSourceKmsKeyAccess verifies the client's account can use the key an
+// encrypted source snapshot is encrypted with, which is required for
+// CopyImage. The returned error names the key and the actions found missing.
+func (c *client) CheckSourceKmsKeyAccess(keyId string, accountId string) error {
+	return c.checkKmsKeyAccess(keyId, accountId, kmsSourceKeyActions)
+}
+
+// CheckTargetKmsKeyAccess verifies the client's account can re-encrypt a
+// copy with keyId.
+func (c *client) CheckTargetKmsKeyAccess(keyId string, accountId string) error {
+	return c.checkKmsKeyAccess(keyId, accountId, kmsTargetKeyActions)
+}
+
+// checkKmsKeyAccess describes the key, which proves the key policy lets the
+// account use it at all, and then simulates the caller's IAM policies for
+// each of actions on it. The key policy itself can not be simulated for
+// roles, and a caller not allowed to simulate policies is only checked with
+// DescribeKey.
+func (c *client) checkKmsKeyAccess(keyId string, accountId string, actions []string) error {
+	keyAccount := ""
+	if keyArn, err := arn.Parse(keyId); err == nil {
+		keyAccount = keyArn.AccountID
+	}
+
+	key, err := c.DescribeKmsKey(keyId)
+	if err != nil {
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) {
+			return err
+		}
+		if keyAccount != "" && keyAccount != accountId {
+			return fmt.Errorf("kms key %s in account %s is not shared with account %s (%s). The key policy must grant arn:aws:iam::%s:root %s", keyId, keyAccount, accountId, apiErr.ErrorCode(), accountId, strings.Join(actions, ", "))
+		}
+		return fmt.Errorf("kms key %s can not be described by account %s (%s). The key policy and the caller's IAM policy must allow kms:DescribeKey", keyId, accountId, apiErr.ErrorCode())
+	}
+
+	keyArn := ""
+	if key.Arn != nil {
+		keyArn = *key.Arn
+	}
+	keyOwner := ""
+	if key.AWSAccountId != nil {
+		keyOwner = *key.AWSAccountId
+	}
+	if key.KeyState != kmstypes.KeyStateEnabled {
+		return fmt.Errorf("kms key %s is in state %s, it must be %s", keyArn, key.KeyState, kmstypes.KeyStateEnabled)
+	}
+	if key.KeyManager == kmstypes.KeyManagerTypeAws && keyOwner != accountId {
+		return fmt.Errorf("kms key %s is an AWS managed key of account %s and can not be shared. The owner must re-encrypt the image with a customer managed key shared with account %s", keyArn, keyOwner, accountId)
+	}
+
+	principalArn, err := c.callerPrincipalArn()
+	if err != nil {
+		return err
+	}
+	checks, err := c.SimulatePrincipalPolicy(principalArn, actions, keyArn)
+	if err != nil {
+		c.log.Error(err, "Unable to simulate access to kms key, only kms:DescribeKey was checked", "kmsKey", keyArn)
+		return nil
+	}
+
+	var denied []string
+	for _, check := range checks {
+		if !check.Allowed {
+			denied = append(denied, check.Action)
+		}
+	}
+	if len(denied) != 0 {
+		return fmt.Errorf("the IAM policy of %s does not allow %s on kms key %s", principalArn, strings.Join(denied, ", "), keyArn)
+	}
+	return nil
+}
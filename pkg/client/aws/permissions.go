@@ -0,0 +1,289 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	sdkaws "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	PermissionMethodDryRun     = "dry-run"
+	PermissionMethodSimulation = "policy-simulation"
+
+	// placeholderAmiId stands in for an AMI when none is given. Dry runs
+	// against it are usually inconclusive and fall back to simulation.
+	placeholderAmiId = "ami-00000000000000000"
+	// placeholderSnapshotId stands in for the snapshots an import copies,
+	// and later removes, in dry runs.
+	placeholderSnapshotId = "snap-00000000000000000"
+)
+
+// PermissionCheck is the outcome of checking a single action.
+type PermissionCheck struct {
+	Action   string
+	Resource string
+	Method   string
+	Allowed  bool
+	Detail   string
+}
+
+// dryRunResult interprets the error of an EC2 call made with DryRun set.
+// conclusive is false when EC2 rejected the call for a reason other than
+// authorization, such as a parameter it validates first.
+func dryRunResult(err error) (allowed bool, conclusive bool, detail string) {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		if err == nil {
+			return true, true, ""
+		}
+		return false, false, err.Error()
+	}
+
+	switch apiErr.ErrorCode() {
+	case "DryRunOperation":
+		return true, true, ""
+	case "UnauthorizedOperation":
+		return false, true, apiErr.ErrorMessage()
+	}
+	return false, false, fmt.Sprintf("%s: %s", apiErr.ErrorCode(), apiErr.ErrorMessage())
+}
+
+// CheckPermissions verifies the caller may perform every AWS action an
+// import of amiId into bucket needs. EC2 actions are exercised with DryRun,
+// and actions without a dry run mode, or whose dry run was inconclusive, are
+// checked with IAM policy simulation. readerRoleArn is checked for
+// sts:AssumeRole when set. The KMS actions of encrypted copies are simulated
+// on kmsKeyArn, or on any key when it is empty.
+func (c *client) CheckPermissions(amiId string, bucket string, readerRoleArn string, kmsKeyArn string) ([]PermissionCheck, error) {
+	if amiId == "" {
+		amiId = placeholderAmiId
+	}
+	if kmsKeyArn == "" {
+		kmsKeyArn = "*"
+	}
+	dryRun := true
+	snapshotId := placeholderSnapshotId
+	ec2Opts := func(o *ec2.Options) {
+		o.Region = c.region
+	}
+
+	dryRuns := []struct {
+		action string
+		call   func() error
+	}{
+		{
+			action: "ec2:DescribeImages",
+			call: func() error {
+				_, err := c.ec2Client.DescribeImages(c.context(), &ec2.DescribeImagesInput{DryRun: &dryRun, ImageIds: []string{amiId}}, ec2Opts)
+				return err
+			},
+		},
+		{
+			action: "ec2:CopyImage",
+			call: func() error {
+				name := c.CopyImageName(amiId)
+				_, err := c.ec2Client.CopyImage(c.context(), &ec2.CopyImageInput{DryRun: &dryRun, Name: &name, SourceImageId: &amiId, SourceRegion: &c.region}, ec2Opts)
+				return err
+			},
+		},
+		{
+			action: "ec2:ExportImage",
+			call: func() error {
+				prefix := "kubevirt-image-exports/"
+				_, err := c.ec2Client.ExportImage(c.context(), &ec2.ExportImageInput{
+					DryRun:          &dryRun,
+					ImageId:         &amiId,
+					DiskImageFormat: types.DiskImageFormatVmdk,
+					S3ExportLocation: &types.ExportTaskS3LocationRequest{
+						S3Bucket: &bucket,
+						S3Prefix: &prefix,
+					},
+				}, ec2Opts)
+				return err
+			},
+		},
+		{
+			action: "ec2:DescribeExportImageTasks",
+			call: func() error {
+				_, err := c.ec2Client.DescribeExportImageTasks(c.context(), &ec2.DescribeExportImageTasksInput{DryRun: &dryRun}, ec2Opts)
+				return err
+			},
+		},
+		{
+			action: "ec2:CopySnapshot",
+			call: func() error {
+				_, err := c.ec2Client.CopySnapshot(c.context(), &ec2.CopySnapshotInput{DryRun: &dryRun, SourceSnapshotId: &snapshotId, SourceRegion: &c.region}, ec2Opts)
+				return err
+			},
+		},
+		{
+			action: "ec2:RegisterImage",
+			call: func() error {
+				name := c.SnapshotImageName(snapshotId)
+				rootDevice := "/dev/xvda"
+				_, err := c.ec2Client.RegisterImage(c.context(), &ec2.RegisterImageInput{
+					DryRun:         &dryRun,
+					Name:           &name,
+					RootDeviceName: &rootDevice,
+					BlockDeviceMappings: []types.BlockDeviceMapping{
+						{DeviceName: &rootDevice, Ebs: &types.EbsBlockDevice{SnapshotId: &snapshotId}},
+					},
+				}, ec2Opts)
+				return err
+			},
+		},
+		{
+			action: "ec2:DeregisterImage",
+			call: func() error {
+				placeholder := placeholderAmiId
+				_, err := c.ec2Client.DeregisterImage(c.context(), &ec2.DeregisterImageInput{DryRun: &dryRun, ImageId: &placeholder}, ec2Opts)
+				return err
+			},
+		},
+		{
+			action: "ec2:DeleteSnapshot",
+			call: func() error {
+				_, err := c.ec2Client.DeleteSnapshot(c.context(), &ec2.DeleteSnapshotInput{DryRun: &dryRun, SnapshotId: &snapshotId}, ec2Opts)
+				return err
+			},
+		},
+	}
+
+	var checks []PermissionCheck
+	// ec2:CancelExportTask has no dry run mode
+	simulateEC2 := []string{"ec2:CancelExportTask"}
+	for _, dr := range dryRuns {
+		allowed, conclusive, detail := dryRunResult(dr.call())
+		if !conclusive {
+			simulateEC2 = append(simulateEC2, dr.action)
+			continue
+		}
+		checks = append(checks, PermissionCheck{
+			Action:   dr.action,
+			Resource: "*",
+			Method:   PermissionMethodDryRun,
+			Allowed:  allowed,
+			Detail:   detail,
+		})
+	}
+
+	principalArn, err := c.callerPrincipalArn()
+	if err != nil {
+		return checks, err
+	}
+
+	type simulation struct {
+		actions  []string
+		resource string
+	}
+	simulations := []simulation{
+		{actions: simulateEC2, resource: "*"},
+		{actions: []string{"s3:ListBucket", "s3:GetBucketLocation"}, resource: fmt.Sprintf("arn:aws:s3:::%s", bucket)},
+		// s3:GetObject also authorizes HeadObject, which has no action of
+		// its own
+		{actions: []string{"s3:GetObject", "s3:DeleteObject"}, resource: fmt.Sprintf("arn:aws:s3:::%s/*", bucket)},
+		{actions: kmsCopyActions(), resource: kmsKeyArn},
+	}
+	if readerRoleArn != "" {
+		simulations = append(simulations, simulation{actions: []string{"sts:AssumeRole"}, resource: readerRoleArn})
+	}
+
+	for _, sim := range simulations {
+		if len(sim.actions) == 0 {
+			continue
+		}
+		results, err := c.SimulatePrincipalPolicy(principalArn, sim.actions, sim.resource)
+		if err != nil {
+			return checks, fmt.Errorf("unable to simulate policy of %s: %v", principalArn, err)
+		}
+		checks = append(checks, results...)
+	}
+
+	return checks, nil
+}
+
+// callerPrincipalArn returns the IAM ARN of the caller. Assumed role
+// sessions are mapped back to their role, which is what policy simulation
+// accepts.
+func (c *client) callerPrincipalArn() (string, error) {
+	identityOutput, err := c.stsClient.GetCallerIdentity(c.context(), &sts.GetCallerIdentityInput{}, func(o *sts.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return "", err
+	}
+	if identityOutput.Arn == nil {
+		return "", fmt.Errorf("caller arn not found")
+	}
+
+	callerArn, err := arn.Parse(*identityOutput.Arn)
+	if err != nil {
+		return "", err
+	}
+	if callerArn.Service != "sts" || !strings.HasPrefix(callerArn.Resource, "assumed-role/") {
+		return *identityOutput.Arn, nil
+	}
+
+	// assumed-role/<role name>/<session name>
+	roleName := strings.Split(callerArn.Resource, "/")[1]
+	role, exists, err := c.GetRole(roleName)
+	if err == nil && exists {
+		return role.Arn, nil
+	}
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", callerArn.AccountID, roleName), nil
+}
+
+// SimulatePrincipalPolicy evaluates the policies attached to principalArn
+// for actions on resource with IAM policy simulation.
+func (c *client) SimulatePrincipalPolicy(principalArn string, actions []string, resource string) ([]PermissionCheck, error) {
+	params := &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: &principalArn,
+		ActionNames:     actions,
+		ResourceArns:    []string{resource},
+	}
+
+	var checks []PermissionCheck
+	paginator := iam.NewSimulatePrincipalPolicyPaginator(c.iamClient, params)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(c.context(), c.iamOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range output.EvaluationResults {
+			check := PermissionCheck{
+				Action:   sdkaws.ToString(result.EvalActionName),
+				Resource: sdkaws.ToString(result.EvalResourceName),
+				Method:   PermissionMethodSimulation,
+				Allowed:  result.EvalDecision == iamtypes.PolicyEvaluationDecisionTypeAllowed,
+			}
+			if !check.Allowed {
+				check.Detail = string(result.EvalDecision)
+			}
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+// kmsCopyActions are the actions on the source and target keys of an
+// encrypted copy.
+func kmsCopyActions() []string {
+	var actions []string
+	seen := map[string]bool{}
+	for _, action := range append(append([]string{}, kmsSourceKeyActions...), kmsTargetKeyActions...) {
+		if !seen[action] {
+			seen[action] = true
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
@@ -0,0 +1,141 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	// usageOperationLinux is the billing code of images without any
+	// billing product attached.
+	usageOperationLinux = "RunInstances"
+	// usageOperationWindowsBYOL is the billing code of Windows images
+	// imported with a customer provided license, which AWS allows exporting.
+	usageOperationWindowsBYOL = "RunInstances:0800"
+)
+
+// ErrNotExportable is wrapped by the error of a preflight that found
+// blockers.
+var ErrNotExportable = errors.New("ami can not be exported")
+
+// ExportPreflight is the result of checking whether an AMI can be exported
+// with ExportImage.
+type ExportPreflight struct {
+	// Blockers lists each reason AWS will refuse to export the image.
+	// The image is exportable when it is empty.
+	Blockers []string
+	// EncryptedSnapshots lists the encrypted snapshots backing the image.
+	EncryptedSnapshots []string
+	// SnapshotKmsKeys maps each encrypted snapshot to the KMS key it is
+	// encrypted with, when the key could be determined.
+	SnapshotKmsKeys map[string]string
+	// RequiresCopy is set when the image must be copied into the client's
+	// account before it can be exported, even if the client already owns it.
+	RequiresCopy bool
+	// CopyReason explains why RequiresCopy is set.
+	CopyReason string
+}
+
+// Exportable reports whether no blocker was found.
+func (p *ExportPreflight) Exportable() bool {
+	return len(p.Blockers) == 0
+}
+
+// Error describes every blocker found, or nil when the image is exportable.
+func (p *ExportPreflight) Error() error {
+	if p.Exportable() {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNotExportable, strings.Join(p.Blockers, "; "))
+}
+
+// CheckImageExportable inspects an AMI for the conditions under which AWS
+// refuses ExportImage, so an import fails before any copy or export is
+// started rather than after.
+func (c *client) CheckImageExportable(amiId string, accountId string) (*ExportPreflight, error) {
+	image, err := c.FindGlobalImageById(amiId)
+	if err != nil {
+		return nil, err
+	}
+	return checkImageExportable(image, accountId, c.FindSnapshotById), nil
+}
+
+// checkImageExportable runs the checks of CheckImageExportable against
+// image, looking up the key of encrypted snapshots with findSnapshot when
+// the image does not report it.
+func checkImageExportable(image *types.Image, accountId string, findSnapshot func(snapshotId string) (*types.Snapshot, error)) *ExportPreflight {
+	preflight := &ExportPreflight{
+		SnapshotKmsKeys: map[string]string{},
+	}
+
+	for _, productCode := range image.ProductCodes {
+		if productCode.ProductCodeId == nil {
+			continue
+		}
+		preflight.Blockers = append(preflight.Blockers, fmt.Sprintf("image carries %s product code %s, images derived from AWS Marketplace products can not be exported", productCode.ProductCodeType, *productCode.ProductCodeId))
+	}
+
+	platformDetails := ""
+	if image.PlatformDetails != nil {
+		platformDetails = *image.PlatformDetails
+	}
+	if image.UsageOperation != nil && *image.UsageOperation != usageOperationLinux && *image.UsageOperation != usageOperationWindowsBYOL {
+		preflight.Blockers = append(preflight.Blockers, fmt.Sprintf("image is billed as %q (usage operation %s), images with AWS provided licenses or billing products can not be exported", platformDetails, *image.UsageOperation))
+	} else if image.UsageOperation == nil && image.Platform == types.PlatformValuesWindows {
+		preflight.Blockers = append(preflight.Blockers, "image is a Windows image with an AWS provided license, which can not be exported")
+	}
+
+	if image.RootDeviceType != types.DeviceTypeEbs {
+		preflight.Blockers = append(preflight.Blockers, fmt.Sprintf("image has a %s root device, only EBS backed images can be exported", image.RootDeviceType))
+	}
+
+	if image.VirtualizationType == types.VirtualizationTypeParavirtual {
+		preflight.Blockers = append(preflight.Blockers, "image uses paravirtual virtualization, only HVM images can be exported")
+	}
+
+	for _, mapping := range image.BlockDeviceMappings {
+		if mapping.Ebs == nil || mapping.Ebs.Encrypted == nil || !*mapping.Ebs.Encrypted {
+			continue
+		}
+
+		snapshotId := ""
+		if mapping.Ebs.SnapshotId != nil {
+			snapshotId = *mapping.Ebs.SnapshotId
+		}
+		preflight.EncryptedSnapshots = append(preflight.EncryptedSnapshots, snapshotId)
+
+		// DescribeImages rarely reports the key, and snapshots behind a
+		// shared image are often not visible to the client, so a missing
+		// key id is not an error.
+		kmsKeyId := ""
+		if mapping.Ebs.KmsKeyId != nil {
+			kmsKeyId = *mapping.Ebs.KmsKeyId
+		} else if snapshotId != "" {
+			if snapshot, err := findSnapshot(snapshotId); err == nil && snapshot.KmsKeyId != nil {
+				kmsKeyId = *snapshot.KmsKeyId
+			}
+		}
+
+		if kmsKeyId != "" {
+			preflight.SnapshotKmsKeys[snapshotId] = kmsKeyId
+		}
+
+		keyAccount := ""
+		if keyArn, err := arn.Parse(kmsKeyId); err == nil {
+			keyAccount = keyArn.AccountID
+		}
+
+		// The vmimport role can only decrypt with keys the exporting account
+		// owns, so anything else has to be re-encrypted by a copy first.
+		if keyAccount != "" && keyAccount != accountId && !preflight.RequiresCopy {
+			preflight.RequiresCopy = true
+			preflight.CopyReason = fmt.Sprintf("snapshot %s is encrypted with kms key %s owned by account %s", snapshotId, kmsKeyId, keyAccount)
+		}
+	}
+
+	return preflight
+}
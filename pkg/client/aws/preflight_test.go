@@ -0,0 +1,139 @@
+package aws
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestCheckImageExportable(t *testing.T) {
+	const accountId = "111111111111"
+	const foreignKey = "arn:aws:kms:us-east-1:222222222222:key/foreign"
+	const ownKey = "arn:aws:kms:us-east-1:111111111111:key/own"
+
+	image := func(mutate func(*types.Image)) *types.Image {
+		image := &types.Image{
+			UsageOperation:     aws.String(usageOperationLinux),
+			RootDeviceType:     types.DeviceTypeEbs,
+			VirtualizationType: types.VirtualizationTypeHvm,
+		}
+		if mutate != nil {
+			mutate(image)
+		}
+		return image
+	}
+	encrypted := func(snapshotId string, kmsKeyId *string) types.BlockDeviceMapping {
+		return types.BlockDeviceMapping{Ebs: &types.EbsBlockDevice{
+			Encrypted:  aws.Bool(true),
+			SnapshotId: aws.String(snapshotId),
+			KmsKeyId:   kmsKeyId,
+		}}
+	}
+	snapshots := map[string]*types.Snapshot{
+		"snap-lookup": {KmsKeyId: aws.String(foreignKey)},
+	}
+	findSnapshot := func(snapshotId string) (*types.Snapshot, error) {
+		if snapshot, ok := snapshots[snapshotId]; ok {
+			return snapshot, nil
+		}
+		return nil, errors.New("snapshot not found")
+	}
+
+	tests := []struct {
+		name         string
+		image        *types.Image
+		blockers     int
+		encrypted    []string
+		kmsKeys      map[string]string
+		requiresCopy bool
+	}{
+		{name: "exportable", image: image(nil)},
+		{name: "windows byol", image: image(func(i *types.Image) {
+			i.UsageOperation = aws.String(usageOperationWindowsBYOL)
+		})},
+		{name: "marketplace product code", blockers: 1, image: image(func(i *types.Image) {
+			i.ProductCodes = []types.ProductCode{{ProductCodeId: aws.String("abc"), ProductCodeType: types.ProductCodeValuesMarketplace}}
+		})},
+		{name: "billing product", blockers: 1, image: image(func(i *types.Image) {
+			i.UsageOperation = aws.String("RunInstances:0010")
+		})},
+		{name: "windows license without usage operation", blockers: 1, image: image(func(i *types.Image) {
+			i.UsageOperation = nil
+			i.Platform = types.PlatformValuesWindows
+		})},
+		{name: "instance store root", blockers: 1, image: image(func(i *types.Image) {
+			i.RootDeviceType = types.DeviceTypeInstanceStore
+		})},
+		{name: "paravirtual", blockers: 1, image: image(func(i *types.Image) {
+			i.VirtualizationType = types.VirtualizationTypeParavirtual
+		})},
+		{name: "every blocker", blockers: 4, image: image(func(i *types.Image) {
+			i.ProductCodes = []types.ProductCode{{ProductCodeId: aws.String("abc"), ProductCodeType: types.ProductCodeValuesMarketplace}}
+			i.UsageOperation = aws.String("RunInstances:0002")
+			i.RootDeviceType = types.DeviceTypeInstanceStore
+			i.VirtualizationType = types.VirtualizationTypeParavirtual
+		})},
+		{
+			name: "own kms key",
+			image: image(func(i *types.Image) {
+				i.BlockDeviceMappings = []types.BlockDeviceMapping{encrypted("snap-own", aws.String(ownKey))}
+			}),
+			encrypted: []string{"snap-own"},
+			kmsKeys:   map[string]string{"snap-own": ownKey},
+		},
+		{
+			name: "foreign kms key",
+			image: image(func(i *types.Image) {
+				i.BlockDeviceMappings = []types.BlockDeviceMapping{encrypted("snap-foreign", aws.String(foreignKey))}
+			}),
+			encrypted:    []string{"snap-foreign"},
+			kmsKeys:      map[string]string{"snap-foreign": foreignKey},
+			requiresCopy: true,
+		},
+		{
+			name: "kms key of snapshot",
+			image: image(func(i *types.Image) {
+				i.BlockDeviceMappings = []types.BlockDeviceMapping{encrypted("snap-lookup", nil)}
+			}),
+			encrypted:    []string{"snap-lookup"},
+			kmsKeys:      map[string]string{"snap-lookup": foreignKey},
+			requiresCopy: true,
+		},
+		{
+			name: "snapshot not visible",
+			image: image(func(i *types.Image) {
+				i.BlockDeviceMappings = []types.BlockDeviceMapping{encrypted("snap-hidden", nil)}
+			}),
+			encrypted: []string{"snap-hidden"},
+			kmsKeys:   map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		preflight := checkImageExportable(tt.image, accountId, findSnapshot)
+		if len(preflight.Blockers) != tt.blockers {
+			t.Errorf("%s: got blockers %q, want %d", tt.name, preflight.Blockers, tt.blockers)
+		}
+		if got := preflight.Error() != nil; got != (tt.blockers > 0) {
+			t.Errorf("%s: Error() = %v", tt.name, preflight.Error())
+		}
+		if tt.blockers > 0 && !errors.Is(preflight.Error(), ErrNotExportable) {
+			t.Errorf("%s: Error() does not wrap ErrNotExportable", tt.name)
+		}
+		if !reflect.DeepEqual(preflight.EncryptedSnapshots, tt.encrypted) {
+			t.Errorf("%s: got encrypted snapshots %q, want %q", tt.name, preflight.EncryptedSnapshots, tt.encrypted)
+		}
+		if tt.kmsKeys == nil {
+			tt.kmsKeys = map[string]string{}
+		}
+		if !reflect.DeepEqual(preflight.SnapshotKmsKeys, tt.kmsKeys) {
+			t.Errorf("%s: got kms keys %v, want %v", tt.name, preflight.SnapshotKmsKeys, tt.kmsKeys)
+		}
+		if preflight.RequiresCopy != tt.requiresCopy {
+			t.Errorf("%s: got RequiresCopy %v (%s), want %v", tt.name, preflight.RequiresCopy, preflight.CopyReason, tt.requiresCopy)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package aws
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Object is the metadata of an exported image recorded for verification.
+type S3Object struct {
+	Bucket string
+	Key    string
+	ETag   string
+	Size   int64
+}
+
+func (c *client) HeadS3Object(bucket string, key string) (*S3Object, error) {
+	headOutput, err := c.s3Client.HeadObject(c.context(), &s3.HeadObjectInput{Bucket: &bucket, Key: &key}, func(o *s3.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	object := &S3Object{
+		Bucket: bucket,
+		Key:    key,
+		Size:   headOutput.ContentLength,
+	}
+	if headOutput.ETag != nil {
+		object.ETag = strings.Trim(*headOutput.ETag, "\"")
+	}
+	return object, nil
+}
+
+// OpenS3Object streams the object's content. The caller must close the
+// returned reader.
+func (c *client) OpenS3Object(bucket string, key string) (io.ReadCloser, error) {
+	getOutput, err := c.s3Client.GetObject(c.context(), &s3.GetObjectInput{Bucket: &bucket, Key: &key}, func(o *s3.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return nil, err
+	}
+	if getOutput.Body == nil {
+		return nil, fmt.Errorf("object s3://%s/%s has no body", bucket, key)
+	}
+	return getOutput.Body, nil
+}
@@ -0,0 +1,357 @@
+package aws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// VMImportRoleName is the service role name ExportImage assumes by
+	// default.
+	VMImportRoleName = "vmimport"
+
+	vmImportServicePrincipal = "vmie.amazonaws.com"
+	vmImportExternalId       = "vmimport"
+	vmImportRolePolicyName   = "kubevirt-cloud-import"
+	vmImportBucketPolicySid  = "KubevirtCloudImportVmimport"
+
+	policyVersion = "2012-10-17"
+)
+
+// PolicyDocument is an IAM policy document.
+type PolicyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+// PolicyStatement is a single statement of an IAM policy document.
+type PolicyStatement struct {
+	Sid       string                       `json:"Sid,omitempty"`
+	Effect    string                       `json:"Effect"`
+	Principal map[string]string            `json:"Principal,omitempty"`
+	Action    []string                     `json:"Action"`
+	Resource  []string                     `json:"Resource,omitempty"`
+	Condition map[string]map[string]string `json:"Condition,omitempty"`
+}
+
+// String renders the document as indented JSON.
+func (d PolicyDocument) String() string {
+	out, _ := json.MarshalIndent(d, "", "  ")
+	return string(out)
+}
+
+func bucketResources(bucket string) []string {
+	return []string{
+		fmt.Sprintf("arn:aws:s3:::%s", bucket),
+		fmt.Sprintf("arn:aws:s3:::%s/*", bucket),
+	}
+}
+
+// VMImportRoleArn returns the ARN of the vmimport role in accountId.
+func VMImportRoleArn(accountId string, roleName string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", accountId, roleName)
+}
+
+// VMImportTrustPolicy is the trust policy that lets VM Import/Export assume
+// the vmimport role.
+func VMImportTrustPolicy() PolicyDocument {
+	return PolicyDocument{
+		Version: policyVersion,
+		Statement: []PolicyStatement{
+			{
+				Effect:    "Allow",
+				Principal: map[string]string{"Service": vmImportServicePrincipal},
+				Action:    []string{"sts:AssumeRole"},
+				Condition: map[string]map[string]string{
+					"StringEquals": {"sts:Externalid": vmImportExternalId},
+				},
+			},
+		},
+	}
+}
+
+// VMImportRolePolicy is the permission policy of the vmimport role needed
+// to export images into bucket, optionally decrypting with kmsKeyId.
+func VMImportRolePolicy(bucket string, kmsKeyId string) PolicyDocument {
+	policy := PolicyDocument{
+		Version: policyVersion,
+		Statement: []PolicyStatement{
+			{
+				Effect:   "Allow",
+				Action:   []string{"s3:GetBucketLocation", "s3:GetObject", "s3:ListBucket", "s3:PutObject", "s3:GetBucketAcl"},
+				Resource: bucketResources(bucket),
+			},
+			{
+				Effect:   "Allow",
+				Action:   []string{"ec2:ModifySnapshotAttribute", "ec2:CopySnapshot", "ec2:RegisterImage", "ec2:Describe*"},
+				Resource: []string{"*"},
+			},
+		},
+	}
+
+	if kmsKeyId != "" {
+		policy.Statement = append(policy.Statement, PolicyStatement{
+			Effect:   "Allow",
+			Action:   []string{"kms:CreateGrant", "kms:Decrypt", "kms:DescribeKey", "kms:Encrypt", "kms:GenerateDataKey*", "kms:ReEncrypt*"},
+			Resource: []string{kmsKeyId},
+		})
+	}
+	return policy
+}
+
+// VMImportBucketPolicy is the bucket policy granting the vmimport role the
+// access ExportImage needs to write into bucket.
+func VMImportBucketPolicy(bucket string, roleArn string) PolicyDocument {
+	return PolicyDocument{
+		Version: policyVersion,
+		Statement: []PolicyStatement{
+			{
+				Sid:       vmImportBucketPolicySid,
+				Effect:    "Allow",
+				Principal: map[string]string{"AWS": roleArn},
+				Action:    []string{"s3:GetBucketLocation", "s3:GetBucketAcl", "s3:ListBucket", "s3:PutObject", "s3:GetObject"},
+				Resource:  bucketResources(bucket),
+			},
+		},
+	}
+}
+
+// policyValues holds a policy element that is either a single string or a
+// list of them.
+type policyValues []string
+
+func (v *policyValues) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*v = policyValues{value}
+		return nil
+	}
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*v = values
+	return nil
+}
+
+func (v policyValues) contains(value string) bool {
+	for _, candidate := range v {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyPrincipal holds the principal of a statement, which is either a map
+// of principal types or "*" for everyone.
+type policyPrincipal map[string]policyValues
+
+func (p *policyPrincipal) UnmarshalJSON(data []byte) error {
+	var everyone string
+	if err := json.Unmarshal(data, &everyone); err == nil {
+		*p = policyPrincipal{"AWS": {everyone}}
+		return nil
+	}
+	principals := map[string]policyValues{}
+	if err := json.Unmarshal(data, &principals); err != nil {
+		return err
+	}
+	*p = principals
+	return nil
+}
+
+// trustPolicyStatement is a statement of a trust policy as IAM returns it,
+// where principals, actions and condition values may each be a string or a
+// list of strings.
+type trustPolicyStatement struct {
+	Effect    string
+	Principal policyPrincipal
+	Action    policyValues
+	Condition map[string]map[string]policyValues
+}
+
+// trustsVMImport reports whether a trust policy lets VM Import/Export assume
+// the role with the external id it passes. Policies with a single statement
+// not wrapped in a list are accepted, as IAM does.
+func trustsVMImport(policy string) (bool, error) {
+	document := struct {
+		Statement json.RawMessage
+	}{}
+	if err := json.Unmarshal([]byte(policy), &document); err != nil {
+		return false, err
+	}
+
+	var statements []trustPolicyStatement
+	if err := json.Unmarshal(document.Statement, &statements); err != nil {
+		var statement trustPolicyStatement
+		if err := json.Unmarshal(document.Statement, &statement); err != nil {
+			return false, err
+		}
+		statements = []trustPolicyStatement{statement}
+	}
+
+	for _, statement := range statements {
+		if statement.Effect != "Allow" || !statement.Principal["Service"].contains(vmImportServicePrincipal) || !statement.Action.contains("sts:AssumeRole") {
+			continue
+		}
+		for key, values := range statement.Condition["StringEquals"] {
+			// condition keys are case insensitive
+			if strings.EqualFold(key, "sts:ExternalId") && values.contains(vmImportExternalId) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func jsonString(v interface{}) (string, error) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// EnsureVMImportRole creates the vmimport role when it does not exist, or
+// validates its trust policy when it does, and then puts the permission
+// policy needed to export into bucket.
+func (c *client) EnsureVMImportRole(roleName string, bucket string, kmsKeyId string) (role *IAMRole, created bool, err error) {
+	role, exists, err := c.GetRole(roleName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if exists {
+		trusted, err := trustsVMImport(role.AssumeRolePolicyDocument)
+		if err != nil {
+			return nil, false, fmt.Errorf("unable to parse trust policy of role %s: %v", roleName, err)
+		}
+		if !trusted {
+			return nil, false, fmt.Errorf("role %s exists but its trust policy does not allow %s to assume it with external id %s", roleName, vmImportServicePrincipal, vmImportExternalId)
+		}
+	} else {
+		trustPolicy, err := jsonString(VMImportTrustPolicy())
+		if err != nil {
+			return nil, false, err
+		}
+		role, err = c.CreateRole(roleName, trustPolicy, "Service role used by VM Import/Export to export AMIs for KubeVirt")
+		if err != nil {
+			return nil, false, err
+		}
+		created = true
+	}
+
+	rolePolicy, err := jsonString(VMImportRolePolicy(bucket, kmsKeyId))
+	if err != nil {
+		return nil, false, err
+	}
+	err = c.PutRolePolicy(roleName, vmImportRolePolicyName, rolePolicy)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return role, created, nil
+}
+
+func isS3ErrorCode(err error, codes ...string) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.ErrorCode() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// EnsureBucket creates bucket in the client's region when it does not exist.
+func (c *client) EnsureBucket(bucket string) (created bool, err error) {
+	_, err = c.s3Client.HeadBucket(c.context(), &s3.HeadBucketInput{Bucket: &bucket}, func(o *s3.Options) {
+		o.Region = c.region
+	})
+	if err == nil {
+		return false, nil
+	}
+
+	var notFound *s3types.NotFound
+	if !errors.As(err, &notFound) && !isS3ErrorCode(err, "NotFound", "NoSuchBucket") {
+		return false, err
+	}
+
+	params := &s3.CreateBucketInput{
+		Bucket: &bucket,
+	}
+	// us-east-1 is the default location and is rejected as a constraint
+	if c.region != "" && c.region != "us-east-1" {
+		params.CreateBucketConfiguration = &s3types.CreateBucketConfiguration{
+			LocationConstraint: s3types.BucketLocationConstraint(c.region),
+		}
+	}
+
+	_, err = c.s3Client.CreateBucket(c.context(), params, func(o *s3.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// EnsureBucketPolicy adds the vmimport statement to the bucket's policy,
+// keeping any statements already present.
+func (c *client) EnsureBucketPolicy(bucket string, roleArn string) (updated bool, err error) {
+	policy := map[string]interface{}{
+		"Version": policyVersion,
+	}
+	var statements []interface{}
+
+	policyOutput, err := c.s3Client.GetBucketPolicy(c.context(), &s3.GetBucketPolicyInput{Bucket: &bucket}, func(o *s3.Options) {
+		o.Region = c.region
+	})
+	if err != nil && !isS3ErrorCode(err, "NoSuchBucketPolicy") {
+		return false, err
+	} else if err == nil && policyOutput.Policy != nil {
+		if err := json.Unmarshal([]byte(*policyOutput.Policy), &policy); err != nil {
+			return false, fmt.Errorf("unable to parse policy of bucket %s: %v", bucket, err)
+		}
+		switch existing := policy["Statement"].(type) {
+		case []interface{}:
+			statements = existing
+		case map[string]interface{}:
+			statements = []interface{}{existing}
+		}
+	}
+
+	for _, statement := range statements {
+		if fields, ok := statement.(map[string]interface{}); ok && fields["Sid"] == vmImportBucketPolicySid {
+			return false, nil
+		}
+	}
+
+	for _, statement := range VMImportBucketPolicy(bucket, roleArn).Statement {
+		statements = append(statements, statement)
+	}
+	policy["Statement"] = statements
+
+	policyString, err := jsonString(policy)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = c.s3Client.PutBucketPolicy(c.context(), &s3.PutBucketPolicyInput{Bucket: &bucket, Policy: &policyString}, func(o *s3.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
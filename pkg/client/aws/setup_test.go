@@ -0,0 +1,66 @@
+package aws
+
+import "testing"
+
+func TestTrustsVMImport(t *testing.T) {
+	generated, err := jsonString(VMImportTrustPolicy())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		policy  string
+		want    bool
+		wantErr bool
+	}{
+		{name: "generated", policy: generated, want: true},
+		{
+			name:   "single statement and values",
+			policy: `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Principal":{"Service":"vmie.amazonaws.com"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"sts:ExternalId":"vmimport"}}}}`,
+			want:   true,
+		},
+		{
+			name:   "listed values",
+			policy: `{"Statement":[{"Effect":"Allow","Principal":{"Service":["ec2.amazonaws.com","vmie.amazonaws.com"]},"Action":["sts:AssumeRole"],"Condition":{"StringEquals":{"sts:externalid":["vmimport"]}}}]}`,
+			want:   true,
+		},
+		{
+			name:   "principal only in a condition",
+			policy: `{"Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"aws:SourceArn":"vmie.amazonaws.com"}}}]}`,
+		},
+		{
+			name:   "missing external id",
+			policy: `{"Statement":[{"Effect":"Allow","Principal":{"Service":"vmie.amazonaws.com"},"Action":"sts:AssumeRole"}]}`,
+		},
+		{
+			name:   "other external id",
+			policy: `{"Statement":[{"Effect":"Allow","Principal":{"Service":"vmie.amazonaws.com"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"sts:ExternalId":"other"}}}]}`,
+		},
+		{
+			name:   "denied",
+			policy: `{"Statement":[{"Effect":"Deny","Principal":{"Service":"vmie.amazonaws.com"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"sts:ExternalId":"vmimport"}}}]}`,
+		},
+		{
+			name:   "any principal",
+			policy: `{"Statement":[{"Effect":"Allow","Principal":"*","Action":"sts:AssumeRole"},{"Effect":"Allow","Principal":{"Service":"vmie.amazonaws.com"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"sts:ExternalId":"vmimport"}}}]}`,
+			want:   true,
+		},
+		{name: "invalid", policy: `vmie.amazonaws.com`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := trustsVMImport(tt.policy)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: trustsVMImport() = %v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: trustsVMImport() returned error: %v", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("%s: trustsVMImport() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
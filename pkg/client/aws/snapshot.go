@@ -0,0 +1,266 @@
+package aws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+)
+
+const (
+	OrigSnapshotTagKey = "original-snapshot"
+
+	DefaultSnapshotArchitecture = types.ArchitectureValuesX8664
+	DefaultSnapshotBootMode     = types.BootModeValuesLegacyBios
+
+	snapshotRootDeviceName = "/dev/xvda"
+)
+
+func (c *client) FindSnapshotById(snapshotId string) (*types.Snapshot, error) {
+	params := &ec2.DescribeSnapshotsInput{
+		SnapshotIds: []string{snapshotId},
+	}
+
+	snapshotListOutput, err := c.ec2Client.DescribeSnapshots(c.context(), params, func(o *ec2.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(snapshotListOutput.Snapshots) == 0 {
+		return nil, fmt.Errorf("snapshot with id %s not found", snapshotId)
+	}
+
+	snapshot := snapshotListOutput.Snapshots[0]
+	return &snapshot, nil
+}
+
+// FindSnapshotCopy looks for a copy of snapshotId previously made in the
+// client's account by CopySnapshot.
+func (c *client) FindSnapshotCopy(snapshotId string, accountId string) (*types.Snapshot, bool, error) {
+	filterTagName := fmt.Sprintf("tag:%s", OrigSnapshotTagKey)
+	params := &ec2.DescribeSnapshotsInput{
+		Filters: []types.Filter{
+			{
+				Name:   &filterTagName,
+				Values: []string{snapshotId},
+			},
+		},
+		OwnerIds: []string{accountId},
+	}
+
+	snapshotListOutput, err := c.ec2Client.DescribeSnapshots(c.context(), params, func(o *ec2.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, snapshot := range snapshotListOutput.Snapshots {
+		if snapshot.State == types.SnapshotStateError {
+			continue
+		}
+		return &snapshot, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// CopySnapshot copies snapshotId into the client's account, re-encrypting it
+// with kmsKeyId when one is given.
+func (c *client) CopySnapshot(snapshotId string, kmsKeyId string) (string, error) {
+	tagSnapshotKey := OrigSnapshotTagKey
+	description := fmt.Sprintf("Copy of snapshot %s for import into KubeVirt cluster", snapshotId)
+	copyInput := &ec2.CopySnapshotInput{
+		SourceSnapshotId: &snapshotId,
+		SourceRegion:     &c.region,
+		Description:      &description,
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeSnapshot,
+				Tags: []types.Tag{
+					{
+						Key:   &tagSnapshotKey,
+						Value: &snapshotId,
+					},
+				},
+			},
+		},
+	}
+
+	if kmsKeyId != "" {
+		encrypted := true
+		copyInput.Encrypted = &encrypted
+		copyInput.KmsKeyId = &kmsKeyId
+	}
+
+	copyOutput, err := c.ec2Client.CopySnapshot(c.context(), copyInput, func(o *ec2.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if copyOutput.SnapshotId == nil {
+		return "", fmt.Errorf("Snapshot id for copied snapshot not present")
+	}
+
+	return *copyOutput.SnapshotId, nil
+}
+
+func (c *client) DeleteSnapshot(snapshotId string) error {
+	_, err := c.ec2Client.DeleteSnapshot(c.context(), &ec2.DeleteSnapshotInput{SnapshotId: &snapshotId}, func(o *ec2.Options) {
+		o.Region = c.region
+	})
+	return err
+}
+
+func (c *client) IsSnapshotCompleted(snapshotId string) (bool, error) {
+	snapshot, err := c.FindSnapshotById(snapshotId)
+	if err != nil {
+		return false, err
+	}
+
+	switch snapshot.State {
+	case types.SnapshotStateCompleted:
+		return true, nil
+	case types.SnapshotStateError:
+		reason := ""
+		if snapshot.StateMessage != nil {
+			reason = *snapshot.StateMessage
+		}
+		return false, fmt.Errorf("snapshot %s is in state %s: %s", snapshotId, snapshot.State, reason)
+	}
+
+	c.log.V(1).Info("Waiting for snapshot to complete", logging.KeySnapshot, snapshotId, "state", snapshot.State)
+	return false, nil
+}
+
+func (c *client) WaitForSnapshotToComplete(snapshotId string, timeout time.Duration, pollInterval time.Duration) error {
+	ticker := time.NewTicker(timeout).C
+	pollTicker := time.NewTicker(pollInterval).C
+
+	completed, err := c.IsSnapshotCompleted(snapshotId)
+	if err != nil {
+		return err
+	} else if completed {
+		return nil
+	}
+
+	// if not completed, poll until completed or timeout is hit
+	for {
+		select {
+		case <-ticker:
+			return fmt.Errorf("%w waiting for snapshot %s to complete", retry.ErrTimeout, snapshotId)
+		case <-pollTicker:
+			c.log.V(1).Info("Polling snapshot to determine if it is completed", logging.KeySnapshot, snapshotId)
+
+			completed, err := c.IsSnapshotCompleted(snapshotId)
+			if err != nil && retry.Retryable(err) {
+				c.log.Error(err, "Error encountered looking up snapshot", logging.KeySnapshot, snapshotId)
+				continue
+			} else if err != nil {
+				return err
+			} else if completed {
+				c.log.Info("Snapshot is completed", logging.KeySnapshot, snapshotId)
+				return nil
+			}
+		}
+	}
+}
+
+// DetectSnapshotImageSettings returns the architecture and boot mode of an
+// existing AMI backed by snapshotId. The snapshot itself carries no such
+// metadata, so when no AMI references it the defaults are returned and
+// found is false.
+func (c *client) DetectSnapshotImageSettings(snapshotId string, ownerId string) (arch types.ArchitectureValues, bootMode types.BootModeValues, found bool, err error) {
+	filterKeyName := "block-device-mapping.snapshot-id"
+	params := &ec2.DescribeImagesInput{
+		Filters: []types.Filter{
+			{
+				Name:   &filterKeyName,
+				Values: []string{snapshotId},
+			},
+		},
+		Owners: []string{ownerId},
+	}
+
+	amiListOutput, err := c.ec2Client.DescribeImages(c.context(), params, func(o *ec2.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return "", "", false, err
+	}
+
+	arch = DefaultSnapshotArchitecture
+	bootMode = DefaultSnapshotBootMode
+	if len(amiListOutput.Images) == 0 {
+		return arch, bootMode, false, nil
+	}
+
+	image := amiListOutput.Images[0]
+	if image.Architecture != "" {
+		arch = image.Architecture
+	}
+	if image.BootMode != "" {
+		bootMode = image.BootMode
+	}
+	return arch, bootMode, true, nil
+}
+
+func (c *client) SnapshotImageName(snapshotId string) string {
+	return fmt.Sprintf("kubevirt-export-automation-snapshot-%s", snapshotId)
+}
+
+// RegisterImageFromSnapshot registers a temporary HVM AMI whose root device
+// is backed by snapshotId so that it can be run through the AMI export path.
+func (c *client) RegisterImageFromSnapshot(snapshotId string, amiName string, arch types.ArchitectureValues, bootMode types.BootModeValues) (string, error) {
+	rootDeviceName := snapshotRootDeviceName
+	virtualizationType := string(types.VirtualizationTypeHvm)
+	enaSupport := true
+	deleteOnTermination := true
+	description := fmt.Sprintf("Temporary ami registered from snapshot %s for import into KubeVirt cluster", snapshotId)
+
+	params := &ec2.RegisterImageInput{
+		Name:               &amiName,
+		Description:        &description,
+		Architecture:       arch,
+		BootMode:           bootMode,
+		EnaSupport:         &enaSupport,
+		RootDeviceName:     &rootDeviceName,
+		VirtualizationType: &virtualizationType,
+		BlockDeviceMappings: []types.BlockDeviceMapping{
+			{
+				DeviceName: &rootDeviceName,
+				Ebs: &types.EbsBlockDevice{
+					SnapshotId:          &snapshotId,
+					DeleteOnTermination: &deleteOnTermination,
+				},
+			},
+		},
+	}
+
+	registerOutput, err := c.ec2Client.RegisterImage(c.context(), params, func(o *ec2.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if registerOutput.ImageId == nil {
+		return "", fmt.Errorf("Image id for registered AMI not present")
+	}
+
+	return *registerOutput.ImageId, nil
+}
+
+func (c *client) DeregisterImage(amiId string) error {
+	_, err := c.ec2Client.DeregisterImage(c.context(), &ec2.DeregisterImageInput{ImageId: &amiId}, func(o *ec2.Options) {
+		o.Region = c.region
+	})
+	return err
+}
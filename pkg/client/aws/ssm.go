@@ -0,0 +1,24 @@
+package aws
+
+import (
+	"fmt"
+
+	sdkaws "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// GetSSMParameter returns the value of an SSM parameter, such as the public
+// parameters under /aws/service/ naming the latest AMI of a distribution.
+func (c *client) GetSSMParameter(name string) (string, error) {
+	output, err := c.ssmClient.GetParameter(c.context(), &ssm.GetParameterInput{Name: &name}, func(o *ssm.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if output.Parameter == nil || sdkaws.ToString(output.Parameter.Value) == "" {
+		return "", fmt.Errorf("ssm parameter %s has no value", name)
+	}
+	return sdkaws.ToString(output.Parameter.Value), nil
+}
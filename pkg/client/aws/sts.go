@@ -0,0 +1,76 @@
+package aws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const (
+	s3ReadRoleSessionName = "kubevirt-cloud-import-read"
+)
+
+// TemporaryCredentials are short-lived credentials returned by STS.
+type TemporaryCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// S3ObjectReadPolicy is a session policy narrowing a role down to reading a
+// single object.
+func S3ObjectReadPolicy(bucket string, key string) PolicyDocument {
+	return PolicyDocument{
+		Version: policyVersion,
+		Statement: []PolicyStatement{
+			{
+				Effect:   "Allow",
+				Action:   []string{"s3:GetObject"},
+				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/%s", bucket, key)},
+			},
+		},
+	}
+}
+
+// MintS3ObjectReadCredentials assumes roleArn with an inline session policy
+// so that the returned credentials can only read the object at key, and only
+// for duration.
+func (c *client) MintS3ObjectReadCredentials(roleArn string, bucket string, key string, duration time.Duration) (*TemporaryCredentials, error) {
+	policy, err := jsonString(S3ObjectReadPolicy(bucket, key))
+	if err != nil {
+		return nil, err
+	}
+
+	roleSessionName := s3ReadRoleSessionName
+	durationSeconds := int32(duration / time.Second)
+	params := &sts.AssumeRoleInput{
+		RoleArn:         &roleArn,
+		RoleSessionName: &roleSessionName,
+		DurationSeconds: &durationSeconds,
+		Policy:          &policy,
+	}
+
+	assumeRoleOutput, err := c.stsClient.AssumeRole(c.context(), params, func(o *sts.Options) {
+		o.Region = c.region
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	creds := assumeRoleOutput.Credentials
+	if creds == nil || creds.AccessKeyId == nil || creds.SecretAccessKey == nil || creds.SessionToken == nil {
+		return nil, fmt.Errorf("AssumeRole of %s returned no credentials", roleArn)
+	}
+
+	temporaryCreds := &TemporaryCredentials{
+		AccessKeyId:     *creds.AccessKeyId,
+		SecretAccessKey: *creds.SecretAccessKey,
+		SessionToken:    *creds.SessionToken,
+	}
+	if creds.Expiration != nil {
+		temporaryCreds.Expiration = *creds.Expiration
+	}
+	return temporaryCreds, nil
+}
@@ -0,0 +1,107 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	sdkaws "github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go/middleware"
+	"kubevirt.io/kubevirt-cloud-import/pkg/tracing"
+)
+
+// WithTraceScope returns a copy of the client recording its calls as spans
+// of scope.
+func (c *client) WithTraceScope(scope *tracing.Scope) *client {
+	traced := *c
+	traced.scope = scope
+	return &traced
+}
+
+// context returns the context the client's calls are made with.
+func (c *client) context() context.Context {
+	return tracing.WithScope(context.Background(), c.scope)
+}
+
+// addTraceMiddleware records every SDK operation made with a context
+// carrying a trace scope as a span of it.
+func addTraceMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CloudImportTrace", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		scope := tracing.ScopeFromContext(ctx)
+		if scope == nil {
+			return next.HandleInitialize(ctx, in)
+		}
+
+		service := awsmiddleware.GetServiceID(ctx)
+		operation := awsmiddleware.GetOperationName(ctx)
+		span := scope.StartChild(service+"."+operation, tracing.SpanKindClient)
+		span.SetAttribute("rpc.system", "aws-api")
+		span.SetAttribute("rpc.service", service)
+		span.SetAttribute("rpc.method", operation)
+		span.SetAttribute("cloud.region", awsmiddleware.GetRegion(ctx))
+		setInputAttributes(span, in.Parameters)
+
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		if requestId, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+			span.SetAttribute("aws.request_id", requestId)
+		}
+		var statusErr interface{ HTTPStatusCode() int }
+		if errors.As(err, &statusErr) {
+			span.SetAttribute("http.status_code", statusErr.HTTPStatusCode())
+		}
+		span.End(err)
+		return out, metadata, err
+	}), middleware.After)
+}
+
+// setInputAttributes records the resources an operation acts on.
+func setInputAttributes(span *tracing.Span, params interface{}) {
+	switch input := params.(type) {
+	case *ec2.DescribeImagesInput:
+		span.SetAttribute("aws.ec2.ami_ids", strings.Join(input.ImageIds, ","))
+	case *ec2.CopyImageInput:
+		span.SetAttribute("aws.ec2.ami_id", sdkaws.ToString(input.SourceImageId))
+		span.SetAttribute("aws.ec2.source_region", sdkaws.ToString(input.SourceRegion))
+	case *ec2.ExportImageInput:
+		span.SetAttribute("aws.ec2.ami_id", sdkaws.ToString(input.ImageId))
+	case *ec2.DescribeExportImageTasksInput:
+		span.SetAttribute("aws.ec2.export_task_ids", strings.Join(input.ExportImageTaskIds, ","))
+	case *ec2.CancelExportTaskInput:
+		span.SetAttribute("aws.ec2.export_task_id", sdkaws.ToString(input.ExportTaskId))
+	case *ec2.DeregisterImageInput:
+		span.SetAttribute("aws.ec2.ami_id", sdkaws.ToString(input.ImageId))
+	case *ec2.DescribeSnapshotsInput:
+		span.SetAttribute("aws.ec2.snapshot_ids", strings.Join(input.SnapshotIds, ","))
+	case *ec2.CopySnapshotInput:
+		span.SetAttribute("aws.ec2.snapshot_id", sdkaws.ToString(input.SourceSnapshotId))
+	case *ec2.DeleteSnapshotInput:
+		span.SetAttribute("aws.ec2.snapshot_id", sdkaws.ToString(input.SnapshotId))
+	case *kms.DescribeKeyInput:
+		span.SetAttribute("aws.kms.key_id", sdkaws.ToString(input.KeyId))
+	case *iam.GetRoleInput:
+		span.SetAttribute("aws.iam.role_name", sdkaws.ToString(input.RoleName))
+	case *iam.CreateRoleInput:
+		span.SetAttribute("aws.iam.role_name", sdkaws.ToString(input.RoleName))
+	case *iam.PutRolePolicyInput:
+		span.SetAttribute("aws.iam.role_name", sdkaws.ToString(input.RoleName))
+	case *iam.SimulatePrincipalPolicyInput:
+		span.SetAttribute("aws.iam.principal_arn", sdkaws.ToString(input.PolicySourceArn))
+	case *ssm.GetParameterInput:
+		span.SetAttribute("aws.ssm.parameter_name", sdkaws.ToString(input.Name))
+	case *s3.HeadObjectInput:
+		span.SetAttribute("aws.s3.bucket", sdkaws.ToString(input.Bucket))
+		span.SetAttribute("aws.s3.key", sdkaws.ToString(input.Key))
+	case *s3.GetObjectInput:
+		span.SetAttribute("aws.s3.bucket", sdkaws.ToString(input.Bucket))
+		span.SetAttribute("aws.s3.key", sdkaws.ToString(input.Key))
+	case *s3.DeleteObjectInput:
+		span.SetAttribute("aws.s3.bucket", sdkaws.ToString(input.Bucket))
+		span.SetAttribute("aws.s3.key", sdkaws.ToString(input.Key))
+	}
+}
@@ -0,0 +1,50 @@
+package cdi
+
+import (
+	"encoding/json"
+
+	authv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CheckAccess asks the API server, with a SelfSubjectAccessReview, whether
+// the client may perform verb on resource in namespace. The reason is only
+// set when the API server provides one.
+func (c *client) CheckAccess(namespace string, group string, resource string, verb string) (allowed bool, reason string, err error) {
+	review := &authv1.SelfSubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: authv1.SchemeGroupVersion.String(),
+			Kind:       "SelfSubjectAccessReview",
+		},
+		Spec: authv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Namespace: namespace,
+				Group:     group,
+				Resource:  resource,
+				Verb:      verb,
+			},
+		},
+	}
+
+	body, err := json.Marshal(review)
+	if err != nil {
+		return false, "", err
+	}
+
+	result := &authv1.SelfSubjectAccessReview{}
+	err = c.coreClient.Post().
+		AbsPath("/apis", authv1.SchemeGroupVersion.Group, authv1.SchemeGroupVersion.Version, "selfsubjectaccessreviews").
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		Do(c.context()).
+		Into(result)
+	if err != nil {
+		return false, "", err
+	}
+
+	reason = result.Status.Reason
+	if result.Status.EvaluationError != "" {
+		reason = result.Status.EvaluationError
+	}
+	return result.Status.Allowed, reason, nil
+}
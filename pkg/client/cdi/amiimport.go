@@ -0,0 +1,78 @@
+package cdi
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"kubevirt.io/kubevirt-cloud-import/pkg/apis/v1alpha1"
+)
+
+const (
+	amiImportResource = "amiimports"
+)
+
+func init() {
+	// the AMIImport REST client shares the client-go codecs
+	utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+}
+
+// ListAMIImports lists the AMIImports of namespace, or of every namespace
+// when namespace is empty.
+func (c *client) ListAMIImports(namespace string) (*v1alpha1.AMIImportList, error) {
+	list := &v1alpha1.AMIImportList{}
+	err := c.amiImportClient.Get().
+		Namespace(namespace).
+		Resource(amiImportResource).
+		VersionedParams(&metav1.ListOptions{}, scheme.ParameterCodec).
+		Do(c.context()).
+		Into(list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *client) GetAMIImport(name string, namespace string) (*v1alpha1.AMIImport, error) {
+	amiImport := &v1alpha1.AMIImport{}
+	err := c.amiImportClient.Get().
+		Namespace(namespace).
+		Resource(amiImportResource).
+		Name(name).
+		Do(c.context()).
+		Into(amiImport)
+	if err != nil {
+		return nil, err
+	}
+	return amiImport, nil
+}
+
+func (c *client) UpdateAMIImport(amiImport *v1alpha1.AMIImport) (*v1alpha1.AMIImport, error) {
+	result := &v1alpha1.AMIImport{}
+	err := c.amiImportClient.Put().
+		Namespace(amiImport.Namespace).
+		Resource(amiImportResource).
+		Name(amiImport.Name).
+		Body(amiImport).
+		Do(c.context()).
+		Into(result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *client) UpdateAMIImportStatus(amiImport *v1alpha1.AMIImport) (*v1alpha1.AMIImport, error) {
+	result := &v1alpha1.AMIImport{}
+	err := c.amiImportClient.Put().
+		Namespace(amiImport.Namespace).
+		Resource(amiImportResource).
+		Name(amiImport.Name).
+		SubResource("status").
+		Body(amiImport).
+		Do(c.context()).
+		Into(result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -1,23 +1,40 @@
 package cdi
 
 import (
-	"context"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
 	"time"
 
+	"github.com/go-logr/logr"
 	k8sv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	cdiclient "kubevirt.io/client-go/generated/containerized-data-importer/clientset/versioned"
 	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1beta1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/apis/v1alpha1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+	"kubevirt.io/kubevirt-cloud-import/pkg/tracing"
+)
+
+const (
+	// DiskFormatRaw is the export format that CDI can write straight to the
+	// volume without a qemu-img conversion.
+	DiskFormatRaw = "raw"
 )
 
 type client struct {
-	cdiClient *cdiclient.Clientset
+	cdiClient       *cdiclient.Clientset
+	coreClient      rest.Interface
+	amiImportClient rest.Interface
+	// scope, when set, records the client's calls as spans.
+	scope *tracing.Scope
+	log   logr.Logger
 }
 
 func NewClient(master string, kubeconfig string) (*client, error) {
@@ -30,11 +47,44 @@ func NewClient(master string, kubeconfig string) (*client, error) {
 	if err != nil {
 		return nil, err
 	}
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &traceTransport{next: rt}
+	})
 	cdiClient, err := cdiclient.NewForConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
-	return &client{cdiClient: cdiClient}, nil
+
+	// core resources such as secrets are reached through a plain REST
+	// client, the typed kubernetes clientset is not vendored
+	coreCfg := rest.CopyConfig(cfg)
+	coreCfg.GroupVersion = &k8sv1.SchemeGroupVersion
+	coreCfg.APIPath = "/api"
+	coreCfg.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+	if coreCfg.UserAgent == "" {
+		coreCfg.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	coreClient, err := rest.RESTClientFor(coreCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	amiImportCfg := rest.CopyConfig(coreCfg)
+	amiImportCfg.GroupVersion = &v1alpha1.SchemeGroupVersion
+	amiImportCfg.APIPath = "/apis"
+	amiImportClient, err := rest.RESTClientFor(amiImportCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{cdiClient: cdiClient, coreClient: coreClient, amiImportClient: amiImportClient, log: logging.Default()}, nil
+}
+
+// WithLogger returns a copy of the client logging to log.
+func (c *client) WithLogger(log logr.Logger) *client {
+	logged := *c
+	logged.log = log
+	return &logged
 }
 
 func (c *client) ImportFromS3IntoPvc(pvcName,
@@ -44,11 +94,37 @@ func (c *client) ImportFromS3IntoPvc(pvcName,
 	s3Bucket,
 	s3FilePath,
 	s3Region,
-	s3SecretName string,
+	s3SecretName,
+	diskFormat string,
 	storageQuantity resource.Quantity,
 
 ) error {
+	dataVolume := NewS3DataVolume(pvcName, pvcNamespace, pvcStorageClass, pvcAccessMode, s3Bucket, s3FilePath, s3Region, s3SecretName, diskFormat, storageQuantity)
+	_, err := c.cdiClient.CdiV1beta1().DataVolumes(dataVolume.Namespace).Create(c.context(), dataVolume, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// NewS3DataVolume returns the DataVolume ImportFromS3IntoPvc creates.
+func NewS3DataVolume(pvcName,
+	pvcNamespace,
+	pvcStorageClass,
+	pvcAccessMode,
+	s3Bucket,
+	s3FilePath,
+	s3Region,
+	s3SecretName,
+	diskFormat string,
+	storageQuantity resource.Quantity,
+
+) *cdiv1.DataVolume {
 	dataVolume := &cdiv1.DataVolume{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: cdiv1.SchemeGroupVersion.String(),
+			Kind:       "DataVolume",
+		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      pvcName,
 			Namespace: pvcNamespace,
@@ -69,22 +145,24 @@ func (c *client) ImportFromS3IntoPvc(pvcName,
 		},
 	}
 
+	if diskFormat == DiskFormatRaw {
+		// a raw export is the disk itself and is written to the volume as
+		// is, declare it rather than relying on the detection of CDI
+		dataVolume.Spec.ContentType = cdiv1.DataVolumeKubeVirt
+	}
+
 	if pvcStorageClass != "" {
 		dataVolume.Spec.PVC.StorageClassName = &pvcStorageClass
 	}
 
 	dataVolume.Spec.PVC.Resources.Requests[k8sv1.ResourceStorage] = storageQuantity
-	_, err := c.cdiClient.CdiV1beta1().DataVolumes(dataVolume.Namespace).Create(context.Background(), dataVolume, metav1.CreateOptions{})
-	if err != nil && !errors.IsAlreadyExists(err) {
-		return err
-	}
-	return nil
+	return dataVolume
 }
 
 func (c *client) getDataVolumePhase(name string, namespace string) (cdiv1.DataVolumePhase, error) {
 
-	dv, err := c.cdiClient.CdiV1beta1().DataVolumes(namespace).Get(context.Background(), name, metav1.GetOptions{})
-	if err != nil && !errors.IsAlreadyExists(err) {
+	dv, err := c.cdiClient.CdiV1beta1().DataVolumes(namespace).Get(c.context(), name, metav1.GetOptions{})
+	if err != nil {
 		return cdiv1.PhaseUnset, err
 	}
 
@@ -92,13 +170,14 @@ func (c *client) getDataVolumePhase(name string, namespace string) (cdiv1.DataVo
 
 }
 
-func (c *client) WaitForS3ImportCompletion(pvcName string, pvcNamespace string, timeout time.Duration) error {
+func (c *client) WaitForS3ImportCompletion(pvcName string, pvcNamespace string, timeout time.Duration, pollInterval time.Duration) error {
 	var completed bool
 	ticker := time.NewTicker(timeout).C
-	pollTicker := time.NewTicker(time.Second * 15).C
+	pollTicker := time.NewTicker(pollInterval).C
 
+	log := c.log.WithValues(logging.KeyDataVolume, pvcName, logging.KeyNamespace, pvcNamespace)
 	fn := func() (bool, error) {
-		log.Printf("Polling DataVolume %s/%s to determine if import is completed", pvcNamespace, pvcName)
+		log.V(1).Info("Polling DataVolume to determine if import is completed")
 		phase, err := c.getDataVolumePhase(pvcName, pvcNamespace)
 		if err != nil {
 			return false, err
@@ -121,10 +200,13 @@ func (c *client) WaitForS3ImportCompletion(pvcName string, pvcNamespace string,
 	for {
 		select {
 		case <-ticker:
-			return fmt.Errorf("timed out waiting for datavolume %s/%s to complete", pvcNamespace, pvcName)
+			return fmt.Errorf("%w waiting for datavolume %s/%s to complete", retry.ErrTimeout, pvcNamespace, pvcName)
 		case <-pollTicker:
 			completed, err := fn()
-			if err != nil {
+			if err != nil && retry.Retryable(err) {
+				log.Error(err, "Error encountered looking up DataVolume")
+				continue
+			} else if err != nil {
 				return err
 			} else if completed {
 				return nil
@@ -132,3 +214,15 @@ func (c *client) WaitForS3ImportCompletion(pvcName string, pvcNamespace string,
 		}
 	}
 }
+
+func (c *client) GetDataVolume(name string, namespace string) (*cdiv1.DataVolume, error) {
+	return c.cdiClient.CdiV1beta1().DataVolumes(namespace).Get(c.context(), name, metav1.GetOptions{})
+}
+
+func (c *client) DeleteDataVolume(name string, namespace string) error {
+	err := c.cdiClient.CdiV1beta1().DataVolumes(namespace).Delete(c.context(), name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
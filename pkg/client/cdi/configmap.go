@@ -0,0 +1,64 @@
+package cdi
+
+import (
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+func (c *client) GetConfigMap(name string, namespace string) (*k8sv1.ConfigMap, error) {
+	configMap := &k8sv1.ConfigMap{}
+	err := c.coreClient.Get().
+		Namespace(namespace).
+		Resource("configmaps").
+		Name(name).
+		Do(c.context()).
+		Into(configMap)
+	if err != nil {
+		return nil, err
+	}
+	return configMap, nil
+}
+
+// CreateOrUpdateConfigMap creates configMap, or replaces the data of an
+// existing config map with the same name.
+func (c *client) CreateOrUpdateConfigMap(configMap *k8sv1.ConfigMap) (created bool, err error) {
+	err = c.coreClient.Post().
+		Namespace(configMap.Namespace).
+		Resource("configmaps").
+		Body(configMap).
+		Do(c.context()).
+		Error()
+	if err == nil {
+		return true, nil
+	} else if !errors.IsAlreadyExists(err) {
+		return false, err
+	}
+
+	existing, err := c.GetConfigMap(configMap.Name, configMap.Namespace)
+	if err != nil {
+		return false, err
+	}
+	existing.Data = configMap.Data
+
+	err = c.coreClient.Put().
+		Namespace(existing.Namespace).
+		Resource("configmaps").
+		Name(existing.Name).
+		Body(existing).
+		Do(c.context()).
+		Error()
+	return false, err
+}
+
+func (c *client) DeleteConfigMap(name string, namespace string) error {
+	err := c.coreClient.Delete().
+		Namespace(namespace).
+		Resource("configmaps").
+		Name(name).
+		Do(c.context()).
+		Error()
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cdi
+
+import (
+	"fmt"
+	"strconv"
+
+	k8sv1 "k8s.io/api/core/v1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/disk"
+)
+
+const (
+	AnnConversion        = "cloud-import.kubevirt.io/conversion"
+	AnnConversionMessage = "cloud-import.kubevirt.io/conversion-message"
+
+	ConversionSucceeded = "succeeded"
+	ConversionFailed    = "failed"
+
+	convertJobNameFormat = "%s-convert"
+)
+
+func ConversionJobName(pvcName string) string {
+	return fmt.Sprintf(convertJobNameFormat, pvcName)
+}
+
+// CreateConversionJob starts a job that mounts the imported pvc read-write
+// and runs the convert-disk command of image against it, converting the
+// guest as opts selects.
+func (c *client) CreateConversionJob(pvcName string, namespace string, image string, opts disk.ConversionOptions) (string, error) {
+	container := k8sv1.Container{
+		Name:  "convert-disk",
+		Image: image,
+		Args: []string{
+			"convert-disk",
+			"--tool", opts.Tool,
+			"--remove-cloud-agents=" + strconv.FormatBool(opts.RemoveCloudAgents),
+			"--reset-network-naming=" + strconv.FormatBool(opts.ResetNetworkNaming),
+		},
+		Env: []k8sv1.EnvVar{
+			// libvirt does not run in the job, the appliance is started
+			// directly
+			{Name: "LIBGUESTFS_BACKEND", Value: "direct"},
+			{Name: "HOME", Value: "/tmp"},
+		},
+		TerminationMessagePolicy: k8sv1.TerminationMessageFallbackToLogsOnError,
+	}
+
+	jobName := ConversionJobName(pvcName)
+	err := c.createDiskJob(jobName, pvcName, namespace, container, false)
+	if err != nil {
+		return "", err
+	}
+	return jobName, nil
+}
@@ -0,0 +1,61 @@
+package cdi
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EventComponent is the source component of the events recorded by imports.
+const EventComponent = "import-ami"
+
+// NewEvent builds an event about object, named after it the way client-go's
+// recorder names events.
+func NewEvent(object *k8sv1.ObjectReference, eventType string, reason string, message string) *k8sv1.Event {
+	now := metav1.NewTime(time.Now())
+	host, _ := os.Hostname()
+	return &k8sv1.Event{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Event",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", object.Name, now.UnixNano()),
+			Namespace: object.Namespace,
+		},
+		InvolvedObject: *object,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source: k8sv1.EventSource{
+			Component: EventComponent,
+			Host:      host,
+		},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+}
+
+func (c *client) CreateEvent(event *k8sv1.Event) error {
+	return c.coreClient.Post().
+		Namespace(event.Namespace).
+		Resource("events").
+		Body(event).
+		Do(c.context()).
+		Error()
+}
+
+// UpdateEvent replaces event, such as one counting repeated occurrences.
+func (c *client) UpdateEvent(event *k8sv1.Event) error {
+	return c.coreClient.Put().
+		Namespace(event.Namespace).
+		Resource("events").
+		Name(event.Name).
+		Body(event).
+		Do(c.context()).
+		Error()
+}
@@ -0,0 +1,138 @@
+package cdi
+
+import (
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1beta1"
+)
+
+const (
+	// S3SecretAccessKeyIdKey and S3SecretKeyKey are the keys CDI reads S3
+	// credentials from.
+	S3SecretAccessKeyIdKey = "accessKeyId"
+	S3SecretKeyKey         = "secretKey"
+	// S3SecretSessionTokenKey holds the session token of temporary
+	// credentials, such as those minted for each import, and is optional.
+	S3SecretSessionTokenKey = "sessionToken"
+)
+
+// NewS3CredentialSecret builds a secret in the format CDI expects for
+// DataVolumes with an S3 source. sessionToken is only stored when set.
+func NewS3CredentialSecret(name string, namespace string, accessKeyId string, secretKey string, sessionToken string) *k8sv1.Secret {
+	secret := &k8sv1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app": "containerized-data-importer",
+			},
+		},
+		Type: k8sv1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			S3SecretAccessKeyIdKey: []byte(accessKeyId),
+			S3SecretKeyKey:         []byte(secretKey),
+		},
+	}
+	if sessionToken != "" {
+		secret.Data[S3SecretSessionTokenKey] = []byte(sessionToken)
+	}
+	return secret
+}
+
+func (c *client) GetSecret(name string, namespace string) (*k8sv1.Secret, error) {
+	secret := &k8sv1.Secret{}
+	err := c.coreClient.Get().
+		Namespace(namespace).
+		Resource("secrets").
+		Name(name).
+		Do(c.context()).
+		Into(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// CreateOrUpdateSecret creates secret, or replaces the data of an existing
+// secret with the same name.
+func (c *client) CreateOrUpdateSecret(secret *k8sv1.Secret) (created bool, err error) {
+	err = c.coreClient.Post().
+		Namespace(secret.Namespace).
+		Resource("secrets").
+		Body(secret).
+		Do(c.context()).
+		Error()
+	if err == nil {
+		return true, nil
+	} else if !errors.IsAlreadyExists(err) {
+		return false, err
+	}
+
+	existing, err := c.GetSecret(secret.Name, secret.Namespace)
+	if err != nil {
+		return false, err
+	}
+	existing.Data = secret.Data
+	if existing.Labels == nil {
+		existing.Labels = map[string]string{}
+	}
+	for key, value := range secret.Labels {
+		existing.Labels[key] = value
+	}
+
+	err = c.coreClient.Put().
+		Namespace(existing.Namespace).
+		Resource("secrets").
+		Name(existing.Name).
+		Body(existing).
+		Do(c.context()).
+		Error()
+	return false, err
+}
+
+func (c *client) DeleteSecret(name string, namespace string) error {
+	err := c.coreClient.Delete().
+		Namespace(namespace).
+		Resource("secrets").
+		Name(name).
+		Do(c.context()).
+		Error()
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// CreateDataVolumeSecret creates secret owned by the DataVolume dvName, so
+// that it is garbage collected along with the DataVolume. A secret of the
+// same name, such as one holding expired credentials of an earlier run, is
+// replaced.
+func (c *client) CreateDataVolumeSecret(secret *k8sv1.Secret, dvName string) error {
+	dv, err := c.cdiClient.CdiV1beta1().DataVolumes(secret.Namespace).Get(c.context(), dvName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	secret.OwnerReferences = []metav1.OwnerReference{
+		{
+			APIVersion: cdiv1.SchemeGroupVersion.String(),
+			Kind:       "DataVolume",
+			Name:       dv.Name,
+			UID:        dv.UID,
+		},
+	}
+
+	if err := c.DeleteSecret(secret.Name, secret.Namespace); err != nil {
+		return err
+	}
+	return c.coreClient.Post().
+		Namespace(secret.Namespace).
+		Resource("secrets").
+		Body(secret).
+		Do(c.context()).
+		Error()
+}
@@ -0,0 +1,100 @@
+package cdi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/tracing"
+)
+
+// WithTraceScope returns a copy of the client recording its calls as spans
+// of scope.
+func (c *client) WithTraceScope(scope *tracing.Scope) *client {
+	traced := *c
+	traced.scope = scope
+	return &traced
+}
+
+// context returns the context the client's calls are made with.
+func (c *client) context() context.Context {
+	return tracing.WithScope(context.Background(), c.scope)
+}
+
+// traceTransport records the requests made with a context carrying a trace
+// scope as spans of it.
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	scope := tracing.ScopeFromContext(req.Context())
+	if scope == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	verb, resource, namespace, name := describeRequest(req)
+	span := scope.StartChild(fmt.Sprintf("kubernetes %s %s", verb, resource), tracing.SpanKindClient)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.target", req.URL.Path)
+	span.SetAttribute("k8s.namespace.name", namespace)
+	span.SetAttribute("k8s.resource.name", name)
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		span.SetAttribute("http.status_code", resp.StatusCode)
+		if resp.StatusCode >= 400 {
+			err = fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+		}
+	}
+	span.End(err)
+	return resp, err
+}
+
+// describeRequest splits the path of a request to the API server, such as
+// /api/v1/namespaces/default/configmaps/name or
+// /apis/cdi.kubevirt.io/v1beta1/namespaces/default/datavolumes, into the
+// verb, resource, namespace and name it acts on.
+func describeRequest(req *http.Request) (verb string, resource string, namespace string, name string) {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	// skip the api prefix, group and version
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		segments = segments[3:]
+	}
+	if len(segments) >= 2 && segments[0] == "namespaces" {
+		namespace = segments[1]
+		segments = segments[2:]
+	}
+	if len(segments) > 0 {
+		resource = segments[0]
+	}
+	if len(segments) > 1 {
+		name = segments[1]
+	}
+	if len(segments) > 2 {
+		resource = resource + "/" + strings.Join(segments[2:], "/")
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		verb = "get"
+		if name == "" {
+			verb = "list"
+		}
+	case http.MethodPost:
+		verb = "create"
+	case http.MethodPut:
+		verb = "update"
+	case http.MethodPatch:
+		verb = "patch"
+	case http.MethodDelete:
+		verb = "delete"
+	default:
+		verb = strings.ToLower(req.Method)
+	}
+	return verb, resource, namespace, name
+}
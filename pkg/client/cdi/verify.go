@@ -0,0 +1,379 @@
+package cdi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+)
+
+const (
+	AnnSourceETag          = "cloud-import.kubevirt.io/source-etag"
+	AnnSourceSize          = "cloud-import.kubevirt.io/source-size"
+	AnnSourceVirtualSize   = "cloud-import.kubevirt.io/source-virtual-size"
+	AnnSourceSHA256        = "cloud-import.kubevirt.io/source-sha256"
+	AnnVerification        = "cloud-import.kubevirt.io/verification"
+	AnnVerificationMessage = "cloud-import.kubevirt.io/verification-message"
+	// AnnJobSpecSHA256 is the hash of the pod template of a disk job, which
+	// tells a job left by an earlier run apart from a stale one.
+	AnnJobSpecSHA256 = "cloud-import.kubevirt.io/job-spec-sha256"
+
+	VerificationPassed = "passed"
+	VerificationFailed = "failed"
+
+	verifyJobNameFormat = "%s-verify"
+	jobDiskPath         = "/pvc/disk.img"
+	jobDevicePath       = "/dev/cloud-import-disk"
+	// jobUser is the uid of the import-ami image. Jobs run as it, with it as
+	// their group and fsGroup so they can read and write disk.img. Block
+	// devices are not chowned to the fsGroup, they are only accessible when
+	// the container runtime hands devices to the user of the pod, as
+	// KubeVirt requires for non-root VMs.
+	jobUser = int64(1001)
+
+	// jobReplaceAttempts bounds the wait for a stale job to be deleted.
+	jobReplaceAttempts = 30
+)
+
+func (c *client) GetPvc(name string, namespace string) (*k8sv1.PersistentVolumeClaim, error) {
+	pvc := &k8sv1.PersistentVolumeClaim{}
+	err := c.coreClient.Get().
+		Namespace(namespace).
+		Resource("persistentvolumeclaims").
+		Name(name).
+		Do(c.context()).
+		Into(pvc)
+	if err != nil {
+		return nil, err
+	}
+	return pvc, nil
+}
+
+// AnnotatePvc merges annotations into those of the pvc.
+func (c *client) AnnotatePvc(name string, namespace string, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.coreClient.Patch(types.MergePatchType).
+		Namespace(namespace).
+		Resource("persistentvolumeclaims").
+		Name(name).
+		Body(patch).
+		Do(c.context()).
+		Error()
+}
+
+// LabelPvc merges labels and annotations into the metadata of the pvc.
+func (c *client) LabelPvc(name string, namespace string, labels map[string]string, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      labels,
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.coreClient.Patch(types.MergePatchType).
+		Namespace(namespace).
+		Resource("persistentvolumeclaims").
+		Name(name).
+		Body(patch).
+		Do(c.context()).
+		Error()
+}
+
+// ListPvcs lists the pvcs of namespace matching the label selector.
+func (c *client) ListPvcs(namespace string, selector string) ([]k8sv1.PersistentVolumeClaim, error) {
+	list := &k8sv1.PersistentVolumeClaimList{}
+	err := c.coreClient.Get().
+		Namespace(namespace).
+		Resource("persistentvolumeclaims").
+		VersionedParams(&metav1.ListOptions{LabelSelector: selector}, scheme.ParameterCodec).
+		Do(c.context()).
+		Into(list)
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c *client) DeletePvc(name string, namespace string) error {
+	err := c.coreClient.Delete().
+		Namespace(namespace).
+		Resource("persistentvolumeclaims").
+		Name(name).
+		Do(c.context()).
+		Error()
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func VerificationJobName(pvcName string) string {
+	return fmt.Sprintf(verifyJobNameFormat, pvcName)
+}
+
+// CreateVerificationJob starts a job that mounts the imported pvc and runs
+// the verify-disk command of image against it, comparing the first
+// virtualSize bytes of the disk with sha256.
+func (c *client) CreateVerificationJob(pvcName string, namespace string, image string, virtualSize int64, sha256 string) (string, error) {
+	container := k8sv1.Container{
+		Name:  "verify-disk",
+		Image: image,
+		Args: []string{
+			"verify-disk",
+			"--virtual-size", strconv.FormatInt(virtualSize, 10),
+			"--sha256", sha256,
+		},
+		TerminationMessagePolicy: k8sv1.TerminationMessageFallbackToLogsOnError,
+	}
+
+	jobName := VerificationJobName(pvcName)
+	err := c.createDiskJob(jobName, pvcName, namespace, container, true)
+	if err != nil {
+		return "", err
+	}
+	return jobName, nil
+}
+
+// createDiskJob creates a job running container against the disk of the
+// pvc, passed to it with --path. A job of the same name left by an
+// interrupted run is reused when it runs the same pod, and replaced
+// otherwise.
+func (c *client) createDiskJob(jobName string, pvcName string, namespace string, container k8sv1.Container, readOnly bool) error {
+	pvc, err := c.GetPvc(pvcName, namespace)
+	if err != nil {
+		return err
+	}
+
+	// block volumes are attached as a device, filesystem volumes hold the
+	// disk as a file
+	if pvc.Spec.VolumeMode != nil && *pvc.Spec.VolumeMode == k8sv1.PersistentVolumeBlock {
+		container.Args = append(container.Args, "--path", jobDevicePath)
+		container.VolumeDevices = []k8sv1.VolumeDevice{{Name: "disk", DevicePath: jobDevicePath}}
+	} else {
+		container.Args = append(container.Args, "--path", jobDiskPath)
+		container.VolumeMounts = []k8sv1.VolumeMount{{Name: "disk", MountPath: "/pvc", ReadOnly: readOnly}}
+	}
+
+	backoffLimit := int32(0)
+	user := jobUser
+	job := &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: batchv1.SchemeGroupVersion.String(),
+			Kind:       "Job",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app": "kubevirt-cloud-import",
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: k8sv1.PodTemplateSpec{
+				Spec: k8sv1.PodSpec{
+					RestartPolicy: k8sv1.RestartPolicyNever,
+					SecurityContext: &k8sv1.PodSecurityContext{
+						RunAsUser:  &user,
+						RunAsGroup: &user,
+						FSGroup:    &user,
+					},
+					Containers: []k8sv1.Container{container},
+					Volumes: []k8sv1.Volume{
+						{
+							Name: "disk",
+							VolumeSource: k8sv1.VolumeSource{
+								PersistentVolumeClaim: &k8sv1.PersistentVolumeClaimVolumeSource{
+									ClaimName: pvcName,
+									ReadOnly:  readOnly,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	spec, err := json.Marshal(job.Spec.Template)
+	if err != nil {
+		return err
+	}
+	specSum := sha256.Sum256(spec)
+	job.Annotations = map[string]string{AnnJobSpecSHA256: hex.EncodeToString(specSum[:])}
+
+	err = c.postJob(job)
+	if !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing, err := c.getJob(jobName, namespace)
+	if errors.IsNotFound(err) {
+		return c.postJob(job)
+	} else if err != nil {
+		return err
+	} else if existing.Annotations[AnnJobSpecSHA256] == job.Annotations[AnnJobSpecSHA256] {
+		return nil
+	}
+
+	c.log.Info("Replacing Job of an earlier run with different arguments", "job", jobName, logging.KeyNamespace, namespace)
+	err = c.DeleteJob(jobName, namespace)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = c.postJob(job)
+		if !errors.IsAlreadyExists(err) || attempt == jobReplaceAttempts {
+			return err
+		}
+		// the job is only gone once its finalizers are removed
+		time.Sleep(time.Second)
+	}
+}
+
+func (c *client) postJob(job *batchv1.Job) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return c.coreClient.Post().
+		AbsPath("/apis", batchv1.SchemeGroupVersion.Group, batchv1.SchemeGroupVersion.Version, "namespaces", job.Namespace, "jobs").
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		Do(c.context()).
+		Error()
+}
+
+func (c *client) getJob(name string, namespace string) (*batchv1.Job, error) {
+	job := &batchv1.Job{}
+	err := c.coreClient.Get().
+		AbsPath("/apis", batchv1.SchemeGroupVersion.Group, batchv1.SchemeGroupVersion.Version, "namespaces", namespace, "jobs", name).
+		Do(c.context()).
+		Into(job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// jobTerminationMessage returns the termination message of the job's most
+// recently terminated pod.
+func (c *client) jobTerminationMessage(name string, namespace string) (string, error) {
+	pods := &k8sv1.PodList{}
+	err := c.coreClient.Get().
+		Namespace(namespace).
+		Resource("pods").
+		VersionedParams(&metav1.ListOptions{LabelSelector: fmt.Sprintf("job-name=%s", name)}, scheme.ParameterCodec).
+		Do(c.context()).
+		Into(pods)
+	if err != nil {
+		return "", err
+	}
+
+	message := ""
+	var finishedAt time.Time
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			terminated := status.State.Terminated
+			if terminated != nil && !terminated.FinishedAt.Time.Before(finishedAt) {
+				message = terminated.Message
+				finishedAt = terminated.FinishedAt.Time
+			}
+		}
+	}
+	return message, nil
+}
+
+// WaitForJobCompletion waits for the job to succeed or fail and returns the
+// termination message of its pod.
+func (c *client) WaitForJobCompletion(name string, namespace string, timeout time.Duration, pollInterval time.Duration) (succeeded bool, message string, err error) {
+	ticker := time.NewTicker(timeout).C
+	pollTicker := time.NewTicker(pollInterval).C
+
+	log := c.log.WithValues("job", name, logging.KeyNamespace, namespace)
+	fn := func() (bool, bool, error) {
+		log.V(1).Info("Polling Job to determine if it is completed")
+		job, err := c.getJob(name, namespace)
+		if err != nil {
+			return false, false, err
+		}
+		for _, condition := range job.Status.Conditions {
+			if condition.Status != k8sv1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case batchv1.JobComplete:
+				return true, true, nil
+			case batchv1.JobFailed:
+				return true, false, nil
+			}
+		}
+		return false, false, nil
+	}
+
+	completed, succeeded, err := fn()
+	for err == nil && !completed {
+		select {
+		case <-ticker:
+			return false, "", fmt.Errorf("%w waiting for job %s/%s to complete", retry.ErrTimeout, namespace, name)
+		case <-pollTicker:
+			completed, succeeded, err = fn()
+			if err != nil && retry.Retryable(err) {
+				log.Error(err, "Error encountered looking up Job")
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	message, err = c.jobTerminationMessage(name, namespace)
+	if err != nil {
+		return false, "", err
+	}
+	return succeeded, message, nil
+}
+
+// DeleteJob deletes the job along with its pods.
+func (c *client) DeleteJob(name string, namespace string) error {
+	propagation := metav1.DeletePropagationBackground
+	body, err := json.Marshal(&metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil {
+		return err
+	}
+
+	err = c.coreClient.Delete().
+		AbsPath("/apis", batchv1.SchemeGroupVersion.Group, batchv1.SchemeGroupVersion.Version, "namespaces", namespace, "jobs", name).
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		Do(c.context()).
+		Error()
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,395 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	k8sv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1beta1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/apis/v1alpha1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+	"kubevirt.io/kubevirt-cloud-import/pkg/notify"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+	"kubevirt.io/kubevirt-cloud-import/pkg/tracing"
+)
+
+const (
+	maxConflictRetries = 5
+
+	// keyAMIImport is the log key of the AMIImport, as namespace/name.
+	keyAMIImport = "amiImport"
+)
+
+// Client is the cluster client the controller reconciles with.
+type Client interface {
+	importer.CDIClient
+	importer.EventClient
+
+	ListAMIImports(namespace string) (*v1alpha1.AMIImportList, error)
+	GetAMIImport(name string, namespace string) (*v1alpha1.AMIImport, error)
+	UpdateAMIImport(amiImport *v1alpha1.AMIImport) (*v1alpha1.AMIImport, error)
+	UpdateAMIImportStatus(amiImport *v1alpha1.AMIImport) (*v1alpha1.AMIImport, error)
+
+	GetSecret(name string, namespace string) (*k8sv1.Secret, error)
+	GetDataVolume(name string, namespace string) (*cdiv1.DataVolume, error)
+}
+
+// AWSClientFactory creates the aws client of an import, recording its calls
+// into scope and logging to log.
+type AWSClientFactory func(region string, creds aws.Credentials, scope *tracing.Scope, log logr.Logger) (importer.AWSClient, error)
+
+// CDIClientFactory returns a copy of the cluster client recording the calls
+// of an import into scope and logging to log.
+type CDIClientFactory func(scope *tracing.Scope, log logr.Logger) importer.CDIClient
+
+// Controller reconciles AMIImports. Without informers it lists AMIImports
+// every resync period and queues each of them, and runs every import in its
+// own goroutine so that a reconcile never waits on AWS.
+type Controller struct {
+	client       Client
+	newAWSClient AWSClientFactory
+	namespace    string
+	maxImports   int
+	resyncPeriod time.Duration
+	log          logr.Logger
+
+	// tracer, when set, records every import as a trace.
+	tracer *tracing.Tracer
+	// newCDIClient, when set, returns the cluster client of each import.
+	newCDIClient CDIClientFactory
+	// notifier, when set, is sent the result of imports without
+	// notification settings of their own.
+	notifier *notify.Notifier
+	// notifyHosts are the hosts AMIImports may post their result to.
+	notifyHosts map[string]bool
+	// timeouts, pollInterval and retry bound the steps of every import,
+	// the importer's defaults when unset.
+	timeouts     importer.Timeouts
+	pollInterval time.Duration
+	retry        retry.Policy
+
+	queue workqueue.RateLimitingInterface
+
+	mu      sync.Mutex
+	running map[string]*importer.Importer
+}
+
+// New creates a controller of the AMIImports in namespace, or in every
+// namespace when it is empty, running at most maxImports imports at once.
+func New(client Client, newAWSClient AWSClientFactory, namespace string, maxImports int, resyncPeriod time.Duration) *Controller {
+	return &Controller{
+		client:       client,
+		newAWSClient: newAWSClient,
+		namespace:    namespace,
+		maxImports:   maxImports,
+		resyncPeriod: resyncPeriod,
+		log:          logging.Default().WithName("controller"),
+		queue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "amiimports"),
+		running:      map[string]*importer.Importer{},
+	}
+}
+
+// SetCDIClientFactory makes imports run with the copies of the cluster
+// client newCDIClient returns, so that their calls are traced and logged
+// with the import.
+func (c *Controller) SetCDIClientFactory(newCDIClient CDIClientFactory) {
+	c.newCDIClient = newCDIClient
+}
+
+// SetStepOptions bounds the steps of every import with timeouts, polling
+// every pollInterval and retrying transient errors with policy.
+func (c *Controller) SetStepOptions(timeouts importer.Timeouts, pollInterval time.Duration, policy retry.Policy) {
+	c.timeouts = timeouts
+	c.pollInterval = pollInterval
+	c.retry = policy
+}
+
+// EnableTracing records every import as a trace of tracer.
+func (c *Controller) EnableTracing(tracer *tracing.Tracer) {
+	c.tracer = tracer
+}
+
+// Run reconciles with workers goroutines until stop is closed.
+func (c *Controller) Run(workers int, stop <-chan struct{}) {
+	defer c.queue.ShutDown()
+
+	c.log.Info("Starting AMIImport controller")
+	go wait.Until(c.enqueueAll, c.resyncPeriod, stop)
+	for i := 0; i < workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stop)
+	}
+
+	<-stop
+	c.log.Info("Stopping AMIImport controller")
+
+	c.mu.Lock()
+	for _, imp := range c.running {
+		imp.Cancel()
+	}
+	c.mu.Unlock()
+}
+
+func key(namespace string, name string) string {
+	return fmt.Sprintf("%s/%s", namespace, name)
+}
+
+func splitKey(key string) (namespace string, name string) {
+	parts := strings.SplitN(key, "/", 2)
+	return parts[0], parts[1]
+}
+
+func (c *Controller) enqueueAll() {
+	list, err := c.client.ListAMIImports(c.namespace)
+	if err != nil {
+		c.log.Error(err, "Unable to list AMIImports")
+		return
+	}
+	for _, amiImport := range list.Items {
+		c.queue.Add(key(amiImport.Namespace, amiImport.Name))
+	}
+}
+
+func (c *Controller) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+func (c *Controller) processNextItem() bool {
+	item, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(item)
+
+	err := c.reconcile(item.(string))
+	if err != nil {
+		c.log.Error(err, "Error reconciling AMIImport", keyAMIImport, item)
+		c.queue.AddRateLimited(item)
+		return true
+	}
+	c.queue.Forget(item)
+	return true
+}
+
+func (c *Controller) runningImporter(key string) (*importer.Importer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	imp, ok := c.running[key]
+	return imp, ok
+}
+
+func hasFinalizer(amiImport *v1alpha1.AMIImport) bool {
+	for _, finalizer := range amiImport.Finalizers {
+		if finalizer == v1alpha1.AMIImportFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Controller) reconcile(key string) error {
+	namespace, name := splitKey(key)
+
+	amiImport, err := c.client.GetAMIImport(name, namespace)
+	if k8serrors.IsNotFound(err) {
+		if imp, ok := c.runningImporter(key); ok {
+			imp.Cancel()
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if amiImport.DeletionTimestamp != nil {
+		return c.finalize(key, amiImport)
+	}
+
+	if !hasFinalizer(amiImport) {
+		amiImport.Finalizers = append(amiImport.Finalizers, v1alpha1.AMIImportFinalizer)
+		if amiImport.Status.Phase == "" {
+			amiImport.Status.Phase = v1alpha1.AMIImportPending
+		}
+		amiImport, err = c.client.UpdateAMIImport(amiImport)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch amiImport.Status.Phase {
+	case v1alpha1.AMIImportSucceeded, v1alpha1.AMIImportFailed:
+		return nil
+	}
+
+	if _, ok := c.runningImporter(key); ok {
+		return c.updateProgress(amiImport)
+	}
+	return c.start(key, amiImport)
+}
+
+// start runs the import of amiImport in the background, unless maxImports
+// imports are already running in which case a later resync starts it.
+func (c *Controller) start(key string, amiImport *v1alpha1.AMIImport) error {
+	err := validateSpec(&amiImport.Spec)
+	if err == nil {
+		err = c.validateNotifyHost(amiImport.Spec.Notify)
+	}
+	if err != nil {
+		return c.updateStatus(amiImport.Name, amiImport.Namespace, func(status *v1alpha1.AMIImportStatus) {
+			status.Phase = v1alpha1.AMIImportFailed
+			setCondition(status, importer.StepResolve, k8sv1.ConditionFalse, "InvalidSpec", err.Error())
+		})
+	}
+
+	imp, err := c.newImporter(amiImport)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if len(c.running) >= c.maxImports {
+		c.mu.Unlock()
+		return nil
+	}
+	c.running[key] = imp
+	c.mu.Unlock()
+
+	c.log.Info("Starting import of AMIImport", keyAMIImport, key)
+	go func() {
+		err := imp.Run()
+
+		c.mu.Lock()
+		delete(c.running, key)
+		c.mu.Unlock()
+
+		c.finish(amiImport.Name, amiImport.Namespace, err)
+		c.notify(amiImport, imp, err)
+		c.queue.Add(key)
+	}()
+	return nil
+}
+
+func (c *Controller) finish(name string, namespace string, err error) {
+	log := c.log.WithValues(keyAMIImport, key(namespace, name))
+	if errors.Is(err, importer.ErrCancelled) {
+		log.Info("Import of AMIImport cancelled")
+		return
+	}
+
+	updateErr := c.updateStatus(name, namespace, func(status *v1alpha1.AMIImportStatus) {
+		if err != nil {
+			status.Phase = v1alpha1.AMIImportFailed
+			return
+		}
+		status.Phase = v1alpha1.AMIImportSucceeded
+		status.Progress = "100.0%"
+	})
+	if updateErr != nil {
+		log.Error(updateErr, "Unable to update status of AMIImport")
+	}
+
+	if err != nil {
+		log.Error(err, "Import of AMIImport failed")
+	} else {
+		log.Info("Import of AMIImport succeeded")
+	}
+}
+
+// updateProgress copies the progress of the DataVolume to the status while
+// the import waits on it.
+func (c *Controller) updateProgress(amiImport *v1alpha1.AMIImport) error {
+	if amiImport.Status.DataVolumeRef == nil {
+		return nil
+	}
+
+	dv, err := c.client.GetDataVolume(amiImport.Status.DataVolumeRef.Name, amiImport.Namespace)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	progress := string(dv.Status.Progress)
+	if progress == "" || progress == amiImport.Status.Progress {
+		return nil
+	}
+	return c.updateStatus(amiImport.Name, amiImport.Namespace, func(status *v1alpha1.AMIImportStatus) {
+		status.Progress = progress
+	})
+}
+
+// finalize removes what the import created once it is no longer running,
+// and then releases the AMIImport.
+func (c *Controller) finalize(key string, amiImport *v1alpha1.AMIImport) error {
+	if !hasFinalizer(amiImport) {
+		return nil
+	}
+
+	if imp, ok := c.runningImporter(key); ok {
+		// the import stops after its current step and requeues
+		imp.Cancel()
+		if amiImport.Status.Phase != v1alpha1.AMIImportDeleting {
+			return c.updateStatus(amiImport.Name, amiImport.Namespace, func(status *v1alpha1.AMIImportStatus) {
+				status.Phase = v1alpha1.AMIImportDeleting
+			})
+		}
+		return nil
+	}
+
+	// the credentials secret may already be gone when the namespace is
+	// being deleted, what the import created in AWS is then left behind
+	imp, err := c.newImporter(amiImport)
+	if k8serrors.IsNotFound(err) {
+		c.log.Error(err, "Unable to remove AWS resources of AMIImport", keyAMIImport, key, "copiedAmi", amiImport.Status.CopiedAmiId, "exportLocation", amiImport.Status.ExportLocation)
+	} else if err != nil {
+		return err
+	} else {
+		err = imp.Teardown()
+		if errors.Is(err, importer.ErrNoState) {
+			c.log.Info("AMIImport did not start an import, nothing to remove", keyAMIImport, key)
+		} else if err != nil {
+			return err
+		} else {
+			c.log.Info("Removed resources of AMIImport", keyAMIImport, key)
+		}
+	}
+
+	var finalizers []string
+	for _, finalizer := range amiImport.Finalizers {
+		if finalizer != v1alpha1.AMIImportFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	amiImport.Finalizers = finalizers
+	_, err = c.client.UpdateAMIImport(amiImport)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// updateStatus applies mutate to the latest status of the AMIImport,
+// retrying on conflicts with other writers of the status.
+func (c *Controller) updateStatus(name string, namespace string, mutate func(status *v1alpha1.AMIImportStatus)) error {
+	for attempt := 0; ; attempt++ {
+		amiImport, err := c.client.GetAMIImport(name, namespace)
+		if err != nil {
+			return err
+		}
+
+		mutate(&amiImport.Status)
+		_, err = c.client.UpdateAMIImportStatus(amiImport)
+		if k8serrors.IsConflict(err) && attempt < maxConflictRetries {
+			continue
+		}
+		return err
+	}
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"fmt"
+
+	k8sv1 "k8s.io/api/core/v1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/apis/v1alpha1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+	"kubevirt.io/kubevirt-cloud-import/pkg/disk"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+)
+
+func validateSpec(spec *v1alpha1.AMIImportSpec) error {
+	if spec.AmiId == "" {
+		return fmt.Errorf("spec.amiId is required")
+	} else if spec.Region == "" {
+		return fmt.Errorf("spec.region is required")
+	} else if spec.S3Bucket == "" {
+		return fmt.Errorf("spec.s3Bucket is required")
+	} else if spec.CredentialsSecretRef == nil {
+		return fmt.Errorf("spec.credentialsSecretRef is required")
+	} else if spec.S3SecretRef == nil && spec.S3ReaderRoleArn == "" {
+		return fmt.Errorf("spec.s3SecretRef or spec.s3ReaderRoleArn is required")
+	} else if spec.Pvc.Size.IsZero() {
+		return fmt.Errorf("spec.pvc.size is required")
+	}
+	if spec.ExportFormat != "" {
+		exportFormat, err := aws.ParseExportImageFormat(spec.ExportFormat)
+		if err != nil {
+			return err
+		}
+		if spec.Verify && !disk.SupportsDigest(exportFormat) {
+			return fmt.Errorf("spec.verify is not supported with spec.exportFormat %s, the content of %s exports can not be computed", exportFormat, exportFormat)
+		}
+	}
+	if spec.Convert != nil {
+		if _, err := disk.ParseConvertTool(spec.Convert.Tool); err != nil {
+			return fmt.Errorf("invalid spec.convert.tool: %v", err)
+		}
+	}
+	if spec.Notify != nil {
+		return validateNotifySpec(spec.Notify)
+	}
+	return nil
+}
+
+// credentials returns the credentials of the AMIImport's secret. Imports
+// never run with the controller's own identity, so that a tenant can only
+// act, and assume roles, as the credentials it provides.
+func (c *Controller) credentials(amiImport *v1alpha1.AMIImport) (aws.Credentials, error) {
+	secretRef := amiImport.Spec.CredentialsSecretRef
+	if secretRef == nil {
+		return aws.Credentials{}, fmt.Errorf("spec.credentialsSecretRef is required")
+	}
+
+	secret, err := c.client.GetSecret(secretRef.Name, amiImport.Namespace)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	accessKeyId := string(secret.Data[cdi.S3SecretAccessKeyIdKey])
+	secretKey := string(secret.Data[cdi.S3SecretKeyKey])
+	if accessKeyId == "" || secretKey == "" {
+		return aws.Credentials{}, fmt.Errorf("secret %s/%s must contain %s and %s", amiImport.Namespace, secretRef.Name, cdi.S3SecretAccessKeyIdKey, cdi.S3SecretKeyKey)
+	}
+	return aws.Credentials{
+		RoleArn:         amiImport.Spec.RoleArn,
+		AccessKeyId:     accessKeyId,
+		SecretAccessKey: secretKey,
+		SessionToken:    string(secret.Data[cdi.S3SecretSessionTokenKey]),
+	}, nil
+}
+
+// newImporter creates the importer of amiImport, keeping its state in the
+// AMIImport's status.
+func (c *Controller) newImporter(amiImport *v1alpha1.AMIImport) (*importer.Importer, error) {
+	spec := amiImport.Spec
+	log := c.log.WithValues(keyAMIImport, key(amiImport.Namespace, amiImport.Name))
+
+	creds, err := c.credentials(amiImport)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credentials: %w", err)
+	}
+
+	scope := c.tracer.NewScope()
+	awsCli, err := c.newAWSClient(spec.Region, creds, scope, log)
+	if err != nil {
+		return nil, fmt.Errorf("err encountered creation of aws client: %v", err)
+	}
+
+	exportFormat := aws.ExportImageFormatVmdk
+	if spec.ExportFormat != "" {
+		exportFormat, err = aws.ParseExportImageFormat(spec.ExportFormat)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := importer.Options{
+		Region:           spec.Region,
+		AmiId:            spec.AmiId,
+		S3Bucket:         spec.S3Bucket,
+		ExportFormat:     exportFormat,
+		KmsKeyId:         spec.KmsKeyId,
+		VMImportRoleName: spec.VMImportRoleName,
+		S3ReaderRoleArn:  spec.S3ReaderRoleArn,
+		PvcName:          spec.Pvc.Name,
+		PvcNamespace:     amiImport.Namespace,
+		PvcStorageClass:  spec.Pvc.StorageClassName,
+		PvcAccessMode:    string(spec.Pvc.AccessMode),
+		PvcSize:          spec.Pvc.Size,
+		Verify:           spec.Verify,
+		Timeouts:         c.timeouts,
+		PollInterval:     c.pollInterval,
+		Retry:            c.retry,
+		Trace:            scope,
+		Log:              log,
+	}
+	if spec.S3SecretRef != nil {
+		opts.S3SecretName = spec.S3SecretRef.Name
+	}
+	if opts.S3ReaderRoleArn != "" {
+		opts.S3CredentialsDuration = defaultS3CredentialsDuration
+	}
+	if opts.PvcName == "" {
+		opts.PvcName = amiImport.Name
+	}
+	if opts.PvcAccessMode == "" {
+		opts.PvcAccessMode = string(k8sv1.ReadWriteOnce)
+	}
+	if convert := spec.Convert; convert != nil {
+		opts.Convert = true
+		opts.ConvertImage = convert.Image
+		opts.Conversion = disk.ConversionOptions{
+			RemoveCloudAgents:  convert.RemoveCloudAgents,
+			ResetNetworkNaming: convert.ResetNetworkNaming == nil || *convert.ResetNetworkNaming,
+		}
+		opts.Conversion.Tool, err = disk.ParseConvertTool(convert.Tool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	store := &statusStateStore{controller: c, name: amiImport.Name, namespace: amiImport.Namespace}
+	clients := importer.Clients{AWS: awsCli, CDI: c.client}
+	if c.newCDIClient != nil {
+		clients.CDI = c.newCDIClient(scope, log)
+	}
+	imp := importer.New(opts, clients, store)
+	imp.AddObserver(&statusObserver{controller: c, name: amiImport.Name, namespace: amiImport.Namespace})
+	imp.AddObserver(importer.NewEventRecorder(c.client, &k8sv1.ObjectReference{
+		APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		Kind:       "AMIImport",
+		Name:       amiImport.Name,
+		Namespace:  amiImport.Namespace,
+		UID:        amiImport.UID,
+	}))
+	return imp, nil
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"testing"
+
+	k8sv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kubevirt.io/kubevirt-cloud-import/pkg/apis/v1alpha1"
+)
+
+func TestValidateSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(spec *v1alpha1.AMIImportSpec)
+		wantErr bool
+	}{
+		{name: "valid", mutate: func(spec *v1alpha1.AMIImportSpec) {}},
+		{name: "no ami", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.AmiId = "" }, wantErr: true},
+		{name: "no region", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.Region = "" }, wantErr: true},
+		{name: "no bucket", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.S3Bucket = "" }, wantErr: true},
+		{name: "no credentials secret", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.CredentialsSecretRef = nil }, wantErr: true},
+		{name: "no pvc size", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.Pvc.Size = resource.Quantity{} }, wantErr: true},
+		{
+			name: "reader role instead of secret",
+			mutate: func(spec *v1alpha1.AMIImportSpec) {
+				spec.S3SecretRef = nil
+				spec.S3ReaderRoleArn = "arn:aws:iam::111111111111:role/reader"
+			},
+		},
+		{name: "no secret nor reader role", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.S3SecretRef = nil }, wantErr: true},
+		{name: "export format", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.ExportFormat = "RAW" }},
+		{name: "unknown export format", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.ExportFormat = "qcow2" }, wantErr: true},
+		{name: "verify default format", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.Verify = true }},
+		{
+			name: "verify raw",
+			mutate: func(spec *v1alpha1.AMIImportSpec) {
+				spec.ExportFormat = "raw"
+				spec.Verify = true
+			},
+		},
+		{
+			name: "verify vhd",
+			mutate: func(spec *v1alpha1.AMIImportSpec) {
+				spec.ExportFormat = "vhd"
+				spec.Verify = true
+			},
+			wantErr: true,
+		},
+		{name: "convert default tool", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.Convert = &v1alpha1.ConvertSpec{} }},
+		{
+			name:    "convert unknown tool",
+			mutate:  func(spec *v1alpha1.AMIImportSpec) { spec.Convert = &v1alpha1.ConvertSpec{Tool: "guestfish"} },
+			wantErr: true,
+		},
+		{
+			name: "notify url",
+			mutate: func(spec *v1alpha1.AMIImportSpec) {
+				spec.Notify = &v1alpha1.NotifySpec{Url: "https://hooks.example.com"}
+			},
+		},
+		{
+			name: "notify secret",
+			mutate: func(spec *v1alpha1.AMIImportSpec) {
+				spec.Notify = &v1alpha1.NotifySpec{Format: "slack", SecretRef: &k8sv1.LocalObjectReference{Name: "webhook"}}
+			},
+		},
+		{name: "notify nowhere", mutate: func(spec *v1alpha1.AMIImportSpec) { spec.Notify = &v1alpha1.NotifySpec{} }, wantErr: true},
+		{
+			name: "notify unknown format",
+			mutate: func(spec *v1alpha1.AMIImportSpec) {
+				spec.Notify = &v1alpha1.NotifySpec{Url: "https://hooks.example.com", Format: "email"}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		spec := &v1alpha1.AMIImportSpec{
+			AmiId:                "ami-1",
+			Region:               "us-east-1",
+			S3Bucket:             "bucket",
+			CredentialsSecretRef: &k8sv1.LocalObjectReference{Name: "aws"},
+			S3SecretRef:          &k8sv1.LocalObjectReference{Name: "s3"},
+			Pvc:                  v1alpha1.PvcTemplate{Size: resource.MustParse("10Gi")},
+		}
+		tt.mutate(spec)
+
+		err := validateSpec(spec)
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: validateSpec() succeeded, want an error", tt.name)
+		} else if !tt.wantErr && err != nil {
+			t.Errorf("%s: validateSpec() returned error: %v", tt.name, err)
+		}
+	}
+}
+
+// fakeClient serves secrets. Calls it does not implement panic through the
+// nil embedded interface, failing the test.
+type fakeClient struct {
+	Client
+	secrets map[string]*k8sv1.Secret
+}
+
+func (c *fakeClient) GetSecret(name string, namespace string) (*k8sv1.Secret, error) {
+	secret, ok := c.secrets[key(namespace, name)]
+	if !ok {
+		return nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+	}
+	return secret, nil
+}
+
+func TestCredentials(t *testing.T) {
+	client := &fakeClient{secrets: map[string]*k8sv1.Secret{
+		"tenant/aws": {Data: map[string][]byte{"accessKeyId": []byte("AKID"), "secretKey": []byte("secret"), "sessionToken": []byte("token")}},
+		"tenant/s3":  {Data: map[string][]byte{"accessKeyId": []byte("AKID")}},
+	}}
+	c := &Controller{client: client}
+	amiImport := func(secretName string) *v1alpha1.AMIImport {
+		amiImport := &v1alpha1.AMIImport{
+			ObjectMeta: metav1.ObjectMeta{Name: "fedora", Namespace: "tenant"},
+			Spec:       v1alpha1.AMIImportSpec{RoleArn: "arn:aws:iam::111111111111:role/import"},
+		}
+		if secretName != "" {
+			amiImport.Spec.CredentialsSecretRef = &k8sv1.LocalObjectReference{Name: secretName}
+		}
+		return amiImport
+	}
+
+	creds, err := c.credentials(amiImport("aws"))
+	if err != nil {
+		t.Fatalf("credentials() returned error: %v", err)
+	}
+	if creds.AccessKeyId != "AKID" || creds.SecretAccessKey != "secret" || creds.SessionToken != "token" || creds.RoleArn != "arn:aws:iam::111111111111:role/import" {
+		t.Errorf("credentials() = %+v, want those of the secret assuming the role", creds)
+	}
+
+	if _, err := c.credentials(amiImport("")); err == nil {
+		t.Error("credentials() succeeded without a credentials secret")
+	}
+	if _, err := c.credentials(amiImport("missing")); !k8serrors.IsNotFound(err) {
+		t.Errorf("credentials() of a missing secret = %v, want not found", err)
+	}
+	if _, err := c.credentials(amiImport("s3")); err == nil {
+		t.Error("credentials() succeeded with a secret missing the secret key")
+	}
+}
+
+func TestNotifierOf(t *testing.T) {
+	client := &fakeClient{secrets: map[string]*k8sv1.Secret{
+		"tenant/webhook":  {Data: map[string][]byte{"url": []byte("https://hooks.example.com/T000/B000")}},
+		"tenant/internal": {Data: map[string][]byte{"url": []byte("http://169.254.169.254/latest/meta-data")}},
+	}}
+	tests := []struct {
+		name    string
+		hosts   []string
+		spec    *v1alpha1.NotifySpec
+		wantErr bool
+	}{
+		{name: "controller notifier", spec: nil},
+		{name: "allowed url", hosts: []string{"hooks.example.com"}, spec: &v1alpha1.NotifySpec{Url: "https://HOOKS.example.com/path"}},
+		{name: "allowed secret url", hosts: []string{"hooks.example.com"}, spec: &v1alpha1.NotifySpec{SecretRef: &k8sv1.LocalObjectReference{Name: "webhook"}}},
+		{name: "no allowed hosts", spec: &v1alpha1.NotifySpec{Url: "https://hooks.example.com"}, wantErr: true},
+		{name: "other host", hosts: []string{"hooks.example.com"}, spec: &v1alpha1.NotifySpec{Url: "https://example.com"}, wantErr: true},
+		{name: "other secret host", hosts: []string{"hooks.example.com"}, spec: &v1alpha1.NotifySpec{SecretRef: &k8sv1.LocalObjectReference{Name: "internal"}}, wantErr: true},
+		{name: "other scheme", hosts: []string{"hooks.example.com"}, spec: &v1alpha1.NotifySpec{Url: "file://hooks.example.com/etc/passwd"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		c := &Controller{client: client}
+		if tt.hosts != nil {
+			c.AllowNotifyHosts(tt.hosts)
+		}
+		amiImport := &v1alpha1.AMIImport{
+			ObjectMeta: metav1.ObjectMeta{Name: "fedora", Namespace: "tenant"},
+			Spec:       v1alpha1.AMIImportSpec{Notify: tt.spec},
+		}
+		_, err := c.notifierOf(amiImport)
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: notifierOf() succeeded, want an error", tt.name)
+		} else if !tt.wantErr && err != nil {
+			t.Errorf("%s: notifierOf() returned error: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/apis/v1alpha1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/notify"
+)
+
+// The keys of the secret of an AMIImport's notification settings.
+const (
+	notifySecretUrlKey  = "url"
+	notifySecretHMACKey = "hmacKey"
+)
+
+// EnableNotifications posts the result of every import to notifier, unless
+// the AMIImport has notification settings of its own.
+func (c *Controller) EnableNotifications(notifier *notify.Notifier) {
+	c.notifier = notifier
+}
+
+// AllowNotifyHosts lets AMIImports post their result to webhooks on hosts.
+// Without allowed hosts, notification settings of AMIImports are refused so
+// that they can not make the controller post to arbitrary addresses.
+func (c *Controller) AllowNotifyHosts(hosts []string) {
+	c.notifyHosts = map[string]bool{}
+	for _, host := range hosts {
+		c.notifyHosts[strings.ToLower(host)] = true
+	}
+}
+
+// checkNotifyUrl returns an error unless rawUrl is an http or https url on
+// an allowed host.
+func (c *Controller) checkNotifyUrl(rawUrl string) error {
+	if len(c.notifyHosts) == 0 {
+		return fmt.Errorf("notification settings of AMIImports are not allowed by the controller")
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return fmt.Errorf("invalid notification url: %v", err)
+	} else if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("notification url must be http or https")
+	} else if !c.notifyHosts[strings.ToLower(u.Hostname())] {
+		return fmt.Errorf("notification host %s is not allowed by the controller", u.Hostname())
+	}
+	return nil
+}
+
+func validateNotifySpec(spec *v1alpha1.NotifySpec) error {
+	if spec.Url == "" && spec.SecretRef == nil {
+		return fmt.Errorf("spec.notify.url or spec.notify.secretRef is required")
+	}
+	if _, err := notify.ParseFormat(spec.Format); err != nil {
+		return fmt.Errorf("invalid spec.notify.format: %v", err)
+	}
+	return nil
+}
+
+// validateNotifyHost refuses notification settings posting to a host that
+// is not allowed. A url kept in the secret is only checked once the import
+// completes.
+func (c *Controller) validateNotifyHost(spec *v1alpha1.NotifySpec) error {
+	if spec == nil {
+		return nil
+	} else if spec.Url == "" && len(c.notifyHosts) != 0 {
+		return nil
+	}
+	if err := c.checkNotifyUrl(spec.Url); err != nil {
+		return fmt.Errorf("invalid spec.notify: %v", err)
+	}
+	return nil
+}
+
+// notifierOf returns the notifier of amiImport, the controller's when the
+// AMIImport has no notification settings. It is nil when neither has.
+func (c *Controller) notifierOf(amiImport *v1alpha1.AMIImport) (*notify.Notifier, error) {
+	spec := amiImport.Spec.Notify
+	if spec == nil {
+		return c.notifier, nil
+	}
+
+	opts := notify.Options{Url: spec.Url, Format: spec.Format}
+	if spec.SecretRef != nil {
+		secret, err := c.client.GetSecret(spec.SecretRef.Name, amiImport.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read notification secret: %v", err)
+		}
+		if url := strings.TrimSpace(string(secret.Data[notifySecretUrlKey])); url != "" {
+			opts.Url = url
+		}
+		opts.Secret = secret.Data[notifySecretHMACKey]
+	}
+	if opts.Url == "" {
+		return nil, fmt.Errorf("secret %s/%s must contain %s when spec.notify.url is unset", amiImport.Namespace, spec.SecretRef.Name, notifySecretUrlKey)
+	}
+	if err := c.checkNotifyUrl(opts.Url); err != nil {
+		return nil, err
+	}
+	return notify.New(opts)
+}
+
+// notify posts the result of the import of amiImport. Cancelled imports are
+// not notified, those stopped by a shutdown of the controller are notified
+// once resumed and those of deleted AMIImports never complete.
+func (c *Controller) notify(amiImport *v1alpha1.AMIImport, imp *importer.Importer, err error) {
+	if errors.Is(err, importer.ErrCancelled) {
+		return
+	}
+
+	log := c.log.WithValues(keyAMIImport, key(amiImport.Namespace, amiImport.Name))
+	notifier, notifierErr := c.notifierOf(amiImport)
+	if notifierErr != nil {
+		log.Error(notifierErr, "Unable to send notification of AMIImport")
+		return
+	}
+	if notifyErr := notifier.Notify(imp.Result(err)); notifyErr != nil {
+		log.Error(notifyErr, "Unable to send notification of AMIImport")
+	}
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/apis/v1alpha1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+)
+
+const (
+	defaultS3CredentialsDuration = time.Hour
+
+	conditionReasonRunning   = "Running"
+	conditionReasonSucceeded = "Succeeded"
+	conditionReasonFailed    = "Failed"
+)
+
+// setCondition sets the condition of type conditionType, only moving its
+// transition time when its status changes.
+func setCondition(status *v1alpha1.AMIImportStatus, conditionType string, conditionStatus k8sv1.ConditionStatus, reason string, message string) {
+	for idx := range status.Conditions {
+		condition := &status.Conditions[idx]
+		if condition.Type != conditionType {
+			continue
+		}
+		if condition.Status != conditionStatus {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		condition.Status = conditionStatus
+		condition.Reason = reason
+		condition.Message = message
+		return
+	}
+
+	status.Conditions = append(status.Conditions, v1alpha1.AMIImportCondition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// statusStateStore keeps the state of an import in the status of its
+// AMIImport, along with the status fields derived from it.
+type statusStateStore struct {
+	controller *Controller
+	name       string
+	namespace  string
+}
+
+func (s *statusStateStore) Load() (*importer.State, error) {
+	amiImport, err := s.controller.client.GetAMIImport(s.name, s.namespace)
+	if err != nil {
+		return nil, err
+	}
+	if amiImport.Status.State == "" {
+		return nil, nil
+	}
+
+	state := &importer.State{}
+	if err := json.Unmarshal([]byte(amiImport.Status.State), state); err != nil {
+		return nil, fmt.Errorf("unable to parse state of AMIImport %s/%s: %v", s.namespace, s.name, err)
+	}
+	return state, nil
+}
+
+func (s *statusStateStore) Save(state *importer.State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return s.controller.updateStatus(s.name, s.namespace, func(status *v1alpha1.AMIImportStatus) {
+		status.State = string(data)
+		if state.CopyRequired {
+			status.CopiedAmiId = state.ExportAmiId
+		}
+		status.ExportTaskId = state.ExportTaskId
+		if state.S3Key != "" {
+			status.ExportLocation = fmt.Sprintf("s3://%s/%s", state.S3Bucket, state.S3Key)
+		}
+		if state.DataVolume != "" {
+			status.DataVolumeRef = &k8sv1.LocalObjectReference{Name: state.DataVolume}
+		}
+	})
+}
+
+// Delete keeps the state, the controller relies on it to remove what the
+// import created once the AMIImport is deleted.
+func (s *statusStateStore) Delete() error {
+	return nil
+}
+
+// statusObserver reflects each step of an import in the conditions of its
+// AMIImport.
+type statusObserver struct {
+	controller *Controller
+	name       string
+	namespace  string
+}
+
+func (o *statusObserver) update(step string, conditionStatus k8sv1.ConditionStatus, reason string, message string) {
+	err := o.controller.updateStatus(o.name, o.namespace, func(status *v1alpha1.AMIImportStatus) {
+		if status.Phase != v1alpha1.AMIImportDeleting {
+			status.Phase = v1alpha1.AMIImportRunning
+		}
+		setCondition(status, step, conditionStatus, reason, message)
+	})
+	if err != nil {
+		o.controller.log.Error(err, "Unable to update status of AMIImport", keyAMIImport, key(o.namespace, o.name))
+	}
+}
+
+func (o *statusObserver) StepStarted(step string, state *importer.State) {
+	o.update(step, k8sv1.ConditionUnknown, conditionReasonRunning, "")
+}
+
+func (o *statusObserver) StepProgress(step string, state *importer.State, message string) {
+	o.update(step, k8sv1.ConditionUnknown, conditionReasonRunning, message)
+}
+
+func (o *statusObserver) StepSucceeded(step string, state *importer.State) {
+	o.update(step, k8sv1.ConditionTrue, conditionReasonSucceeded, "")
+}
+
+func (o *statusObserver) StepFailed(step string, state *importer.State, err error) {
+	o.update(step, k8sv1.ConditionFalse, conditionReasonFailed, err.Error())
+}
@@ -0,0 +1,181 @@
+package disk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The tools a disk is converted with.
+const (
+	// ConvertToolVirtCustomize runs the conversion script in the guest with
+	// virt-customize. Only Linux guests are supported.
+	ConvertToolVirtCustomize = "virt-customize"
+	// ConvertToolVirtV2VInPlace converts the guest with virt-v2v-in-place,
+	// which installs virtio drivers for Linux and Windows guests, before
+	// virt-customize runs the remaining parts of the conversion.
+	ConvertToolVirtV2VInPlace = "virt-v2v-in-place"
+)
+
+// ParseConvertTool validates a conversion tool.
+func ParseConvertTool(tool string) (string, error) {
+	switch strings.ToLower(tool) {
+	case "", ConvertToolVirtCustomize:
+		return ConvertToolVirtCustomize, nil
+	case ConvertToolVirtV2VInPlace:
+		return ConvertToolVirtV2VInPlace, nil
+	}
+	return "", fmt.Errorf("unsupported conversion tool %q, must be one of %s, %s", tool, ConvertToolVirtCustomize, ConvertToolVirtV2VInPlace)
+}
+
+// ConversionOptions select what a conversion changes in the guest.
+type ConversionOptions struct {
+	Tool string
+	// RemoveCloudAgents uninstalls agents that only work on EC2, such as
+	// the SSM agent.
+	RemoveCloudAgents bool
+	// ResetNetworkNaming removes network configuration tied to the MAC
+	// address of the EC2 instance the image was built on.
+	ResetNetworkNaming bool
+}
+
+// Conversion is the outcome of converting an imported disk. It is
+// serialized as the termination message of the conversion job.
+type Conversion struct {
+	Succeeded bool     `json:"succeeded"`
+	Tool      string   `json:"tool"`
+	Changes   []string `json:"changes"`
+	Reason    string   `json:"reason,omitempty"`
+}
+
+// Changes describes what a conversion with opts changes in the guest.
+func (opts ConversionOptions) Changes() []string {
+	changes := []string{"virtio drivers in initramfs"}
+	if opts.Tool == ConvertToolVirtV2VInPlace {
+		changes[0] = "virtio drivers converted with " + ConvertToolVirtV2VInPlace
+	}
+	if opts.RemoveCloudAgents {
+		changes = append(changes, "aws agents removed")
+	}
+	if opts.ResetNetworkNaming {
+		changes = append(changes, "persistent network naming reset")
+	}
+	return changes
+}
+
+// cloudAgents are the packages RemoveCloudAgents uninstalls. Packages only
+// configuring the network of EC2, such as amazon-ec2-net-utils, are kept
+// since some distributions depend on them for any network configuration.
+var cloudAgents = []string{
+	"amazon-ssm-agent",
+	"amazon-cloudwatch-agent",
+	"aws-cfn-bootstrap",
+	"ec2-instance-connect",
+	"ec2-hibinit-agent",
+	"hibagent",
+}
+
+// virtioModules are added to the initramfs of every installed kernel that
+// has them as modules. Kernels with virtio built in need nothing.
+const virtioModules = "virtio_blk virtio_scsi virtio_net virtio_pci virtio_console"
+
+const driversScript = `
+modules="` + virtioModules + `"
+for kver in $(ls /lib/modules); do
+	[ -f "/lib/modules/$kver/modules.dep" ] || continue
+	found=""
+	for module in $modules; do
+		if find "/lib/modules/$kver" -name "$module.ko*" | grep -q .; then
+			found="$found $module"
+		fi
+	done
+	if command -v dracut >/dev/null 2>&1; then
+		dracut --force --add-drivers "$found" "/boot/initramfs-$kver.img" "$kver"
+	elif command -v update-initramfs >/dev/null 2>&1; then
+		for module in $found; do
+			grep -qx "$module" /etc/initramfs-tools/modules || echo "$module" >> /etc/initramfs-tools/modules
+		done
+		update-initramfs -u -k "$kver"
+	else
+		echo "neither dracut nor update-initramfs found" >&2
+		exit 1
+	fi
+done
+# kernels installed later keep the drivers
+if command -v dracut >/dev/null 2>&1 && [ -n "$found" ]; then
+	echo "add_drivers+=\"$found \"" > /etc/dracut.conf.d/90-cloud-import-virtio.conf
+fi
+`
+
+const agentsScript = `
+for agent in $agents; do
+	if command -v rpm >/dev/null 2>&1 && rpm -q "$agent" >/dev/null 2>&1; then
+		if command -v dnf >/dev/null 2>&1; then
+			dnf remove -y --noautoremove "$agent"
+		else
+			yum remove -y "$agent"
+		fi
+	elif command -v dpkg >/dev/null 2>&1 && dpkg -s "$agent" >/dev/null 2>&1; then
+		apt-get remove -y "$agent"
+	fi
+done
+# the snap of the ssm agent can not be removed offline, it is disabled
+rm -f /etc/systemd/system/multi-user.target.wants/snap.amazon-ssm-agent.amazon-ssm-agent.service
+`
+
+const networkScript = `
+rm -f /etc/udev/rules.d/70-persistent-net.rules /etc/udev/rules.d/75-persistent-net-generator.rules
+for config in /etc/sysconfig/network-scripts/ifcfg-* /etc/sysconfig/network/ifcfg-*; do
+	[ -f "$config" ] && sed -i -e '/^HWADDR=/d' -e '/^MACADDR=/d' "$config"
+done
+# cloud-init renders the netplan of the EC2 instance matching its mac address
+if [ -f /etc/netplan/50-cloud-init.yaml ]; then
+	cat > /etc/netplan/50-cloud-init.yaml <<EOF
+network:
+  version: 2
+  ethernets:
+    all:
+      match:
+        name: "e*"
+      dhcp4: true
+      dhcp6: true
+EOF
+fi
+`
+
+// GuestScript returns the shell script virt-customize runs in the guest to
+// apply opts. With virt-v2v-in-place the drivers are left to it.
+func GuestScript(opts ConversionOptions) string {
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\nset -e\n")
+	if opts.Tool != ConvertToolVirtV2VInPlace {
+		script.WriteString(driversScript)
+	}
+	if opts.RemoveCloudAgents {
+		script.WriteString("\nagents=\"" + strings.Join(cloudAgents, " ") + "\"")
+		script.WriteString(agentsScript)
+	}
+	if opts.ResetNetworkNaming {
+		script.WriteString(networkScript)
+	}
+	return script.String()
+}
+
+// ConversionCommands returns the commands converting the raw disk at path,
+// with the guest script of opts written to scriptPath.
+func ConversionCommands(path string, scriptPath string, opts ConversionOptions) [][]string {
+	var commands [][]string
+	if opts.Tool == ConvertToolVirtV2VInPlace {
+		commands = append(commands, []string{ConvertToolVirtV2VInPlace, "-i", "disk", "-if", "raw", path})
+		if !opts.RemoveCloudAgents && !opts.ResetNetworkNaming {
+			return commands
+		}
+	}
+	return append(commands, []string{
+		ConvertToolVirtCustomize,
+		"--add", path,
+		"--format", "raw",
+		"--no-network",
+		"--run", scriptPath,
+		"--selinux-relabel",
+	})
+}
@@ -0,0 +1,32 @@
+package disk
+
+import "testing"
+
+func TestParseConvertTool(t *testing.T) {
+	tests := []struct {
+		tool    string
+		want    string
+		wantErr bool
+	}{
+		{tool: "", want: ConvertToolVirtCustomize},
+		{tool: "virt-customize", want: ConvertToolVirtCustomize},
+		{tool: "Virt-V2V-In-Place", want: ConvertToolVirtV2VInPlace},
+		{tool: "virt-v2v", wantErr: true},
+		{tool: "guestfish", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseConvertTool(tt.tool)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseConvertTool(%q) = %q, want an error", tt.tool, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseConvertTool(%q) returned error: %v", tt.tool, err)
+		} else if got != tt.want {
+			t.Errorf("ParseConvertTool(%q) = %q, want %q", tt.tool, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package disk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+const (
+	FormatRaw  = "raw"
+	FormatVmdk = "vmdk"
+	FormatVhd  = "vhd"
+)
+
+// Digest describes the disk contained in an image file independently of
+// the file's format, so that it can be compared against the raw disk written
+// to a volume.
+type Digest struct {
+	// VirtualSize is the size in bytes of the disk.
+	VirtualSize int64
+	// SHA256 is the hex encoded sha256 of the disk's raw content.
+	SHA256 string
+	// StreamSize is the number of bytes read from the image file.
+	StreamSize int64
+}
+
+// ErrUnsupportedFormat is returned for formats whose raw content can not be
+// recovered while streaming.
+type ErrUnsupportedFormat struct {
+	Format string
+}
+
+func (e ErrUnsupportedFormat) Error() string {
+	return fmt.Sprintf("computing the content of %s images is not supported", e.Format)
+}
+
+type countingReader struct {
+	r     io.Reader
+	count int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// zeroBuf backs writeZeros.
+var zeroBuf = make([]byte, 1024*1024)
+
+// writeZeros feeds n zero bytes to h, which is how unallocated ranges of
+// sparse formats contribute to the raw content hash.
+func writeZeros(h hash.Hash, n int64) {
+	for n > 0 {
+		chunk := int64(len(zeroBuf))
+		if n < chunk {
+			chunk = n
+		}
+		h.Write(zeroBuf[:chunk])
+		n -= chunk
+	}
+}
+
+// SupportsDigest reports whether ComputeDigest can compute the content of
+// images of format.
+func SupportsDigest(format string) bool {
+	return format == FormatRaw || format == FormatVmdk
+}
+
+// ComputeDigest streams an image file of the given format and computes the
+// virtual size and content hash of the disk it contains.
+func ComputeDigest(format string, r io.Reader) (*Digest, error) {
+	counter := &countingReader{r: r}
+	h := sha256.New()
+
+	var virtualSize int64
+	var err error
+	switch format {
+	case FormatRaw:
+		virtualSize, err = io.Copy(h, counter)
+	case FormatVmdk:
+		virtualSize, err = readStreamOptimizedVmdk(counter, h)
+	default:
+		return nil, ErrUnsupportedFormat{Format: format}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Digest{
+		VirtualSize: virtualSize,
+		SHA256:      hex.EncodeToString(h.Sum(nil)),
+		StreamSize:  counter.count,
+	}, nil
+}
+
+// ComputeRawDigest hashes the first size bytes of a raw disk, such as an
+// imported volume that may have been grown beyond the source disk.
+func ComputeRawDigest(r io.Reader, size int64) (*Digest, error) {
+	h := sha256.New()
+	n, err := io.CopyN(h, r, size)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return &Digest{
+		VirtualSize: n,
+		SHA256:      hex.EncodeToString(h.Sum(nil)),
+		StreamSize:  n,
+	}, nil
+}
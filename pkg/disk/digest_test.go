@@ -0,0 +1,113 @@
+package disk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// testdata/stream-optimized.vmdk is a stream-optimized extent of a
+// 1024000 byte disk, a capacity that leaves the last grain partial. Grains
+// 0, 3 and 15 hold data, the others are unallocated. The grains are followed
+// by the grain table, grain directory, footer and end-of-stream markers.
+const (
+	fixtureVirtualSize = 1024000
+	fixtureSHA256      = "4e96f3939967a4bffe79db1bac3648a53ed1738a9bb7d888208edd9213e63568"
+)
+
+func TestComputeDigest(t *testing.T) {
+	vmdk, err := ioutil.ReadFile("testdata/stream-optimized.vmdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded := append(append([]byte{}, vmdk...), make([]byte, 4096)...)
+	// overHead is at offset 64 of the sparse header
+	noOverhead := append([]byte{}, vmdk...)
+	copy(noOverhead[64:72], make([]byte, 8))
+	raw := bytes.Repeat([]byte("kubevirt"), 1000)
+	rawSum := sha256.Sum256(raw)
+
+	tests := []struct {
+		name        string
+		format      string
+		image       []byte
+		virtualSize int64
+		sha256      string
+		wantErr     bool
+	}{
+		{name: "vmdk", format: FormatVmdk, image: vmdk, virtualSize: fixtureVirtualSize, sha256: fixtureSHA256},
+		{name: "vmdk padded after the end of stream", format: FormatVmdk, image: padded, virtualSize: fixtureVirtualSize, sha256: fixtureSHA256},
+		{name: "vmdk truncated", format: FormatVmdk, image: vmdk[:len(vmdk)-2048], wantErr: true},
+		{name: "vmdk header only", format: FormatVmdk, image: vmdk[:sectorSize], wantErr: true},
+		{name: "vmdk without overhead", format: FormatVmdk, image: noOverhead, wantErr: true},
+		{name: "not a vmdk", format: FormatVmdk, image: raw, wantErr: true},
+		{name: "raw", format: FormatRaw, image: raw, virtualSize: int64(len(raw)), sha256: hex.EncodeToString(rawSum[:])},
+	}
+
+	for _, tt := range tests {
+		digest, err := ComputeDigest(tt.format, bytes.NewReader(tt.image))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: ComputeDigest() = %+v, want an error", tt.name, digest)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ComputeDigest() returned error: %v", tt.name, err)
+			continue
+		}
+		if digest.VirtualSize != tt.virtualSize {
+			t.Errorf("%s: got virtual size %d, want %d", tt.name, digest.VirtualSize, tt.virtualSize)
+		}
+		if digest.SHA256 != tt.sha256 {
+			t.Errorf("%s: got sha256 %s, want %s", tt.name, digest.SHA256, tt.sha256)
+		}
+		// the whole object is read, which verification compares against
+		// the size of the s3 object
+		if digest.StreamSize != int64(len(tt.image)) {
+			t.Errorf("%s: got stream size %d, want %d", tt.name, digest.StreamSize, len(tt.image))
+		}
+	}
+}
+
+func TestComputeDigestUnsupported(t *testing.T) {
+	_, err := ComputeDigest(FormatVhd, bytes.NewReader(make([]byte, sectorSize)))
+	var unsupported ErrUnsupportedFormat
+	if !errors.As(err, &unsupported) {
+		t.Errorf("ComputeDigest(%s) returned %v, want ErrUnsupportedFormat", FormatVhd, err)
+	}
+	if SupportsDigest(FormatVhd) || !SupportsDigest(FormatVmdk) || !SupportsDigest(FormatRaw) {
+		t.Errorf("SupportsDigest does not match the formats ComputeDigest supports")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	disk := bytes.Repeat([]byte{1, 2, 3, 4}, 1024)
+	sum := sha256.Sum256(disk[:2048])
+	expected := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name        string
+		virtualSize int64
+		sha256      string
+		passed      bool
+	}{
+		{name: "grown disk", virtualSize: 2048, sha256: expected, passed: true},
+		{name: "content differs", virtualSize: 2048, sha256: fixtureSHA256},
+		{name: "disk too small", virtualSize: int64(len(disk)) + 1, sha256: expected},
+	}
+
+	for _, tt := range tests {
+		result, err := Verify(bytes.NewReader(disk), tt.virtualSize, tt.sha256)
+		if err != nil {
+			t.Errorf("%s: Verify() returned error: %v", tt.name, err)
+			continue
+		}
+		if result.Passed != tt.passed {
+			t.Errorf("%s: got passed %v (%s), want %v", tt.name, result.Passed, result.Reason, tt.passed)
+		}
+	}
+}
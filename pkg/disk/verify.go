@@ -0,0 +1,54 @@
+package disk
+
+import (
+	"fmt"
+	"io"
+)
+
+// Verification is the outcome of comparing an imported disk against the
+// digest of its source. It is serialized as the termination message of the
+// verification job.
+type Verification struct {
+	Passed              bool   `json:"passed"`
+	Reason              string `json:"reason,omitempty"`
+	ExpectedVirtualSize int64  `json:"expectedVirtualSize"`
+	ExpectedSHA256      string `json:"expectedSha256"`
+	DiskSize            int64  `json:"diskSize"`
+	SHA256              string `json:"sha256,omitempty"`
+}
+
+// Verify compares the first virtualSize bytes of the raw disk r against
+// expectedSHA256. The disk may be larger than virtualSize since the volume
+// it was imported into can be grown to the volume's capacity.
+func Verify(r io.ReadSeeker, virtualSize int64, expectedSHA256 string) (*Verification, error) {
+	diskSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	result := &Verification{
+		ExpectedVirtualSize: virtualSize,
+		ExpectedSHA256:      expectedSHA256,
+		DiskSize:            diskSize,
+	}
+	if diskSize < virtualSize {
+		result.Reason = fmt.Sprintf("disk size %d is smaller than the source virtual size %d", diskSize, virtualSize)
+		return result, nil
+	}
+
+	digest, err := ComputeRawDigest(r, virtualSize)
+	if err != nil {
+		return nil, err
+	}
+	result.SHA256 = digest.SHA256
+	if digest.SHA256 != expectedSHA256 {
+		result.Reason = "content hash does not match the source"
+		return result, nil
+	}
+
+	result.Passed = true
+	return result, nil
+}
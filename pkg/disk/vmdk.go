@@ -0,0 +1,150 @@
+package disk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	sectorSize = 512
+
+	vmdkMagic = 0x564d444b // "KDMV"
+
+	vmdkFlagCompressed = 1 << 16
+	vmdkFlagMarkers    = 1 << 17
+
+	vmdkCompressionDeflate = 1
+
+	vmdkMarkerEOS = 0
+)
+
+// vmdkSparseHeader is the header of a sparse extent, see the VMware Virtual
+// Disk Format 5.0 specification.
+type vmdkSparseHeader struct {
+	Magic              uint32
+	Version            uint32
+	Flags              uint32
+	Capacity           uint64
+	GrainSize          uint64
+	DescriptorOffset   uint64
+	DescriptorSize     uint64
+	NumGTEsPerGT       uint32
+	RgdOffset          uint64
+	GdOffset           uint64
+	OverHead           uint64
+	UncleanShutdown    uint8
+	SingleEndLineChar  uint8
+	NonEndLineChar     uint8
+	DoubleEndLineChar1 uint8
+	DoubleEndLineChar2 uint8
+	CompressAlgorithm  uint16
+	Pad                [433]uint8
+}
+
+// readStreamOptimizedVmdk decodes a stream-optimized VMDK, the variant
+// ExportImage produces, writing the raw disk content to h. Grains must
+// appear in increasing order, which holds for images written as a stream.
+// The stream is read to its end.
+func readStreamOptimizedVmdk(r io.Reader, h hash.Hash) (int64, error) {
+	header := vmdkSparseHeader{}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return 0, fmt.Errorf("unable to read vmdk header: %v", err)
+	}
+	if header.Magic != vmdkMagic {
+		return 0, fmt.Errorf("not a sparse vmdk extent")
+	}
+	if header.Flags&vmdkFlagCompressed == 0 || header.Flags&vmdkFlagMarkers == 0 || header.CompressAlgorithm != vmdkCompressionDeflate {
+		return 0, fmt.Errorf("vmdk is not stream-optimized")
+	}
+
+	if header.OverHead == 0 {
+		// the header itself takes the first sector
+		return 0, fmt.Errorf("invalid vmdk header: overhead of 0 sectors")
+	}
+
+	virtualSize := int64(header.Capacity) * sectorSize
+	grainBytes := int64(header.GrainSize) * sectorSize
+
+	// skip the descriptor and any other metadata before the first marker
+	if _, err := io.CopyN(ioutil.Discard, r, int64(header.OverHead-1)*sectorSize); err != nil {
+		return 0, fmt.Errorf("unable to skip vmdk metadata: %v", err)
+	}
+
+	var written int64
+	marker := make([]byte, 12)
+	for {
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return 0, fmt.Errorf("unable to read vmdk marker: %v", err)
+		}
+		value := binary.LittleEndian.Uint64(marker[0:8])
+		size := binary.LittleEndian.Uint32(marker[8:12])
+
+		if size == 0 {
+			// metadata marker: type, then the rest of the sector, then
+			// value sectors of metadata
+			markerType := make([]byte, 4)
+			if _, err := io.ReadFull(r, markerType); err != nil {
+				return 0, fmt.Errorf("unable to read vmdk marker: %v", err)
+			}
+			if binary.LittleEndian.Uint32(markerType) == vmdkMarkerEOS {
+				// the rest of the stream is padding, it is read so that the
+				// whole object is accounted for
+				if _, err := io.Copy(ioutil.Discard, r); err != nil {
+					return 0, fmt.Errorf("unable to read the end of the vmdk: %v", err)
+				}
+				break
+			}
+			if _, err := io.CopyN(ioutil.Discard, r, sectorSize-16+int64(value)*sectorSize); err != nil {
+				return 0, fmt.Errorf("unable to skip vmdk metadata: %v", err)
+			}
+			continue
+		}
+
+		// grain marker: value is the grain's offset in sectors
+		offset := int64(value) * sectorSize
+		if offset < written {
+			return 0, fmt.Errorf("vmdk grain at sector %d is out of order", value)
+		}
+		writeZeros(h, offset-written)
+		written = offset
+
+		compressed := make([]byte, size)
+		if _, err := io.ReadFull(r, compressed); err != nil {
+			return 0, fmt.Errorf("unable to read vmdk grain: %v", err)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return 0, fmt.Errorf("unable to decompress vmdk grain: %v", err)
+		}
+		grainLength := grainBytes
+		if offset+grainLength > virtualSize {
+			grainLength = virtualSize - offset
+		}
+		n, err := io.CopyN(h, zr, grainLength)
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("unable to decompress vmdk grain: %v", err)
+		}
+		zr.Close()
+		writeZeros(h, grainLength-n)
+		written += grainLength
+
+		// markers are sector aligned
+		if pad := (sectorSize - (12+int64(size))%sectorSize) % sectorSize; pad > 0 {
+			if _, err := io.CopyN(ioutil.Discard, r, pad); err != nil {
+				return 0, fmt.Errorf("unable to read vmdk grain: %v", err)
+			}
+		}
+	}
+
+	if written > virtualSize {
+		return 0, fmt.Errorf("vmdk grains extend past its capacity")
+	}
+	writeZeros(h, virtualSize-written)
+
+	return virtualSize, nil
+}
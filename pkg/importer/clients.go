@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/disk"
+)
+
+// AWSClient is the subset of the aws client an import drives.
+type AWSClient interface {
+	GetMyAccountId() (string, error)
+
+	FindGlobalImageById(amiId string) (*types.Image, error)
+	CheckImageExportable(amiId string, accountId string) (*aws.ExportPreflight, error)
+	FindImageByName(amiName string, accountId string) (*types.Image, bool, error)
+	CopyImageName(amiId string) string
+	CopyImage(amiId string, amiCopyName string, encrypt bool, kmsKeyId string) (string, error)
+	WaitForImageToBecomeAvailable(amiId string, timeout time.Duration, pollInterval time.Duration) error
+	DeregisterImage(amiId string) error
+	DeleteImageAndSnapshots(amiId string) error
+
+	CheckSourceKmsKeyAccess(keyId string, accountId string) error
+	CheckTargetKmsKeyAccess(keyId string, accountId string) error
+
+	FindSnapshotById(snapshotId string) (*types.Snapshot, error)
+	FindSnapshotCopy(snapshotId string, accountId string) (*types.Snapshot, bool, error)
+	CopySnapshot(snapshotId string, kmsKeyId string) (string, error)
+	WaitForSnapshotToComplete(snapshotId string, timeout time.Duration, pollInterval time.Duration) error
+	DeleteSnapshot(snapshotId string) error
+	DetectSnapshotImageSettings(snapshotId string, ownerId string) (types.ArchitectureValues, types.BootModeValues, bool, error)
+	SnapshotImageName(snapshotId string) string
+	RegisterImageFromSnapshot(snapshotId string, amiName string, arch types.ArchitectureValues, bootMode types.BootModeValues) (string, error)
+
+	GetExportTaskStatus(exportTaskId string, amiId string, imageFormat string) (string, string, bool, bool, error)
+	ExportImage(amiId string, s3Bucket string, s3Prefix string, imageFormat string, roleName string) (string, error)
+	WaitForExportImageCompletion(amiId string, taskId string, imageFormat string, timeout time.Duration, pollInterval time.Duration, progress aws.ExportProgressFunc) (string, string, error)
+	CancelExportTask(exportTaskId string) error
+
+	MintS3ObjectReadCredentials(roleArn string, bucket string, key string, duration time.Duration) (*aws.TemporaryCredentials, error)
+	HeadS3Object(bucket string, key string) (*aws.S3Object, error)
+	OpenS3Object(bucket string, key string) (io.ReadCloser, error)
+	DeleteS3Object(bucket string, key string) error
+}
+
+// CDIClient is the subset of the cdi client an import drives.
+type CDIClient interface {
+	ImportFromS3IntoPvc(pvcName, pvcNamespace, pvcStorageClass, pvcAccessMode, s3Bucket, s3FilePath, s3Region, s3SecretName, diskFormat string, storageQuantity resource.Quantity) error
+	WaitForS3ImportCompletion(pvcName string, pvcNamespace string, timeout time.Duration, pollInterval time.Duration) error
+	DeleteDataVolume(name string, namespace string) error
+
+	CreateDataVolumeSecret(secret *k8sv1.Secret, dvName string) error
+	DeleteSecret(name string, namespace string) error
+
+	CreateVerificationJob(pvcName string, namespace string, image string, virtualSize int64, sha256 string) (string, error)
+	CreateConversionJob(pvcName string, namespace string, image string, opts disk.ConversionOptions) (string, error)
+	WaitForJobCompletion(name string, namespace string, timeout time.Duration, pollInterval time.Duration) (bool, string, error)
+	DeleteJob(name string, namespace string) error
+	AnnotatePvc(name string, namespace string, annotations map[string]string) error
+	GetPvc(name string, namespace string) (*k8sv1.PersistentVolumeClaim, error)
+	DeleteConfigMap(name string, namespace string) error
+}
+
+// ConfigMapClient is used by the ConfigMap state store.
+type ConfigMapClient interface {
+	GetConfigMap(name string, namespace string) (*k8sv1.ConfigMap, error)
+	CreateOrUpdateConfigMap(configMap *k8sv1.ConfigMap) (bool, error)
+	DeleteConfigMap(name string, namespace string) error
+}
+
+// Clients are the clients an import runs with. Copy and Export default to
+// AWS when unset.
+type Clients struct {
+	// AWS reads the source image and the exported object.
+	AWS AWSClient
+	// Copy copies the source into the account the import runs in.
+	Copy AWSClient
+	// Export exports the copy to s3.
+	Export AWSClient
+	CDI    CDIClient
+}
@@ -0,0 +1,49 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+	"kubevirt.io/kubevirt-cloud-import/pkg/disk"
+)
+
+// ErrConversionFailed is wrapped by the error of an import whose guest
+// could not be converted.
+var ErrConversionFailed = errors.New("conversion failed")
+
+// convertImportedDisk runs the conversion job against the imported pvc and
+// records the outcome as annotations of the pvc.
+func convertImportedDisk(log logr.Logger, cdiCli CDIClient, pvcName string, pvcNamespace string, image string, opts disk.ConversionOptions, timeout time.Duration, pollInterval time.Duration) error {
+	jobName, err := cdiCli.CreateConversionJob(pvcName, pvcNamespace, image, opts)
+	if err != nil {
+		return err
+	}
+	log.Info("Created Job to convert pvc", "job", jobName, "tool", opts.Tool)
+
+	succeeded, message, err := cdiCli.WaitForJobCompletion(jobName, pvcNamespace, timeout, pollInterval)
+	if err != nil {
+		return err
+	}
+
+	annotations := map[string]string{
+		cdi.AnnConversion:        cdi.ConversionSucceeded,
+		cdi.AnnConversionMessage: message,
+	}
+	if !succeeded {
+		annotations[cdi.AnnConversion] = cdi.ConversionFailed
+	}
+	err = cdiCli.AnnotatePvc(pvcName, pvcNamespace, annotations)
+	if err != nil {
+		return err
+	}
+
+	// a failed job is kept, so that the log of the conversion tool can be
+	// read
+	if !succeeded {
+		return fmt.Errorf("%w: guest of pvc %s/%s could not be converted, see the log of Job %s/%s: %s", ErrConversionFailed, pvcNamespace, pvcName, pvcNamespace, jobName, message)
+	}
+	return cdiCli.DeleteJob(jobName, pvcNamespace)
+}
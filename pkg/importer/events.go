@@ -0,0 +1,218 @@
+package importer
+
+import (
+	"fmt"
+	"time"
+
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1beta1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+)
+
+// EventsConfigMapNameFormat is the name of the config map events are
+// recorded against until the DataVolume of an import exists, when no other
+// object is given.
+const EventsConfigMapNameFormat = "%s-import-events"
+
+// The reasons of the events recorded for an import.
+const (
+	EventReasonAmiResolved       = "AmiResolved"
+	EventReasonCopyStarted       = "CopyStarted"
+	EventReasonCopyFinished      = "CopyFinished"
+	EventReasonExportStarted     = "ExportStarted"
+	EventReasonExportProgress    = "ExportProgress"
+	EventReasonExportFinished    = "ExportFinished"
+	EventReasonDataVolumeCreated = "DataVolumeCreated"
+	EventReasonImportSucceeded   = "ImportSucceeded"
+	EventReasonImportFailed      = "ImportFailed"
+)
+
+// EventClient is used by the event recorder.
+type EventClient interface {
+	ConfigMapClient
+	CreateEvent(event *k8sv1.Event) error
+	UpdateEvent(event *k8sv1.Event) error
+	GetDataVolume(name string, namespace string) (*cdiv1.DataVolume, error)
+}
+
+// eventRecorder records Kubernetes events for the steps of an import. Events
+// are recorded against the DataVolume once it exists, and against subject
+// before.
+type eventRecorder struct {
+	client  EventClient
+	subject *k8sv1.ObjectReference
+
+	dataVolume *k8sv1.ObjectReference
+	// progress is the event export progress is recorded in, updated with
+	// every change rather than recorded anew.
+	progress *k8sv1.Event
+	// warned is set once a failure to record an event has been logged.
+	warned bool
+}
+
+// NewEventRecorder returns an observer recording events for the steps of an
+// import. Until the DataVolume exists events are recorded against subject,
+// or, when subject is nil, against a config map named after
+// EventsConfigMapNameFormat that is created for them.
+func NewEventRecorder(client EventClient, subject *k8sv1.ObjectReference) Observer {
+	return &eventRecorder{client: client, subject: subject}
+}
+
+func (r *eventRecorder) StepStarted(step string, state *State) {}
+
+func (r *eventRecorder) StepProgress(step string, state *State, message string) {
+	if step == StepWaitExport {
+		r.recordProgress(state, "Image export: "+message)
+	}
+}
+
+func (r *eventRecorder) StepSucceeded(step string, state *State) {
+	switch step {
+	case StepResolve:
+		r.record(state, k8sv1.EventTypeNormal, EventReasonAmiResolved, "Importing ami %s (%s, %s) in account %s", state.AmiId, state.Architecture, state.BootMode, state.AccountId)
+	case StepCopy:
+		if state.CopyRequired {
+			r.record(state, k8sv1.EventTypeNormal, EventReasonCopyStarted, "Copying ami %s to %s", state.AmiId, state.ExportAmiId)
+		}
+	case StepWaitAvailable:
+		if state.CopyRequired {
+			r.record(state, k8sv1.EventTypeNormal, EventReasonCopyFinished, "Copy %s of ami %s is available", state.ExportAmiId, state.AmiId)
+		}
+	case StepExport:
+		r.record(state, k8sv1.EventTypeNormal, EventReasonExportStarted, "Exporting ami %s with export task %s", state.ExportAmiId, state.ExportTaskId)
+	case StepWaitExport:
+		r.record(state, k8sv1.EventTypeNormal, EventReasonExportFinished, "Exported ami %s to s3://%s/%s", state.ExportAmiId, state.S3Bucket, state.S3Key)
+	case StepCreateDataVolume:
+		r.record(state, k8sv1.EventTypeNormal, EventReasonDataVolumeCreated, "Created DataVolume %s/%s importing s3://%s/%s", state.PvcNamespace, state.DataVolume, state.S3Bucket, state.S3Key)
+	case StepCleanup:
+		r.record(state, k8sv1.EventTypeNormal, EventReasonImportSucceeded, "Imported %s%s into pvc %s/%s", state.SourceAmiId, state.SnapshotId, state.PvcNamespace, state.PvcName)
+	}
+}
+
+func (r *eventRecorder) StepFailed(step string, state *State, err error) {
+	r.record(state, k8sv1.EventTypeWarning, EventReasonImportFailed, "Step %s failed: %v", step, err)
+}
+
+func (r *eventRecorder) record(state *State, eventType string, reason string, format string, args ...interface{}) {
+	object, err := r.object(state)
+	if err == nil {
+		err = r.client.CreateEvent(cdi.NewEvent(object, eventType, reason, fmt.Sprintf(format, args...)))
+	}
+	r.warn(err, state, reason)
+}
+
+// warn logs the first failure to record an event.
+func (r *eventRecorder) warn(err error, state *State, reason string) {
+	if err != nil && !r.warned {
+		logging.Default().Error(err, "Unable to record event, further failures are not logged", "reason", reason, logging.KeyPvc, state.PvcName, logging.KeyNamespace, state.PvcNamespace)
+		r.warned = true
+	}
+}
+
+// recordProgress records message in the export progress event, which is
+// created with the first message and updated with the following ones. An
+// event that can no longer be updated, such as one expired by the API
+// server, is replaced.
+func (r *eventRecorder) recordProgress(state *State, message string) {
+	if r.progress != nil {
+		r.progress.Message = message
+		r.progress.Count++
+		r.progress.LastTimestamp = metav1.NewTime(time.Now())
+		if err := r.client.UpdateEvent(r.progress); err == nil {
+			return
+		}
+		r.progress = nil
+	}
+
+	object, err := r.object(state)
+	if err == nil {
+		event := cdi.NewEvent(object, k8sv1.EventTypeNormal, EventReasonExportProgress, message)
+		err = r.client.CreateEvent(event)
+		if err == nil {
+			r.progress = event
+		}
+	}
+	r.warn(err, state, EventReasonExportProgress)
+}
+
+// object returns the object events about state are recorded against.
+func (r *eventRecorder) object(state *State) (*k8sv1.ObjectReference, error) {
+	if r.dataVolume != nil {
+		return r.dataVolume, nil
+	}
+
+	if state.DataVolume != "" {
+		dv, err := r.client.GetDataVolume(state.DataVolume, state.PvcNamespace)
+		if err != nil {
+			return nil, err
+		}
+		r.dataVolume = &k8sv1.ObjectReference{
+			APIVersion:      cdiv1.SchemeGroupVersion.String(),
+			Kind:            "DataVolume",
+			Name:            dv.Name,
+			Namespace:       dv.Namespace,
+			UID:             dv.UID,
+			ResourceVersion: dv.ResourceVersion,
+		}
+		return r.dataVolume, nil
+	}
+
+	if r.subject == nil {
+		configMap, err := r.eventsConfigMap(state)
+		if err != nil {
+			return nil, err
+		}
+		r.subject = &k8sv1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Name:       configMap.Name,
+			Namespace:  configMap.Namespace,
+			UID:        configMap.UID,
+		}
+	}
+	return r.subject, nil
+}
+
+// deleteEventsConfigMap removes the config map the events of the import were
+// recorded against before its DataVolume existed, if any.
+func (i *Importer) deleteEventsConfigMap() error {
+	name := fmt.Sprintf(EventsConfigMapNameFormat, i.opts.PvcName)
+	err := i.clients.CDI.DeleteConfigMap(name, i.opts.PvcNamespace)
+	if err != nil {
+		return fmt.Errorf("error deleting events config map %s/%s: %w", i.opts.PvcNamespace, name, err)
+	}
+	return nil
+}
+
+// eventsConfigMap returns the config map events are recorded against before
+// the DataVolume exists, creating it when missing.
+func (r *eventRecorder) eventsConfigMap(state *State) (*k8sv1.ConfigMap, error) {
+	name := fmt.Sprintf(EventsConfigMapNameFormat, state.PvcName)
+	configMap, err := r.client.GetConfigMap(name, state.PvcNamespace)
+	if err == nil {
+		return configMap, nil
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	_, err = r.client.CreateOrUpdateConfigMap(&k8sv1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: state.PvcNamespace,
+		},
+		Data: map[string]string{
+			"pvcName": state.PvcName,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.client.GetConfigMap(name, state.PvcNamespace)
+}
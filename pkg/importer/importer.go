@@ -0,0 +1,415 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"kubevirt.io/kubevirt-cloud-import/pkg/disk"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+	"kubevirt.io/kubevirt-cloud-import/pkg/tracing"
+)
+
+const (
+	S3PrefixFormat           = "kubevirt-image-exports/orig-%s-"
+	S3ImportSecretNameFormat = "%s-s3-import"
+
+	DefaultVerifyImage  = "quay.io/dvossel/import-ami:latest"
+	DefaultConvertImage = DefaultVerifyImage
+
+	DefaultTimeout      = 15 * time.Minute
+	DefaultPollInterval = 15 * time.Second
+)
+
+// The steps of an import, in the order they run.
+const (
+	StepResolve          = "resolve"
+	StepCopy             = "copy"
+	StepWaitAvailable    = "wait-available"
+	StepExport           = "export"
+	StepWaitExport       = "wait-export"
+	StepCreateDataVolume = "create-dv"
+	StepWaitImport       = "wait-import"
+	StepVerify           = "verify"
+	StepConvert          = "convert"
+	StepCleanup          = "cleanup"
+	// StepDone marks an import with no step left to run.
+	StepDone = "done"
+)
+
+// Options describe a single import.
+type Options struct {
+	Region string
+
+	// AmiId or SnapshotId is the source of the import.
+	AmiId      string
+	SnapshotId string
+	// SnapshotArchitecture and SnapshotBootMode are detected when unset.
+	SnapshotArchitecture string
+	SnapshotBootMode     string
+
+	S3Bucket     string
+	ExportFormat string
+	KmsKeyId     string
+	// VMImportRoleName is the service role the export runs with, vmimport
+	// when empty.
+	VMImportRoleName string
+
+	// S3SecretName is the secret CDI reads the export with. When
+	// S3ReaderRoleArn is set a secret scoped to the export is minted instead.
+	S3SecretName          string
+	S3ReaderRoleArn       string
+	S3CredentialsDuration time.Duration
+
+	PvcName         string
+	PvcNamespace    string
+	PvcStorageClass string
+	PvcAccessMode   string
+	PvcSize         resource.Quantity
+
+	Verify      bool
+	VerifyImage string
+
+	// Convert runs a Job converting the guest of the imported pvc for
+	// KubeVirt, as Conversion selects, once it is imported and verified.
+	Convert      bool
+	ConvertImage string
+	Conversion   disk.ConversionOptions
+
+	// Timeouts bound the steps waiting on AWS and CDI, and PollInterval is
+	// how often they poll. Unset values default to DefaultTimeout and
+	// DefaultPollInterval.
+	Timeouts     Timeouts
+	PollInterval time.Duration
+	// Retry reruns a step failing with a transient error. Defaults to
+	// retry.DefaultPolicy.
+	Retry retry.Policy
+
+	// Trace, when set, records the import and its steps as a trace. The
+	// clients record their calls into the same scope to appear in it.
+	Trace *tracing.Scope
+	// Log is the logger of the import. Defaults to logging.Default().
+	Log logr.Logger
+}
+
+// Timeouts are the time allowed for each step that waits.
+type Timeouts struct {
+	// Copy bounds the copy of a snapshot shared from another account.
+	Copy time.Duration
+	// Available bounds the wait for a copied or registered AMI.
+	Available time.Duration
+	Export    time.Duration
+	Import    time.Duration
+	Verify    time.Duration
+	Convert   time.Duration
+}
+
+func (t *Timeouts) setDefaults() {
+	for _, timeout := range []*time.Duration{&t.Copy, &t.Available, &t.Export, &t.Import, &t.Verify, &t.Convert} {
+		if *timeout == 0 {
+			*timeout = DefaultTimeout
+		}
+	}
+}
+
+// ErrCancelled is returned by Run when the import is cancelled between steps.
+var ErrCancelled = errors.New("import cancelled")
+
+// ErrNoState is returned by Teardown when the import has no saved state, as
+// after it completed, so nothing it created is known.
+var ErrNoState = errors.New("no saved state of the import")
+
+// Observer is notified as an import runs its steps.
+type Observer interface {
+	StepStarted(step string, state *State)
+	// StepProgress reports the progress of a long running step, such as the
+	// percentage of an export.
+	StepProgress(step string, state *State, message string)
+	StepSucceeded(step string, state *State)
+	StepFailed(step string, state *State, err error)
+}
+
+// StepError is returned by Run when a step fails.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %s failed: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+type step struct {
+	name string
+	run  func() error
+}
+
+// Importer imports an AMI, or an EBS snapshot, into a pvc as a series of
+// steps, saving its state after each one.
+type Importer struct {
+	opts    Options
+	clients Clients
+	store   StateStore
+	state   *State
+
+	observers []Observer
+
+	cancelOnce sync.Once
+	cancelled  chan struct{}
+
+	// sourceDigest is set while the exported image is hashed alongside
+	// the DataVolume import, which closing stopDigest abandons.
+	sourceDigest chan sourceDigest
+	stopDigest   chan struct{}
+
+	// startTime, completionTime and stepResults record Run for Result.
+	startTime      time.Time
+	completionTime time.Time
+	stepResults    []StepResult
+	// exportedSize caches the size of the exported object once read.
+	exportedSize int64
+	// span is the root span of the trace of Run.
+	span *tracing.Span
+	// step is the step running, logged with every entry.
+	step string
+}
+
+func New(opts Options, clients Clients, store StateStore) *Importer {
+	if clients.Copy == nil {
+		clients.Copy = clients.AWS
+	}
+	if clients.Export == nil {
+		clients.Export = clients.AWS
+	}
+	if opts.VerifyImage == "" {
+		opts.VerifyImage = DefaultVerifyImage
+	}
+	if opts.ConvertImage == "" {
+		opts.ConvertImage = DefaultConvertImage
+	}
+	if opts.Conversion.Tool == "" {
+		opts.Conversion.Tool = disk.ConvertToolVirtCustomize
+	}
+	opts.Timeouts.setDefaults()
+	if opts.PollInterval == 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.Retry.MaxAttempts == 0 {
+		opts.Retry = retry.DefaultPolicy()
+	}
+	if opts.Log == nil {
+		opts.Log = logging.Default()
+	}
+	return &Importer{opts: opts, clients: clients, store: store, cancelled: make(chan struct{})}
+}
+
+// AddObserver registers o to be notified of every step Run runs.
+func (i *Importer) AddObserver(o Observer) {
+	i.observers = append(i.observers, o)
+}
+
+// Cancel stops Run before its next step. A step already running completes.
+func (i *Importer) Cancel() {
+	i.cancelOnce.Do(func() {
+		close(i.cancelled)
+	})
+}
+
+// State returns the state of the import, which is nil before Run.
+func (i *Importer) State() *State {
+	return i.state
+}
+
+func (i *Importer) steps() []step {
+	return []step{
+		{name: StepResolve, run: i.resolve},
+		{name: StepCopy, run: i.copy},
+		{name: StepWaitAvailable, run: i.waitAvailable},
+		{name: StepExport, run: i.export},
+		{name: StepWaitExport, run: i.waitExport},
+		{name: StepCreateDataVolume, run: i.createDataVolume},
+		{name: StepWaitImport, run: i.waitImport},
+		{name: StepVerify, run: i.verify},
+		{name: StepConvert, run: i.convert},
+		{name: StepCleanup, run: i.cleanup},
+	}
+}
+
+// loadState returns the saved state of the import, or a new state when
+// there is none.
+func (i *Importer) loadState() (*State, error) {
+	state, err := i.store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if state == nil {
+		return &State{
+			Step:         StepResolve,
+			SourceAmiId:  i.opts.AmiId,
+			SnapshotId:   i.opts.SnapshotId,
+			PvcName:      i.opts.PvcName,
+			PvcNamespace: i.opts.PvcNamespace,
+		}, nil
+	}
+
+	if err := i.checkState(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// checkState returns an error unless the saved state belongs to the import.
+func (i *Importer) checkState(state *State) error {
+	if state.SourceAmiId != i.opts.AmiId || state.SnapshotId != i.opts.SnapshotId || state.PvcName != i.opts.PvcName || state.PvcNamespace != i.opts.PvcNamespace {
+		return fmt.Errorf("saved state belongs to the import of %s%s into pvc %s/%s", state.SourceAmiId, state.SnapshotId, state.PvcNamespace, state.PvcName)
+	}
+	return nil
+}
+
+// Run runs every step not yet completed according to the saved state. The
+// state is removed once all steps succeed.
+func (i *Importer) Run() error {
+	i.startTime = time.Now()
+	i.span = i.opts.Trace.Tracer().Start(nil, "import", tracing.SpanKindInternal)
+	i.span.SetAttribute("import.source_ami_id", i.opts.AmiId)
+	i.span.SetAttribute("import.snapshot_id", i.opts.SnapshotId)
+	i.span.SetAttribute("k8s.namespace.name", i.opts.PvcNamespace)
+	i.span.SetAttribute("k8s.pvc.name", i.opts.PvcName)
+	i.opts.Trace.SetCurrent(i.span)
+
+	importsInFlight.Inc()
+	err := i.run()
+	// a digest is left running when the import failed before verify
+	i.stopSourceDigest()
+	importsInFlight.Dec()
+	i.completionTime = time.Now()
+
+	i.recordMetrics(err)
+	setStateAttributes(i.span, i.state)
+	i.opts.Trace.SetCurrent(nil)
+	i.span.End(err)
+	return err
+}
+
+func (i *Importer) run() error {
+	state, err := i.loadState()
+	if err != nil {
+		return err
+	}
+	i.state = state
+
+	steps := i.steps()
+	start := len(steps)
+	for idx, s := range steps {
+		if s.name == state.Step {
+			start = idx
+			break
+		}
+	}
+	if state.Step != StepResolve && start < len(steps) {
+		i.logger().Info("Resuming import", "resumeStep", state.Step)
+	}
+
+	for idx := start; idx < len(steps); idx++ {
+		select {
+		case <-i.cancelled:
+			return ErrCancelled
+		default:
+		}
+
+		s := steps[idx]
+		i.step = s.name
+		i.logger().Info("Running step")
+		for _, o := range i.observers {
+			o.StepStarted(s.name, state)
+		}
+		stepStart := time.Now()
+		span := i.opts.Trace.StartChild(s.name, tracing.SpanKindInternal)
+		i.opts.Trace.SetCurrent(span)
+		policy := i.opts.Retry
+		policy.Log = i.logger()
+		err := policy.Do(fmt.Sprintf("step %s", s.name), i.cancelled, s.run)
+		i.opts.Trace.SetCurrent(i.span)
+		setStateAttributes(span, state)
+		span.End(err)
+		i.recordStep(s.name, stepStart, err)
+		i.step = ""
+		if err == retry.ErrStopped {
+			return ErrCancelled
+		} else if err != nil {
+			for _, o := range i.observers {
+				o.StepFailed(s.name, state, err)
+			}
+			return &StepError{Step: s.name, Err: err}
+		}
+		for _, o := range i.observers {
+			o.StepSucceeded(s.name, state)
+		}
+
+		state.Step = StepDone
+		if idx+1 < len(steps) {
+			state.Step = steps[idx+1].name
+		}
+		if err := i.store.Save(state); err != nil {
+			return fmt.Errorf("unable to save state after step %s: %v", s.name, err)
+		}
+	}
+
+	return i.store.Delete()
+}
+
+// setStateAttributes records the resources of an import known so far on
+// span.
+func setStateAttributes(span *tracing.Span, state *State) {
+	if state == nil {
+		return
+	}
+	span.SetAttribute("import.account_id", state.AccountId)
+	span.SetAttribute("import.ami_id", state.AmiId)
+	span.SetAttribute("import.export_ami_id", state.ExportAmiId)
+	span.SetAttribute("import.snapshot_copy_id", state.SnapshotCopyId)
+	span.SetAttribute("import.export_task_id", state.ExportTaskId)
+	if state.S3Key != "" {
+		span.SetAttribute("import.s3_path", fmt.Sprintf("s3://%s/%s", state.S3Bucket, state.S3Key))
+	}
+	span.SetAttribute("import.datavolume", state.DataVolume)
+}
+
+// logger returns the logger of the import, carrying the keys of the
+// resources known so far and of the step running.
+func (i *Importer) logger() logr.Logger {
+	values := []interface{}{logging.KeyPvc, i.opts.PvcName, logging.KeyNamespace, i.opts.PvcNamespace}
+	add := func(key string, value string) {
+		if value != "" {
+			values = append(values, key, value)
+		}
+	}
+
+	// the ami of snapshot imports is the one registered from the snapshot
+	state := i.state
+	if state == nil {
+		state = &State{}
+	}
+	ami := i.opts.AmiId
+	if state.AmiId != "" {
+		ami = state.AmiId
+	}
+	add(logging.KeyAmi, ami)
+	add(logging.KeySnapshot, i.opts.SnapshotId)
+	if state.ExportAmiId != state.AmiId {
+		add(logging.KeyCopyAmi, state.ExportAmiId)
+	}
+	add(logging.KeyTaskId, state.ExportTaskId)
+	add(logging.KeyDataVolume, state.DataVolume)
+	add(logging.KeyStep, i.step)
+	return i.opts.Log.WithValues(values...)
+}
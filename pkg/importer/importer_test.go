@@ -0,0 +1,416 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+)
+
+// fakeAWSClient records the calls of an import. Calls it does not implement
+// panic through the nil embedded interface, failing the test.
+type fakeAWSClient struct {
+	AWSClient
+	calls []string
+}
+
+func (c *fakeAWSClient) WaitForExportImageCompletion(amiId string, taskId string, imageFormat string, timeout time.Duration, pollInterval time.Duration, progress aws.ExportProgressFunc) (string, string, error) {
+	c.calls = append(c.calls, "WaitForExportImageCompletion "+taskId)
+	return "bucket", "exports/" + taskId + ".vmdk", nil
+}
+
+// HeadS3Object and GetPvc are read by the metrics of Run rather than by a
+// step, so they are not recorded.
+func (c *fakeAWSClient) HeadS3Object(bucket string, key string) (*aws.S3Object, error) {
+	return &aws.S3Object{Size: 1024}, nil
+}
+
+// OpenS3Object streams zeroes without end.
+func (c *fakeAWSClient) OpenS3Object(bucket string, key string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(zeroReader{}), nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for idx := range p {
+		p[idx] = 0
+	}
+	return len(p), nil
+}
+
+func (c *fakeAWSClient) CancelExportTask(exportTaskId string) error {
+	c.calls = append(c.calls, "CancelExportTask "+exportTaskId)
+	return nil
+}
+
+func (c *fakeAWSClient) DeleteS3Object(bucket string, key string) error {
+	c.calls = append(c.calls, "DeleteS3Object s3://"+bucket+"/"+key)
+	return nil
+}
+
+func (c *fakeAWSClient) DeleteImageAndSnapshots(amiId string) error {
+	c.calls = append(c.calls, "DeleteImageAndSnapshots "+amiId)
+	return nil
+}
+
+func (c *fakeAWSClient) DeregisterImage(amiId string) error {
+	c.calls = append(c.calls, "DeregisterImage "+amiId)
+	return nil
+}
+
+func (c *fakeAWSClient) DeleteSnapshot(snapshotId string) error {
+	c.calls = append(c.calls, "DeleteSnapshot "+snapshotId)
+	return nil
+}
+
+type fakeCDIClient struct {
+	CDIClient
+	calls     []string
+	importErr error
+}
+
+func (c *fakeCDIClient) ImportFromS3IntoPvc(pvcName, pvcNamespace, pvcStorageClass, pvcAccessMode, s3Bucket, s3FilePath, s3Region, s3SecretName, diskFormat string, storageQuantity resource.Quantity) error {
+	c.calls = append(c.calls, "ImportFromS3IntoPvc s3://"+s3Bucket+"/"+s3FilePath)
+	return nil
+}
+
+func (c *fakeCDIClient) WaitForS3ImportCompletion(pvcName string, pvcNamespace string, timeout time.Duration, pollInterval time.Duration) error {
+	c.calls = append(c.calls, "WaitForS3ImportCompletion "+pvcName)
+	return c.importErr
+}
+
+func (c *fakeCDIClient) DeleteConfigMap(name string, namespace string) error {
+	c.calls = append(c.calls, "DeleteConfigMap "+name)
+	return nil
+}
+
+func (c *fakeCDIClient) DeleteDataVolume(name string, namespace string) error {
+	c.calls = append(c.calls, "DeleteDataVolume "+name)
+	return nil
+}
+
+func (c *fakeCDIClient) DeleteSecret(name string, namespace string) error {
+	c.calls = append(c.calls, "DeleteSecret "+name)
+	return nil
+}
+
+func (c *fakeCDIClient) GetPvc(name string, namespace string) (*k8sv1.PersistentVolumeClaim, error) {
+	return &k8sv1.PersistentVolumeClaim{}, nil
+}
+
+func newTestImporter(awsClient AWSClient, cdiClient CDIClient, store StateStore) *Importer {
+	opts := Options{
+		Region:       "us-east-1",
+		AmiId:        "ami-1",
+		S3Bucket:     "bucket",
+		ExportFormat: aws.ExportImageFormatVmdk,
+		PvcName:      "disk",
+		PvcNamespace: "default",
+		PollInterval: time.Millisecond,
+		Retry:        retry.Policy{MaxAttempts: 1},
+	}
+	return New(opts, Clients{AWS: awsClient, CDI: cdiClient}, store)
+}
+
+func TestRunResumesFromSavedState(t *testing.T) {
+	store := NewMemoryStateStore()
+	saved := &State{
+		Step:         StepWaitExport,
+		SourceAmiId:  "ami-1",
+		PvcName:      "disk",
+		PvcNamespace: "default",
+		AccountId:    "111111111111",
+		AmiId:        "ami-1",
+		ExportAmiId:  "ami-1",
+		ExportTaskId: "export-ami-1",
+	}
+	if err := store.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	awsClient := &fakeAWSClient{}
+	cdiClient := &fakeCDIClient{importErr: errors.New("import failed")}
+	err := newTestImporter(awsClient, cdiClient, store).Run()
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Step != StepWaitImport {
+		t.Fatalf("Run() = %v, want a failure of step %s", err, StepWaitImport)
+	}
+
+	wantAWS := []string{"WaitForExportImageCompletion export-ami-1"}
+	if !reflect.DeepEqual(awsClient.calls, wantAWS) {
+		t.Errorf("aws calls = %v, want %v", awsClient.calls, wantAWS)
+	}
+	wantCDI := []string{"ImportFromS3IntoPvc s3://bucket/exports/export-ami-1.vmdk", "WaitForS3ImportCompletion disk"}
+	if !reflect.DeepEqual(cdiClient.calls, wantCDI) {
+		t.Errorf("cdi calls = %v, want %v", cdiClient.calls, wantCDI)
+	}
+
+	state, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || state.Step != StepWaitImport || state.S3Key != "exports/export-ami-1.vmdk" || state.DataVolume != "disk" {
+		t.Fatalf("saved state = %+v, want step %s with the export and DataVolume recorded", state, StepWaitImport)
+	}
+
+	// a rerun resumes at the failed step without recreating the DataVolume
+	awsClient = &fakeAWSClient{}
+	cdiClient = &fakeCDIClient{}
+	if err := newTestImporter(awsClient, cdiClient, store).Run(); err != nil {
+		t.Fatalf("Run() returned error on rerun: %v", err)
+	}
+	if len(awsClient.calls) != 0 {
+		t.Errorf("aws calls on rerun = %v, want none", awsClient.calls)
+	}
+	wantCDI = []string{"WaitForS3ImportCompletion disk", "DeleteConfigMap disk-import-events"}
+	if !reflect.DeepEqual(cdiClient.calls, wantCDI) {
+		t.Errorf("cdi calls on rerun = %v, want %v", cdiClient.calls, wantCDI)
+	}
+
+	state, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	} else if state != nil {
+		t.Errorf("saved state = %+v after a completed import, want none", state)
+	}
+}
+
+func TestRunRejectsStateOfAnotherImport(t *testing.T) {
+	store := NewMemoryStateStore()
+	saved := &State{
+		Step:         StepWaitExport,
+		SourceAmiId:  "ami-2",
+		PvcName:      "disk",
+		PvcNamespace: "default",
+	}
+	if err := store.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	awsClient := &fakeAWSClient{}
+	cdiClient := &fakeCDIClient{}
+	if err := newTestImporter(awsClient, cdiClient, store).Run(); err == nil {
+		t.Fatal("Run() succeeded with the saved state of another import")
+	}
+	if len(awsClient.calls) != 0 || len(cdiClient.calls) != 0 {
+		t.Errorf("calls = %v %v, want none", awsClient.calls, cdiClient.calls)
+	}
+}
+
+func TestTeardown(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   State
+		wantAWS []string
+		wantCDI []string
+	}{
+		{
+			name: "created",
+			state: State{
+				Step:           StepWaitExport,
+				AmiId:          "ami-1",
+				CopyRequired:   true,
+				ExportAmiId:    "ami-copy",
+				AmiCopyCreated: true,
+				ExportTaskId:   "export-ami-copy",
+				ExportCreated:  true,
+			},
+			wantAWS: []string{"CancelExportTask export-ami-copy", "DeleteImageAndSnapshots ami-copy"},
+			wantCDI: []string{"DeleteConfigMap disk-import-events"},
+		},
+		{
+			name: "reused",
+			state: State{
+				Step:         StepWaitImport,
+				AmiId:        "ami-1",
+				CopyRequired: true,
+				ExportAmiId:  "ami-copy",
+				S3Bucket:     "bucket",
+				S3Key:        "exports/export-ami-copy.vmdk",
+				DataVolume:   "disk",
+			},
+			wantCDI: []string{"DeleteDataVolume disk", "DeleteConfigMap disk-import-events"},
+		},
+		{
+			name: "completed",
+			state: State{
+				Step:           StepDone,
+				AmiId:          "ami-1",
+				CopyRequired:   true,
+				ExportAmiId:    "ami-copy",
+				AmiCopyCreated: true,
+				S3Bucket:       "bucket",
+				S3Key:          "exports/export-ami-copy.vmdk",
+				ExportCreated:  true,
+				SecretName:     "disk-s3-import",
+				DataVolume:     "disk",
+			},
+			wantAWS: []string{"DeleteS3Object s3://bucket/exports/export-ami-copy.vmdk", "DeleteImageAndSnapshots ami-copy"},
+			wantCDI: []string{"DeleteSecret disk-s3-import", "DeleteConfigMap disk-import-events"},
+		},
+	}
+
+	for _, tt := range tests {
+		store := NewMemoryStateStore()
+		state := tt.state
+		state.SourceAmiId = "ami-1"
+		state.PvcName = "disk"
+		state.PvcNamespace = "default"
+		if err := store.Save(&state); err != nil {
+			t.Fatal(err)
+		}
+
+		awsClient := &fakeAWSClient{}
+		cdiClient := &fakeCDIClient{}
+		if err := newTestImporter(awsClient, cdiClient, store).Teardown(); err != nil {
+			t.Errorf("%s: Teardown() returned error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(awsClient.calls, tt.wantAWS) {
+			t.Errorf("%s: aws calls = %v, want %v", tt.name, awsClient.calls, tt.wantAWS)
+		}
+		if !reflect.DeepEqual(cdiClient.calls, tt.wantCDI) {
+			t.Errorf("%s: cdi calls = %v, want %v", tt.name, cdiClient.calls, tt.wantCDI)
+		}
+		if saved, _ := store.Load(); saved != nil {
+			t.Errorf("%s: saved state = %+v after teardown, want none", tt.name, saved)
+		}
+	}
+}
+
+func TestTeardownWithoutState(t *testing.T) {
+	err := newTestImporter(&fakeAWSClient{}, &fakeCDIClient{}, NewMemoryStateStore()).Teardown()
+	if !errors.Is(err, ErrNoState) {
+		t.Errorf("Teardown() = %v, want %v", err, ErrNoState)
+	}
+}
+
+func TestCleanupSnapshotImport(t *testing.T) {
+	awsClient := &fakeAWSClient{}
+	cdiClient := &fakeCDIClient{}
+	i := newTestImporter(awsClient, cdiClient, NewMemoryStateStore())
+	i.opts.AmiId = ""
+	i.opts.SnapshotId = "snap-1"
+	i.state = &State{
+		SnapshotId:          "snap-1",
+		PvcName:             "disk",
+		PvcNamespace:        "default",
+		AmiId:               "ami-temporary",
+		AmiCreated:          true,
+		SnapshotCopyId:      "snap-copy",
+		SnapshotCopyCreated: true,
+		CopyRequired:        true,
+		ExportAmiId:         "ami-copy",
+		AmiCopyCreated:      true,
+	}
+
+	if err := i.cleanup(); err != nil {
+		t.Fatalf("cleanup() returned error: %v", err)
+	}
+	want := []string{"DeleteImageAndSnapshots ami-copy", "DeregisterImage ami-temporary", "DeleteSnapshot snap-copy"}
+	if !reflect.DeepEqual(awsClient.calls, want) {
+		t.Errorf("aws calls = %v, want %v", awsClient.calls, want)
+	}
+	if i.state.AmiCopyCreated {
+		t.Error("copy of the temporary ami is still recorded after cleanup, teardown would delete it again")
+	}
+}
+
+func TestCreateDataVolumeChecksRawSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    string
+		wantErr bool
+	}{
+		{name: "fits", size: "1Ki"},
+		{name: "too small", size: "512", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		cdiClient := &fakeCDIClient{}
+		i := newTestImporter(&fakeAWSClient{}, cdiClient, NewMemoryStateStore())
+		i.opts.ExportFormat = aws.ExportImageFormatRaw
+		i.opts.PvcSize = resource.MustParse(tt.size)
+		i.state = &State{S3Bucket: "bucket", S3Key: "exports/export-ami-1.raw"}
+
+		err := i.createDataVolume()
+		if tt.wantErr {
+			if err == nil || len(cdiClient.calls) != 0 {
+				t.Errorf("%s: createDataVolume() = %v with calls %v, want an error before creating the DataVolume", tt.name, err, cdiClient.calls)
+			}
+		} else if err != nil {
+			t.Errorf("%s: createDataVolume() returned error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestDigestStops(t *testing.T) {
+	stop := make(chan struct{})
+	digests := make(chan sourceDigest, 1)
+	go func() {
+		digests <- digestExportedImage(&fakeAWSClient{}, "bucket", "exports/export-ami-1.raw", aws.ExportImageFormatRaw, stop)
+	}()
+	close(stop)
+
+	select {
+	case source := <-digests:
+		if !errors.Is(source.err, errDigestStopped) {
+			t.Errorf("digestExportedImage() = %v, want %v", source.err, errDigestStopped)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("digestExportedImage() did not return once stopped")
+	}
+}
+
+// fakeEventClient records the events created and updated. updateErr fails
+// updates, as for an event the API server expired.
+type fakeEventClient struct {
+	EventClient
+	created   []string
+	updated   []string
+	updateErr error
+}
+
+func (c *fakeEventClient) CreateEvent(event *k8sv1.Event) error {
+	c.created = append(c.created, event.Message)
+	return nil
+}
+
+func (c *fakeEventClient) UpdateEvent(event *k8sv1.Event) error {
+	if c.updateErr != nil {
+		return c.updateErr
+	}
+	c.updated = append(c.updated, fmt.Sprintf("%s (%d)", event.Message, event.Count))
+	return nil
+}
+
+func TestEventRecorderAggregatesExportProgress(t *testing.T) {
+	client := &fakeEventClient{}
+	recorder := NewEventRecorder(client, &k8sv1.ObjectReference{Kind: "AMIImport", Name: "fedora", Namespace: "default"})
+	state := &State{PvcName: "disk", PvcNamespace: "default"}
+
+	for _, progress := range []string{"10%", "20%", "30%"} {
+		recorder.StepProgress(StepWaitExport, state, progress)
+	}
+	wantCreated := []string{"Image export: 10%"}
+	wantUpdated := []string{"Image export: 20% (2)", "Image export: 30% (3)"}
+	if !reflect.DeepEqual(client.created, wantCreated) || !reflect.DeepEqual(client.updated, wantUpdated) {
+		t.Errorf("created %v and updated %v, want %v and %v", client.created, client.updated, wantCreated, wantUpdated)
+	}
+
+	client.updateErr = errors.New("not found")
+	recorder.StepProgress(StepWaitExport, state, "40%")
+	wantCreated = append(wantCreated, "Image export: 40%")
+	if !reflect.DeepEqual(client.created, wantCreated) {
+		t.Errorf("created %v after a failed update, want %v", client.created, wantCreated)
+	}
+}
@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	k8sv1 "k8s.io/api/core/v1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/metrics"
+)
+
+// durationBuckets span imports of small images, which take a minute, to
+// exports of large ones, which take hours.
+var durationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200, 14400, 28800}
+
+var (
+	metricsFactory = promauto.With(metrics.Registry)
+
+	importsInFlight = metricsFactory.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_import_imports_in_flight",
+		Help: "Number of imports running.",
+	})
+	importsTotal = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_import_imports_total",
+		Help: "Number of imports that ended, by status.",
+	}, []string{"status"})
+	importDuration = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cloud_import_import_duration_seconds",
+		Help:    "Duration of imports, by status.",
+		Buckets: durationBuckets,
+	}, []string{"status"})
+	stepDuration = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cloud_import_step_duration_seconds",
+		Help:    "Duration of the steps of imports, by step and status.",
+		Buckets: durationBuckets,
+	}, []string{"step", "status"})
+	importFailures = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_import_failures_total",
+		Help: "Number of failed imports, by the step that failed and the error code.",
+	}, []string{"step", "reason"})
+	exportedBytes = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_import_exported_bytes_total",
+		Help: "Size of the images exported to s3, by export format.",
+	}, []string{"format"})
+	importedBytes = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_import_imported_bytes_total",
+		Help: "Capacity of the pvcs images were imported into, by storage class.",
+	}, []string{"storage_class"})
+)
+
+// recordMetrics records the outcome of Run, which returned err.
+func (i *Importer) recordMetrics(err error) {
+	result := NewFailedResult(i.opts, err)
+	importsTotal.WithLabelValues(result.Status).Inc()
+	importDuration.WithLabelValues(result.Status).Observe(i.completionTime.Sub(i.startTime).Seconds())
+
+	if err != nil {
+		step := result.FailedStep
+		if step == "" {
+			step = "none"
+		}
+		importFailures.WithLabelValues(step, result.ErrorCode).Inc()
+		return
+	}
+
+	if size := i.exportSize(); size > 0 {
+		exportedBytes.WithLabelValues(i.opts.ExportFormat).Add(float64(size))
+	}
+
+	pvc, err := i.clients.CDI.GetPvc(i.opts.PvcName, i.opts.PvcNamespace)
+	if err != nil {
+		i.logger().Error(err, "Unable to read the capacity of pvc for metrics")
+		return
+	}
+	storageClass := ""
+	if pvc.Spec.StorageClassName != nil {
+		storageClass = *pvc.Spec.StorageClassName
+	}
+	if capacity, ok := pvc.Status.Capacity[k8sv1.ResourceStorage]; ok {
+		importedBytes.WithLabelValues(storageClass).Add(float64(capacity.Value()))
+	}
+}
+
+// exportSize returns the size of the exported object, or 0 when it is not
+// known or can not be read.
+func (i *Importer) exportSize() int64 {
+	if i.exportedSize != 0 || i.state == nil || i.state.S3Key == "" {
+		return i.exportedSize
+	}
+
+	object, err := i.clients.AWS.HeadS3Object(i.state.S3Bucket, i.state.S3Key)
+	if err != nil {
+		i.logger().Error(err, "Unable to read the size of the s3 export", "s3Path", fmt.Sprintf("s3://%s/%s", i.state.S3Bucket, i.state.S3Key))
+		return 0
+	}
+	i.exportedSize = object.Size
+	return i.exportedSize
+}
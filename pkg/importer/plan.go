@@ -0,0 +1,315 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1beta1"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+)
+
+// Placeholders of the ids a plan can not know before the resources exist.
+const (
+	PlanRegisteredAmiId = "<registered-ami-id>"
+	PlanCopiedAmiId     = "<copied-ami-id>"
+	PlanSnapshotCopyId  = "<snapshot-copy-id>"
+	PlanExportTaskId    = "<export-task-id>"
+)
+
+// Plan describes what Run would do, as far as it can be determined without
+// making any change in AWS or the cluster.
+type Plan struct {
+	SourceAmiId string `json:"sourceAmiId,omitempty"`
+	SnapshotId  string `json:"snapshotId,omitempty"`
+	AccountId   string `json:"accountId"`
+	// ResumeStep is the step a saved state of the import resumes at.
+	ResumeStep string `json:"resumeStep,omitempty"`
+
+	// AmiId is the AMI imported, the source AMI or the AMI registered
+	// from the snapshot.
+	AmiId        string   `json:"amiId"`
+	ImageOwnerId string   `json:"imageOwnerId,omitempty"`
+	Blockers     []string `json:"blockers,omitempty"`
+
+	CopyRequired bool   `json:"copyRequired"`
+	CopyReason   string `json:"copyReason,omitempty"`
+	CopyName     string `json:"copyName,omitempty"`
+	CopyExists   bool   `json:"copyExists,omitempty"`
+	EncryptCopy  bool   `json:"encryptCopy,omitempty"`
+
+	// ExportAmiId is the AMI exported to s3.
+	ExportAmiId      string `json:"exportAmiId"`
+	ExportReused     bool   `json:"exportReused"`
+	ExportInProgress bool   `json:"exportInProgress,omitempty"`
+	S3Bucket         string `json:"s3Bucket"`
+	S3Key            string `json:"s3Key"`
+
+	// SecretName is the s3 secret minted for the DataVolume, if any.
+	SecretName string            `json:"secretName,omitempty"`
+	DataVolume *cdiv1.DataVolume `json:"dataVolume"`
+
+	// Actions lists, in order, what the import would do.
+	Actions []string `json:"actions"`
+}
+
+func (p *Plan) addAction(format string, args ...interface{}) {
+	p.Actions = append(p.Actions, fmt.Sprintf(format, args...))
+}
+
+// Plan determines what Run would do using only read calls.
+func (i *Importer) Plan() (*Plan, error) {
+	opts := i.opts
+	plan := &Plan{
+		SourceAmiId: opts.AmiId,
+		SnapshotId:  opts.SnapshotId,
+		AmiId:       opts.AmiId,
+	}
+
+	state, err := i.store.Load()
+	if err != nil {
+		return nil, err
+	} else if state != nil {
+		plan.ResumeStep = state.Step
+	}
+
+	myAccount, err := i.clients.Copy.GetMyAccountId()
+	if err != nil {
+		return nil, fmt.Errorf("unable to detect account id: %w", err)
+	}
+	if i.clients.Export != i.clients.Copy {
+		exportAccount, err := i.clients.Export.GetMyAccountId()
+		if err != nil {
+			return nil, fmt.Errorf("unable to detect account id of export role: %w", err)
+		} else if exportAccount != myAccount {
+			return nil, fmt.Errorf("export role belongs to account %s but copies are made in account %s, both roles must belong to the same account", exportAccount, myAccount)
+		}
+	}
+	plan.AccountId = myAccount
+
+	registered := true
+	if opts.SnapshotId != "" {
+		registered, err = i.planSnapshotImage(plan)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if registered {
+		err = i.planCopy(plan)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// the registered AMI is owned by the client's account
+		plan.ExportAmiId = plan.AmiId
+	}
+
+	if plan.ExportAmiId != "" {
+		err = i.planExport(plan, registered && !(plan.CopyRequired && !plan.CopyExists))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	i.planDataVolume(plan)
+	return plan, nil
+}
+
+// planSnapshotImage mirrors registerSnapshotImage. It returns whether the
+// temporary AMI is already registered.
+func (i *Importer) planSnapshotImage(plan *Plan) (bool, error) {
+	snapshotId := i.opts.SnapshotId
+
+	snapshot, err := i.clients.AWS.FindSnapshotById(snapshotId)
+	if err != nil {
+		return false, fmt.Errorf("err encountered looking up snapshot %s: %w", snapshotId, err)
+	} else if snapshot.OwnerId == nil {
+		return false, fmt.Errorf("snapshot is missing owner id")
+	}
+
+	snapshotToRegister := snapshotId
+	if *snapshot.OwnerId != plan.AccountId {
+		snapshotCopy, exists, err := i.clients.Copy.FindSnapshotCopy(snapshotId, plan.AccountId)
+		if err != nil {
+			return false, fmt.Errorf("error encountered while searching for snapshot copy: %w", err)
+		}
+		if exists {
+			snapshotToRegister = *snapshotCopy.SnapshotId
+			plan.addAction("reuse copy %s of snapshot %s in account %s", snapshotToRegister, snapshotId, plan.AccountId)
+		} else {
+			snapshotToRegister = PlanSnapshotCopyId
+			plan.addAction("copy snapshot %s owned by account %s into account %s", snapshotId, *snapshot.OwnerId, plan.AccountId)
+		}
+	}
+
+	snapshotImageName := i.clients.Copy.SnapshotImageName(snapshotToRegister)
+	if snapshotToRegister != PlanSnapshotCopyId {
+		snapshotImage, exists, err := i.clients.Copy.FindImageByName(snapshotImageName, plan.AccountId)
+		if err != nil {
+			return false, fmt.Errorf("error encountered while searching for image by name: %w", err)
+		} else if exists && snapshotImage.ImageId != nil {
+			plan.AmiId = *snapshotImage.ImageId
+			plan.addAction("reuse temporary ami %s registered from snapshot %s", plan.AmiId, snapshotToRegister)
+			return true, nil
+		}
+	}
+
+	arch := types.ArchitectureValues(i.opts.SnapshotArchitecture)
+	bootMode := types.BootModeValues(i.opts.SnapshotBootMode)
+	if arch == "" || bootMode == "" {
+		detectedArch, detectedBootMode, _, err := i.clients.AWS.DetectSnapshotImageSettings(snapshotId, *snapshot.OwnerId)
+		if err != nil {
+			return false, fmt.Errorf("err encountered detecting architecture of snapshot %s: %w", snapshotId, err)
+		}
+		if arch == "" {
+			arch = detectedArch
+		}
+		if bootMode == "" {
+			bootMode = detectedBootMode
+		}
+	}
+
+	plan.AmiId = PlanRegisteredAmiId
+	plan.addAction("register temporary %s/%s ami %s from snapshot %s", arch, bootMode, snapshotImageName, snapshotToRegister)
+	return false, nil
+}
+
+// planCopy mirrors the preflight of resolve and the copy step.
+func (i *Importer) planCopy(plan *Plan) error {
+	amiId := plan.AmiId
+
+	image, err := i.clients.AWS.FindGlobalImageById(amiId)
+	if err != nil {
+		return fmt.Errorf("err encountered looking up ami %s: %w", amiId, err)
+	} else if image.OwnerId == nil {
+		return fmt.Errorf("image is missing owner id")
+	}
+	plan.ImageOwnerId = *image.OwnerId
+
+	preflight, err := i.clients.AWS.CheckImageExportable(amiId, plan.AccountId)
+	if err != nil {
+		return fmt.Errorf("err encountered checking if ami %s can be exported: %w", amiId, err)
+	}
+	plan.Blockers = preflight.Blockers
+	if len(plan.Blockers) != 0 {
+		plan.addAction("refuse to import ami %s: %v", amiId, preflight.Error())
+		return nil
+	}
+	plan.EncryptCopy = len(preflight.EncryptedSnapshots) > 0
+
+	switch {
+	case plan.ImageOwnerId == plan.AccountId && !preflight.RequiresCopy:
+		plan.ExportAmiId = amiId
+		return nil
+	case plan.ImageOwnerId == plan.AccountId:
+		plan.CopyReason = preflight.CopyReason
+	default:
+		plan.CopyReason = fmt.Sprintf("image is owned by another account %s", plan.ImageOwnerId)
+	}
+	plan.CopyRequired = true
+
+	for snapshot, key := range preflight.SnapshotKmsKeys {
+		if err := i.clients.Copy.CheckSourceKmsKeyAccess(key, plan.AccountId); err != nil {
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("unable to copy encrypted snapshot %s: %v", snapshot, err))
+		}
+	}
+	if i.opts.KmsKeyId != "" {
+		if err := i.clients.Copy.CheckTargetKmsKeyAccess(i.opts.KmsKeyId, plan.AccountId); err != nil {
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("unable to encrypt copy of ami %s: %v", amiId, err))
+		}
+	}
+
+	plan.CopyName = i.clients.Copy.CopyImageName(amiId)
+	imageCopy, exists, err := i.clients.Copy.FindImageByName(plan.CopyName, plan.AccountId)
+	if err != nil {
+		return fmt.Errorf("error encountered while searching for image by name: %w", err)
+	}
+	if exists && imageCopy.ImageId != nil {
+		plan.CopyExists = true
+		plan.ExportAmiId = *imageCopy.ImageId
+		plan.addAction("reuse copy %s named %s of ami %s", plan.ExportAmiId, plan.CopyName, amiId)
+		return nil
+	}
+
+	plan.ExportAmiId = PlanCopiedAmiId
+	encryption := ""
+	if plan.EncryptCopy && i.opts.KmsKeyId != "" {
+		encryption = fmt.Sprintf(", encrypted with kms key %s", i.opts.KmsKeyId)
+	} else if plan.EncryptCopy {
+		encryption = ", encrypted with the account's default EBS key"
+	}
+	plan.addAction("copy ami %s into account %s as %s (%s)%s", amiId, plan.AccountId, plan.CopyName, plan.CopyReason, encryption)
+	return nil
+}
+
+// planExport mirrors the export step. Existing exports can only be looked
+// up when the AMI to export already exists.
+func (i *Importer) planExport(plan *Plan, exportAmiExists bool) error {
+	exportFormat := i.opts.ExportFormat
+	plan.S3Bucket = i.opts.S3Bucket
+
+	if exportAmiExists {
+		s3Bucket, s3FilePath, completed, exists, err := i.clients.Export.GetExportTaskStatus("", plan.ExportAmiId, exportFormat)
+		if err != nil {
+			return fmt.Errorf("error encountered looking up export tasks of ami %s: %w", plan.ExportAmiId, err)
+		}
+
+		if completed {
+			_, err := i.clients.AWS.HeadS3Object(s3Bucket, s3FilePath)
+			if err == nil {
+				plan.ExportReused = true
+				plan.S3Bucket = s3Bucket
+				plan.S3Key = s3FilePath
+				plan.addAction("reuse export of ami %s at s3://%s/%s", plan.ExportAmiId, s3Bucket, s3FilePath)
+				return nil
+			} else if !aws.IsNotFound(err) {
+				return fmt.Errorf("error encountered looking up s3://%s/%s: %w", s3Bucket, s3FilePath, err)
+			}
+		} else if exists {
+			plan.ExportInProgress = true
+			plan.S3Key = fmt.Sprintf(S3PrefixFormat, plan.ExportAmiId) + PlanExportTaskId + "." + exportFormat
+			plan.addAction("wait for the export of ami %s already in progress", plan.ExportAmiId)
+			return nil
+		}
+	}
+
+	plan.S3Key = fmt.Sprintf(S3PrefixFormat, plan.ExportAmiId) + PlanExportTaskId + "." + exportFormat
+	plan.addAction("export ami %s as %s to s3://%s/%s", plan.ExportAmiId, exportFormat, plan.S3Bucket, plan.S3Key)
+	return nil
+}
+
+// planDataVolume renders the DataVolume createDataVolume would create.
+func (i *Importer) planDataVolume(plan *Plan) {
+	opts := i.opts
+
+	s3SecretName := opts.S3SecretName
+	if opts.S3ReaderRoleArn != "" {
+		s3SecretName = fmt.Sprintf(S3ImportSecretNameFormat, opts.PvcName)
+		plan.SecretName = s3SecretName
+		plan.addAction("create secret %s/%s with credentials minted from role %s to read s3://%s/%s", opts.PvcNamespace, s3SecretName, opts.S3ReaderRoleArn, plan.S3Bucket, plan.S3Key)
+	}
+
+	plan.DataVolume = cdi.NewS3DataVolume(opts.PvcName,
+		opts.PvcNamespace,
+		opts.PvcStorageClass,
+		opts.PvcAccessMode,
+		plan.S3Bucket,
+		plan.S3Key,
+		opts.Region,
+		s3SecretName,
+		opts.ExportFormat,
+		opts.PvcSize)
+	plan.addAction("create DataVolume %s/%s importing s3://%s/%s", opts.PvcNamespace, opts.PvcName, plan.S3Bucket, plan.S3Key)
+
+	if opts.Verify {
+		plan.addAction("verify pvc %s/%s against the export with Job %s/%s", opts.PvcNamespace, opts.PvcName, opts.PvcNamespace, cdi.VerificationJobName(opts.PvcName))
+	}
+	if opts.Convert {
+		plan.addAction("convert the guest of pvc %s/%s with %s in Job %s/%s: %s", opts.PvcNamespace, opts.PvcName, opts.Conversion.Tool, opts.PvcNamespace, cdi.ConversionJobName(opts.PvcName), strings.Join(opts.Conversion.Changes(), ", "))
+	}
+	if opts.SnapshotId != "" {
+		plan.addAction("deregister the temporary ami %s", plan.AmiId)
+	}
+}
@@ -0,0 +1,218 @@
+package importer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/smithy-go"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+)
+
+// The status of an import and of its steps in a Result.
+const (
+	ResultSucceeded = "Succeeded"
+	ResultFailed    = "Failed"
+	ResultCancelled = "Cancelled"
+)
+
+// The error codes of a failed Result that are not the code of an AWS or
+// Kubernetes API error.
+const (
+	ErrorCodeInvalidArgument    = "InvalidArgument"
+	ErrorCodeCancelled          = "Cancelled"
+	ErrorCodeTimeout            = "Timeout"
+	ErrorCodeNotExportable      = "NotExportable"
+	ErrorCodeVerificationFailed = "VerificationFailed"
+	ErrorCodeConversionFailed   = "ConversionFailed"
+	ErrorCodeThrottling         = "Throttling"
+	ErrorCodeServerError        = "ServerError"
+	ErrorCodeNetworkError       = "NetworkError"
+	ErrorCodeUnknown            = "Unknown"
+)
+
+// Result is the machine readable outcome of an import.
+type Result struct {
+	Status string `json:"status"`
+	// ErrorCode and Error describe why a failed or cancelled import ended,
+	// and FailedStep the step it ended in.
+	ErrorCode  string `json:"errorCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	FailedStep string `json:"failedStep,omitempty"`
+
+	SourceAmiId string `json:"sourceAmiId,omitempty"`
+	SnapshotId  string `json:"snapshotId,omitempty"`
+	AccountId   string `json:"accountId,omitempty"`
+	// AmiId is the AMI imported, registered from SnapshotId for snapshot
+	// imports, and CopiedAmiId its copy when one was exported instead.
+	AmiId       string `json:"amiId,omitempty"`
+	CopiedAmiId string `json:"copiedAmiId,omitempty"`
+	// Architecture and BootMode are the settings of AmiId.
+	Architecture string `json:"architecture,omitempty"`
+	BootMode     string `json:"bootMode,omitempty"`
+
+	ExportTaskId string `json:"exportTaskId,omitempty"`
+	ExportFormat string `json:"exportFormat,omitempty"`
+	S3Bucket     string `json:"s3Bucket,omitempty"`
+	S3Key        string `json:"s3Key,omitempty"`
+	// ExportSizeBytes is the size of the exported object, when it can be
+	// read.
+	ExportSizeBytes int64 `json:"exportSizeBytes,omitempty"`
+
+	DataVolume   string `json:"dataVolume,omitempty"`
+	PvcName      string `json:"pvcName"`
+	PvcNamespace string `json:"pvcNamespace"`
+	PvcSize      string `json:"pvcSize,omitempty"`
+
+	// Steps are the steps run by this process. Steps completed by an
+	// earlier run of a resumed import are not included.
+	Steps []StepResult `json:"steps,omitempty"`
+
+	StartTime       *time.Time `json:"startTime,omitempty"`
+	CompletionTime  *time.Time `json:"completionTime,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds"`
+
+	// TraceId is the id of the trace of the import, when traced.
+	TraceId string `json:"traceId,omitempty"`
+}
+
+// StepResult is the outcome of a single step of an import.
+type StepResult struct {
+	Name            string    `json:"name"`
+	Status          string    `json:"status"`
+	StartTime       time.Time `json:"startTime"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// ErrorCode returns a stable code for the failure err describes: one of the
+// ErrorCode constants, the code of an AWS API error or the reason of a
+// Kubernetes API error.
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	switch {
+	case errors.Is(err, ErrCancelled), errors.Is(err, retry.ErrStopped):
+		return ErrorCodeCancelled
+	case errors.Is(err, retry.ErrTimeout):
+		return ErrorCodeTimeout
+	case errors.Is(err, aws.ErrNotExportable):
+		return ErrorCodeNotExportable
+	case errors.Is(err, ErrVerificationFailed):
+		return ErrorCodeVerificationFailed
+	case errors.Is(err, ErrConversionFailed):
+		return ErrorCodeConversionFailed
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() != "" {
+		return apiErr.ErrorCode()
+	}
+	var status k8serrors.APIStatus
+	if errors.As(err, &status) && status.Status().Reason != "" {
+		return string(status.Status().Reason)
+	}
+
+	switch retry.Classify(err) {
+	case retry.Throttling:
+		return ErrorCodeThrottling
+	case retry.ServerError:
+		return ErrorCodeServerError
+	case retry.Network:
+		return ErrorCodeNetworkError
+	}
+	return ErrorCodeUnknown
+}
+
+// NewFailedResult returns the result of an import of opts that failed with
+// err before it could run.
+func NewFailedResult(opts Options, err error) *Result {
+	result := &Result{
+		SourceAmiId:  opts.AmiId,
+		SnapshotId:   opts.SnapshotId,
+		ExportFormat: opts.ExportFormat,
+		PvcName:      opts.PvcName,
+		PvcNamespace: opts.PvcNamespace,
+	}
+	if !opts.PvcSize.IsZero() {
+		result.PvcSize = opts.PvcSize.String()
+	}
+	result.setError(err)
+	return result
+}
+
+func (r *Result) setError(err error) {
+	r.Status = ResultSucceeded
+	if err == nil {
+		return
+	}
+
+	r.Status = ResultFailed
+	r.ErrorCode = ErrorCode(err)
+	if r.ErrorCode == ErrorCodeCancelled {
+		r.Status = ResultCancelled
+	}
+	r.Error = err.Error()
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		r.FailedStep = stepErr.Step
+	}
+}
+
+// Result returns the outcome of the import, given the error Run returned.
+func (i *Importer) Result(err error) *Result {
+	result := NewFailedResult(i.opts, err)
+	result.Steps = i.stepResults
+
+	state := i.state
+	if state != nil {
+		result.AccountId = state.AccountId
+		result.AmiId = state.AmiId
+		result.Architecture = state.Architecture
+		result.BootMode = state.BootMode
+		if state.ExportAmiId != "" && state.ExportAmiId != state.AmiId {
+			result.CopiedAmiId = state.ExportAmiId
+		}
+		result.ExportTaskId = state.ExportTaskId
+		result.S3Bucket = state.S3Bucket
+		result.S3Key = state.S3Key
+		result.DataVolume = state.DataVolume
+	}
+
+	result.ExportSizeBytes = i.exportSize()
+	result.TraceId = i.span.TraceId()
+
+	if !i.startTime.IsZero() {
+		start := i.startTime
+		completion := i.completionTime
+		if completion.IsZero() {
+			completion = time.Now()
+		}
+		result.StartTime = &start
+		result.CompletionTime = &completion
+		result.DurationSeconds = completion.Sub(start).Seconds()
+	}
+	return result
+}
+
+// recordStep adds the outcome of a step to the result of the import.
+func (i *Importer) recordStep(name string, start time.Time, err error) {
+	step := StepResult{
+		Name:            name,
+		Status:          ResultSucceeded,
+		StartTime:       start,
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	if err != nil {
+		step.Status = ResultFailed
+		if ErrorCode(err) == ErrorCodeCancelled {
+			step.Status = ResultCancelled
+		}
+		step.Error = err.Error()
+	}
+	i.stepResults = append(i.stepResults, step)
+	stepDuration.WithLabelValues(name, step.Status).Observe(step.DurationSeconds)
+}
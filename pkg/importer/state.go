@@ -0,0 +1,209 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// StateConfigMapNameFormat is the default name of the config map an
+	// import's state is kept in.
+	StateConfigMapNameFormat = "%s-import-state"
+
+	stateConfigMapKey = "state"
+)
+
+// State is the progress of an import. It is saved after every step so that a
+// rerun resumes at the step that did not complete.
+type State struct {
+	// Step is the next step to run.
+	Step string `json:"step"`
+
+	// SourceAmiId, SnapshotId, PvcName and PvcNamespace identify the import
+	// the state belongs to.
+	SourceAmiId  string `json:"sourceAmiId,omitempty"`
+	SnapshotId   string `json:"snapshotId,omitempty"`
+	PvcName      string `json:"pvcName"`
+	PvcNamespace string `json:"pvcNamespace"`
+
+	AccountId string `json:"accountId,omitempty"`
+	// AmiId is the AMI being imported, registered from SnapshotId for
+	// snapshot imports.
+	AmiId          string `json:"amiId,omitempty"`
+	SnapshotCopyId string `json:"snapshotCopyId,omitempty"`
+	// Architecture and BootMode are the settings of AmiId.
+	Architecture string `json:"architecture,omitempty"`
+	BootMode     string `json:"bootMode,omitempty"`
+
+	EncryptCopy     bool              `json:"encryptCopy,omitempty"`
+	SnapshotKmsKeys map[string]string `json:"snapshotKmsKeys,omitempty"`
+	// CopyRequired is set when AmiId must be copied before it is exported.
+	CopyRequired bool `json:"copyRequired,omitempty"`
+	// ExportAmiId is the AMI exported to s3, either AmiId or its copy.
+	ExportAmiId string `json:"exportAmiId,omitempty"`
+
+	ExportTaskId string `json:"exportTaskId,omitempty"`
+	S3Bucket     string `json:"s3Bucket,omitempty"`
+	S3Key        string `json:"s3Key,omitempty"`
+
+	// SnapshotCopyCreated, AmiCreated, AmiCopyCreated and ExportCreated are
+	// set when this import created SnapshotCopyId, the temporary AmiId of a
+	// snapshot import, the copy ExportAmiId and the export rather than found
+	// them left by another run. Only what it created is removed.
+	SnapshotCopyCreated bool `json:"snapshotCopyCreated,omitempty"`
+	AmiCreated          bool `json:"amiCreated,omitempty"`
+	AmiCopyCreated      bool `json:"amiCopyCreated,omitempty"`
+	ExportCreated       bool `json:"exportCreated,omitempty"`
+
+	// SecretName is the secret minted for the DataVolume, if any.
+	SecretName string `json:"secretName,omitempty"`
+	DataVolume string `json:"dataVolume,omitempty"`
+}
+
+// StateStore persists the state of a single import.
+type StateStore interface {
+	// Load returns the saved state, or nil when there is none.
+	Load() (*State, error)
+	Save(state *State) error
+	Delete() error
+}
+
+type memoryStateStore struct {
+	state *State
+}
+
+// NewMemoryStateStore keeps state for the lifetime of the process only.
+func NewMemoryStateStore() StateStore {
+	return &memoryStateStore{}
+}
+
+func (s *memoryStateStore) Load() (*State, error) {
+	if s.state == nil {
+		return nil, nil
+	}
+	state := *s.state
+	return &state, nil
+}
+
+func (s *memoryStateStore) Save(state *State) error {
+	saved := *state
+	s.state = &saved
+	return nil
+}
+
+func (s *memoryStateStore) Delete() error {
+	s.state = nil
+	return nil
+}
+
+type fileStateStore struct {
+	path string
+}
+
+// NewFileStateStore keeps state as JSON in a local file.
+func NewFileStateStore(path string) StateStore {
+	return &fileStateStore{path: path}
+}
+
+func (s *fileStateStore) Load() (*State, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("unable to parse state file %s: %v", s.path, err)
+	}
+	return state, nil
+}
+
+func (s *fileStateStore) Save(state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write then rename so an interrupted save leaves the previous state
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+func (s *fileStateStore) Delete() error {
+	err := os.Remove(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+type configMapStateStore struct {
+	client    ConfigMapClient
+	name      string
+	namespace string
+}
+
+// NewConfigMapStateStore keeps state as JSON in a config map.
+func NewConfigMapStateStore(client ConfigMapClient, name string, namespace string) StateStore {
+	return &configMapStateStore{client: client, name: name, namespace: namespace}
+}
+
+func (s *configMapStateStore) Load() (*State, error) {
+	configMap, err := s.client.GetConfigMap(s.name, s.namespace)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	data, ok := configMap.Data[stateConfigMapKey]
+	if !ok {
+		return nil, nil
+	}
+	state := &State{}
+	if err := json.Unmarshal([]byte(data), state); err != nil {
+		return nil, fmt.Errorf("unable to parse state in config map %s/%s: %v", s.namespace, s.name, err)
+	}
+	return state, nil
+}
+
+func (s *configMapStateStore) Save(state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	configMap := &k8sv1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.name,
+			Namespace: s.namespace,
+			Labels: map[string]string{
+				"app": "kubevirt-cloud-import",
+			},
+		},
+		Data: map[string]string{
+			stateConfigMapKey: string(data),
+		},
+	}
+	_, err = s.client.CreateOrUpdateConfigMap(configMap)
+	return err
+}
+
+func (s *configMapStateStore) Delete() error {
+	return s.client.DeleteConfigMap(s.name, s.namespace)
+}
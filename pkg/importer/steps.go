@@ -0,0 +1,480 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+)
+
+// resolve determines the account the import runs in, registers a temporary
+// AMI for snapshot imports, and checks that AWS will export the AMI.
+func (i *Importer) resolve() error {
+	state := i.state
+
+	// copies are made in, and exported from, the account of the copy role
+	myAccount, err := i.clients.Copy.GetMyAccountId()
+	if err != nil {
+		return fmt.Errorf("unable to detect account id: %w", err)
+	}
+	if i.clients.Export != i.clients.Copy {
+		exportAccount, err := i.clients.Export.GetMyAccountId()
+		if err != nil {
+			return fmt.Errorf("unable to detect account id of export role: %w", err)
+		} else if exportAccount != myAccount {
+			return fmt.Errorf("export role belongs to account %s but copies are made in account %s, both roles must belong to the same account", exportAccount, myAccount)
+		}
+	}
+	state.AccountId = myAccount
+
+	state.AmiId = i.opts.AmiId
+	if i.opts.SnapshotId != "" {
+		err := i.registerSnapshotImage()
+		if err != nil {
+			return err
+		}
+	}
+	amiId := state.AmiId
+
+	image, err := i.clients.AWS.FindGlobalImageById(amiId)
+	if err != nil {
+		return fmt.Errorf("err encountered looking up ami %s: %w", amiId, err)
+	} else if image.OwnerId == nil {
+		return fmt.Errorf("image is missing owner id")
+	}
+	imageOwnerAccount := *image.OwnerId
+	state.Architecture = string(image.Architecture)
+	state.BootMode = string(aws.ImageBootMode(image))
+
+	preflight, err := i.clients.AWS.CheckImageExportable(amiId, myAccount)
+	if err != nil {
+		return fmt.Errorf("err encountered checking if ami %s can be exported: %w", amiId, err)
+	} else if err := preflight.Error(); err != nil {
+		return fmt.Errorf("refusing to import ami %s: %w", amiId, err)
+	}
+	state.EncryptCopy = len(preflight.EncryptedSnapshots) > 0
+	state.SnapshotKmsKeys = preflight.SnapshotKmsKeys
+	if state.EncryptCopy {
+		i.logger().Info("Image is backed by encrypted snapshots", "encryptedSnapshots", preflight.EncryptedSnapshots)
+	}
+
+	if imageOwnerAccount == myAccount && !preflight.RequiresCopy {
+		i.logger().Info("Image is owned by client's account", "account", myAccount)
+		state.ExportAmiId = amiId
+		state.CopyRequired = false
+	} else if imageOwnerAccount == myAccount {
+		i.logger().Info("Image is owned by client's account but must be copied before export", "account", myAccount, "reason", preflight.CopyReason)
+		state.CopyRequired = true
+	} else {
+		i.logger().Info("Image is owned by another account", "owner", imageOwnerAccount, "account", myAccount)
+		state.CopyRequired = true
+	}
+	return nil
+}
+
+// registerSnapshotImage registers a temporary AMI from the snapshot being
+// imported, copying the snapshot first when it belongs to another account.
+func (i *Importer) registerSnapshotImage() error {
+	state := i.state
+	snapshotId := i.opts.SnapshotId
+	myAccount := state.AccountId
+
+	snapshot, err := i.clients.AWS.FindSnapshotById(snapshotId)
+	if err != nil {
+		return fmt.Errorf("err encountered looking up snapshot %s: %w", snapshotId, err)
+	} else if snapshot.OwnerId == nil {
+		return fmt.Errorf("snapshot is missing owner id")
+	}
+	snapshotOwnerAccount := *snapshot.OwnerId
+
+	arch := types.ArchitectureValues(i.opts.SnapshotArchitecture)
+	bootMode := types.BootModeValues(i.opts.SnapshotBootMode)
+	if arch == "" || bootMode == "" {
+		detectedArch, detectedBootMode, found, err := i.clients.AWS.DetectSnapshotImageSettings(snapshotId, snapshotOwnerAccount)
+		if err != nil {
+			return fmt.Errorf("err encountered detecting architecture of snapshot %s: %w", snapshotId, err)
+		} else if !found {
+			i.logger().Info("No existing AMI is backed by snapshot, assuming its architecture and boot mode", "architecture", detectedArch, "bootMode", detectedBootMode)
+		}
+		if arch == "" {
+			arch = detectedArch
+		}
+		if bootMode == "" {
+			bootMode = detectedBootMode
+		}
+	}
+
+	snapshotToRegister := snapshotId
+	if snapshotOwnerAccount != myAccount {
+		i.logger().Info("Snapshot is owned by another account", "owner", snapshotOwnerAccount, "account", myAccount)
+		snapshotCopy, exists, err := i.clients.Copy.FindSnapshotCopy(snapshotId, myAccount)
+		if err != nil {
+			return fmt.Errorf("error encountered while searching for snapshot copy: %w", err)
+		}
+		if exists {
+			// a copy made by an earlier attempt of the step is still ours
+			state.SnapshotCopyCreated = state.SnapshotCopyCreated && state.SnapshotCopyId == *snapshotCopy.SnapshotId
+			state.SnapshotCopyId = *snapshotCopy.SnapshotId
+			i.logger().Info("Found local copy of snapshot in client's account", "snapshotCopy", state.SnapshotCopyId)
+		} else {
+			state.SnapshotCopyId, err = i.clients.Copy.CopySnapshot(snapshotId, i.opts.KmsKeyId)
+			if err != nil {
+				return fmt.Errorf("error copying snapshot %s: %w", snapshotId, err)
+			}
+			state.SnapshotCopyCreated = true
+			i.logger().Info("Made copy of snapshot in client's account", "snapshotCopy", state.SnapshotCopyId)
+		}
+
+		err = i.clients.Copy.WaitForSnapshotToComplete(state.SnapshotCopyId, i.opts.Timeouts.Copy, i.opts.PollInterval)
+		if err != nil {
+			return fmt.Errorf("error encountered while waiting for snapshot %s to complete: %w", state.SnapshotCopyId, err)
+		}
+		snapshotToRegister = state.SnapshotCopyId
+	}
+
+	snapshotImageName := i.clients.Copy.SnapshotImageName(snapshotToRegister)
+	snapshotImage, exists, err := i.clients.Copy.FindImageByName(snapshotImageName, myAccount)
+	if err != nil {
+		return fmt.Errorf("error encountered while searching for image by name: %w", err)
+	}
+	if exists {
+		if snapshotImage.ImageId == nil {
+			return fmt.Errorf("image id is nil on ami describe")
+		}
+		state.AmiCreated = state.AmiCreated && state.AmiId == *snapshotImage.ImageId
+		state.AmiId = *snapshotImage.ImageId
+		i.logger().Info("Found temporary ami registered from snapshot", "registeredFrom", snapshotToRegister)
+	} else {
+		state.AmiId, err = i.clients.Copy.RegisterImageFromSnapshot(snapshotToRegister, snapshotImageName, arch, bootMode)
+		if err != nil {
+			return fmt.Errorf("error registering ami from snapshot %s: %w", snapshotToRegister, err)
+		}
+		state.AmiCreated = true
+		i.logger().Info("Registered temporary ami from snapshot", "registeredFrom", snapshotToRegister, "architecture", arch, "bootMode", bootMode)
+	}
+	return nil
+}
+
+// copy copies the AMI into the client's account when resolve found it must
+// be, reusing a copy made by an earlier run.
+func (i *Importer) copy() error {
+	state := i.state
+	if !state.CopyRequired {
+		return nil
+	}
+	amiId := state.AmiId
+	myAccount := state.AccountId
+
+	// make sure the copy can decrypt the source and re-encrypt with our
+	// key before waiting on a copy that is bound to fail
+	for snapshot, key := range state.SnapshotKmsKeys {
+		err := i.clients.Copy.CheckSourceKmsKeyAccess(key, myAccount)
+		if err != nil {
+			return fmt.Errorf("unable to copy encrypted snapshot %s: %w", snapshot, err)
+		}
+	}
+	if i.opts.KmsKeyId != "" {
+		err := i.clients.Copy.CheckTargetKmsKeyAccess(i.opts.KmsKeyId, myAccount)
+		if err != nil {
+			return fmt.Errorf("unable to encrypt copy of ami %s: %w", amiId, err)
+		}
+	}
+
+	imageCopyName := i.clients.Copy.CopyImageName(amiId)
+	imageCopy, exists, err := i.clients.Copy.FindImageByName(imageCopyName, myAccount)
+	if err != nil {
+		return fmt.Errorf("error encountered while searching for image by name: %w", err)
+	}
+	if exists {
+		// see if we've already created a copy
+		if imageCopy.ImageId == nil {
+			return fmt.Errorf("image id is nil on ami describe")
+		}
+		state.AmiCopyCreated = state.AmiCopyCreated && state.ExportAmiId == *imageCopy.ImageId
+		state.ExportAmiId = *imageCopy.ImageId
+		i.logger().Info("Found local copy of image in client's account")
+		return nil
+	}
+
+	// if no copy exists, create it
+	state.ExportAmiId, err = i.clients.Copy.CopyImage(amiId, imageCopyName, state.EncryptCopy, i.opts.KmsKeyId)
+	if err != nil {
+		return fmt.Errorf("error copying ami %s: %w", amiId, err)
+	}
+	state.AmiCopyCreated = true
+	i.logger().Info("Made copy of ami in client's account")
+	return nil
+}
+
+func (i *Importer) waitAvailable() error {
+	state := i.state
+	err := i.clients.Copy.WaitForImageToBecomeAvailable(state.ExportAmiId, i.opts.Timeouts.Available, i.opts.PollInterval)
+	if errors.Is(err, aws.ErrImageFailed) && state.ExportAmiId != state.AmiId && state.EncryptCopy {
+		return fmt.Errorf("copy %s of encrypted ami %s failed, check that account %s is granted use of kms keys %v: %w", state.ExportAmiId, state.AmiId, state.AccountId, state.SnapshotKmsKeys, err)
+	} else if err != nil {
+		return fmt.Errorf("error encountered while waiting for ami %s to become available: %w", state.ExportAmiId, err)
+	}
+	return nil
+}
+
+// export starts an export of the AMI to s3 unless one already exists in the
+// same format, in which case its task or completed location is recorded.
+func (i *Importer) export() error {
+	state := i.state
+	amiToExport := state.ExportAmiId
+	exportFormat := i.opts.ExportFormat
+
+	s3Bucket, s3FilePath, completed, exists, err := i.clients.Export.GetExportTaskStatus("", amiToExport, exportFormat)
+	if err != nil {
+		return fmt.Errorf("error encountered looking up export tasks of ami %s: %w", amiToExport, err)
+	}
+
+	if completed {
+		// the object of a completed export may have been removed since
+		_, err := i.clients.AWS.HeadS3Object(s3Bucket, s3FilePath)
+		if aws.IsNotFound(err) {
+			i.logger().Info("Existing s3 export no longer exists", "s3Path", fmt.Sprintf("s3://%s/%s", s3Bucket, s3FilePath))
+			exists = false
+		} else {
+			i.logger().Info("Found existing s3 export", "s3Path", fmt.Sprintf("s3://%s/%s", s3Bucket, s3FilePath))
+			state.S3Bucket = s3Bucket
+			state.S3Key = s3FilePath
+			return nil
+		}
+	}
+
+	if exists && !completed {
+		i.logger().Info("Found existing image export job")
+		return nil
+	}
+
+	i.logger().Info("Exporting ami to s3", "bucket", i.opts.S3Bucket, "format", exportFormat)
+	s3Prefix := fmt.Sprintf(S3PrefixFormat, amiToExport)
+	state.ExportTaskId, err = i.clients.Export.ExportImage(amiToExport, i.opts.S3Bucket, s3Prefix, exportFormat, i.opts.VMImportRoleName)
+	if err != nil {
+		return fmt.Errorf("creation of export task for AMI %s to s3 failed: %w", amiToExport, err)
+	}
+	state.ExportCreated = true
+	return nil
+}
+
+func (i *Importer) waitExport() error {
+	state := i.state
+	if state.S3Key == "" {
+		i.logger().Info("Waiting for image export job to complete")
+		s3Bucket, s3FilePath, err := i.clients.Export.WaitForExportImageCompletion(state.ExportAmiId, state.ExportTaskId, i.opts.ExportFormat, i.opts.Timeouts.Export, i.opts.PollInterval, i.exportProgress())
+		if err != nil {
+			return fmt.Errorf("exporting of AMI %s to s3 failed: %w", state.ExportAmiId, err)
+		}
+		state.S3Bucket = s3Bucket
+		state.S3Key = s3FilePath
+	}
+
+	i.logger().Info("AMI is exported to s3", "s3Path", fmt.Sprintf("s3://%s/%s", state.S3Bucket, state.S3Key))
+	return nil
+}
+
+// exportProgress returns the callback reporting the progress of the export
+// to the observers whenever it changes.
+func (i *Importer) exportProgress() aws.ExportProgressFunc {
+	var last string
+	return func(progress string, statusMessage string) {
+		message := fmt.Sprintf("export task %s is %s%% complete", i.state.ExportTaskId, progress)
+		if progress == "" {
+			message = fmt.Sprintf("export task %s is running", i.state.ExportTaskId)
+		}
+		if statusMessage != "" {
+			message = fmt.Sprintf("%s: %s", message, statusMessage)
+		}
+		if message == last {
+			return
+		}
+		last = message
+
+		i.logger().Info("Image export progress", "progress", progress, "status", statusMessage)
+		for _, o := range i.observers {
+			o.StepProgress(StepWaitExport, i.state, message)
+		}
+	}
+}
+
+// createDataVolume creates the DataVolume importing the export, after checking
+// that a raw export fits the pvc. When a reader role is configured, object
+// scoped s3 credentials are minted into a secret the DataVolume owns,
+// replacing the secret of an earlier run.
+func (i *Importer) createDataVolume() error {
+	state := i.state
+	opts := i.opts
+
+	// CDI writes a raw export to the volume as is, so the disk must fit
+	if opts.ExportFormat == aws.ExportImageFormatRaw && !opts.PvcSize.IsZero() {
+		object, err := i.clients.AWS.HeadS3Object(state.S3Bucket, state.S3Key)
+		if err != nil {
+			return fmt.Errorf("error looking up s3://%s/%s: %w", state.S3Bucket, state.S3Key, err)
+		} else if object.Size > opts.PvcSize.Value() {
+			return fmt.Errorf("pvc size %s is smaller than the %d bytes of the raw disk image", opts.PvcSize.String(), object.Size)
+		}
+	}
+
+	s3SecretName := opts.S3SecretName
+	if opts.S3ReaderRoleArn != "" {
+		s3SecretName = fmt.Sprintf(S3ImportSecretNameFormat, opts.PvcName)
+	}
+
+	err := i.clients.CDI.ImportFromS3IntoPvc(opts.PvcName,
+		opts.PvcNamespace,
+		opts.PvcStorageClass,
+		opts.PvcAccessMode,
+		state.S3Bucket,
+		state.S3Key,
+		opts.Region,
+		s3SecretName,
+		opts.ExportFormat,
+		opts.PvcSize)
+	if err != nil {
+		return fmt.Errorf("error encountered creating DataVolume: %w", err)
+	}
+	state.DataVolume = opts.PvcName
+	i.logger().Info("Created DataVolume to import AMI")
+
+	if opts.S3ReaderRoleArn != "" {
+		creds, err := i.clients.AWS.MintS3ObjectReadCredentials(opts.S3ReaderRoleArn, state.S3Bucket, state.S3Key, opts.S3CredentialsDuration)
+		if err != nil {
+			return fmt.Errorf("error minting s3 read credentials from role %s: %w", opts.S3ReaderRoleArn, err)
+		}
+
+		secret := cdi.NewS3CredentialSecret(s3SecretName, opts.PvcNamespace, creds.AccessKeyId, creds.SecretAccessKey, creds.SessionToken)
+		err = i.clients.CDI.CreateDataVolumeSecret(secret, state.DataVolume)
+		if err != nil {
+			return fmt.Errorf("error encountered creating secret %s/%s: %w", opts.PvcNamespace, s3SecretName, err)
+		}
+		state.SecretName = s3SecretName
+		i.logger().Info("Created secret with s3 read credentials", "secret", s3SecretName, "expiration", creds.Expiration)
+	}
+	return nil
+}
+
+func (i *Importer) waitImport() error {
+	state := i.state
+
+	// the source is hashed while CDI imports it, once should the step be
+	// retried
+	if i.opts.Verify && i.sourceDigest == nil {
+		digests := make(chan sourceDigest, 1)
+		stop := make(chan struct{})
+		i.sourceDigest, i.stopDigest = digests, stop
+		go func() {
+			digests <- digestExportedImage(i.clients.AWS, state.S3Bucket, state.S3Key, i.opts.ExportFormat, stop)
+		}()
+	}
+
+	err := i.clients.CDI.WaitForS3ImportCompletion(state.DataVolume, i.opts.PvcNamespace, i.opts.Timeouts.Import, i.opts.PollInterval)
+	if err != nil {
+		return fmt.Errorf("error encountered while waiting on PVC import: %w", err)
+	}
+
+	if state.SecretName != "" {
+		err = i.clients.CDI.DeleteSecret(state.SecretName, i.opts.PvcNamespace)
+		if err != nil {
+			return fmt.Errorf("error encountered deleting secret %s/%s: %w", i.opts.PvcNamespace, state.SecretName, err)
+		}
+		i.logger().Info("Deleted secret", "secret", state.SecretName)
+	}
+
+	i.logger().Info("AMI imported into pvc")
+	return nil
+}
+
+// stopSourceDigest abandons the digest started by waitImport, if any.
+func (i *Importer) stopSourceDigest() {
+	if i.stopDigest != nil {
+		close(i.stopDigest)
+	}
+	i.sourceDigest, i.stopDigest = nil, nil
+}
+
+func (i *Importer) verify() error {
+	if !i.opts.Verify {
+		return nil
+	}
+	state := i.state
+
+	var source sourceDigest
+	if i.sourceDigest != nil {
+		source = <-i.sourceDigest
+		// a retry of the step digests the image again
+		i.stopSourceDigest()
+	} else {
+		// resumed after the import completed
+		source = digestExportedImage(i.clients.AWS, state.S3Bucket, state.S3Key, i.opts.ExportFormat, i.cancelled)
+	}
+	if source.err != nil {
+		return fmt.Errorf("error encountered computing digest of s3://%s/%s: %w", state.S3Bucket, state.S3Key, source.err)
+	}
+
+	err := verifyImportedDisk(i.logger(), i.clients.CDI, source, i.opts.PvcName, i.opts.PvcNamespace, i.opts.VerifyImage, i.opts.Timeouts.Verify, i.opts.PollInterval)
+	if err != nil {
+		return fmt.Errorf("error encountered verifying pvc [%s/%s]: %w", i.opts.PvcNamespace, i.opts.PvcName, err)
+	}
+	i.logger().Info("Verified pvc against export", "s3Path", fmt.Sprintf("s3://%s/%s", state.S3Bucket, state.S3Key))
+	return nil
+}
+
+// convert converts the guest of the imported pvc once it is verified, since
+// the conversion changes the content verification compares.
+func (i *Importer) convert() error {
+	if !i.opts.Convert {
+		return nil
+	}
+
+	err := convertImportedDisk(i.logger(), i.clients.CDI, i.opts.PvcName, i.opts.PvcNamespace, i.opts.ConvertImage, i.opts.Conversion, i.opts.Timeouts.Convert, i.opts.PollInterval)
+	if err != nil {
+		return fmt.Errorf("error encountered converting pvc [%s/%s]: %w", i.opts.PvcNamespace, i.opts.PvcName, err)
+	}
+	i.logger().Info("Converted guest of pvc", "changes", strings.Join(i.opts.Conversion.Changes(), ", "))
+	return nil
+}
+
+// cleanup removes the config map events were recorded against and the
+// temporary resources a snapshot import created, including the copy of its
+// temporary AMI.
+func (i *Importer) cleanup() error {
+	if err := i.deleteEventsConfigMap(); err != nil {
+		return err
+	}
+
+	state := i.state
+	if i.opts.SnapshotId == "" {
+		return nil
+	}
+
+	// a copy the temporary ami needed before export is as temporary
+	if state.AmiCopyCreated {
+		err := i.clients.Copy.DeleteImageAndSnapshots(state.ExportAmiId)
+		if err != nil {
+			return fmt.Errorf("error deleting copy %s of temporary ami %s: %w", state.ExportAmiId, state.AmiId, err)
+		}
+		state.AmiCopyCreated = false
+		i.logger().Info("Deleted copy of temporary ami", "amiCopy", state.ExportAmiId)
+	}
+
+	if state.AmiCreated {
+		err := i.clients.Copy.DeregisterImage(state.AmiId)
+		if err != nil {
+			return fmt.Errorf("error deregistering temporary ami %s: %w", state.AmiId, err)
+		}
+		i.logger().Info("Deregistered temporary ami")
+	}
+
+	if state.SnapshotCopyCreated {
+		err := i.clients.Copy.DeleteSnapshot(state.SnapshotCopyId)
+		if err != nil {
+			return fmt.Errorf("error deleting temporary snapshot copy %s: %w", state.SnapshotCopyId, err)
+		}
+		i.logger().Info("Deleted temporary snapshot copy", "snapshotCopy", state.SnapshotCopyId)
+	}
+	return nil
+}
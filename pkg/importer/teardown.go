@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+)
+
+// Teardown removes what the import created according to its saved state: the
+// minted secret, the copy of the AMI, the export, the temporary resources of
+// a snapshot import and the config map events were recorded against.
+// Resources it found left by another run are kept. The DataVolume is only
+// removed when the import did not complete, so that an imported pvc outlives
+// the import. ErrNoState is returned when there is no saved state.
+func (i *Importer) Teardown() error {
+	state, err := i.store.Load()
+	if err != nil {
+		return err
+	} else if state == nil {
+		return ErrNoState
+	} else if err := i.checkState(state); err != nil {
+		return err
+	}
+	i.state = state
+
+	if state.SecretName != "" {
+		err := i.clients.CDI.DeleteSecret(state.SecretName, state.PvcNamespace)
+		if err != nil {
+			return fmt.Errorf("error deleting secret %s/%s: %v", state.PvcNamespace, state.SecretName, err)
+		}
+	}
+
+	if state.Step != StepDone && state.DataVolume != "" {
+		err := i.clients.CDI.DeleteDataVolume(state.DataVolume, state.PvcNamespace)
+		if err != nil {
+			return fmt.Errorf("error deleting DataVolume %s/%s: %v", state.PvcNamespace, state.DataVolume, err)
+		}
+		i.logger().Info("Deleted incomplete DataVolume")
+	}
+
+	if state.ExportCreated && state.ExportTaskId != "" && state.S3Key == "" {
+		err := i.clients.Export.CancelExportTask(state.ExportTaskId)
+		if err != nil {
+			// the task may have completed or failed in the meantime
+			i.logger().Error(err, "Unable to cancel export task")
+		} else {
+			i.logger().Info("Cancelled export task")
+		}
+	}
+
+	if state.ExportCreated && state.S3Key != "" {
+		err := i.clients.Export.DeleteS3Object(state.S3Bucket, state.S3Key)
+		if err != nil {
+			return fmt.Errorf("error deleting s3://%s/%s: %v", state.S3Bucket, state.S3Key, err)
+		}
+		i.logger().Info("Deleted s3 export", "s3Path", fmt.Sprintf("s3://%s/%s", state.S3Bucket, state.S3Key))
+	}
+
+	if state.AmiCopyCreated && state.ExportAmiId != "" {
+		err := i.clients.Copy.DeleteImageAndSnapshots(state.ExportAmiId)
+		if err != nil {
+			return fmt.Errorf("error deleting copy %s of ami %s: %v", state.ExportAmiId, state.AmiId, err)
+		}
+		i.logger().Info("Deleted copy of ami")
+	}
+
+	// the cleanup step already removed them for completed imports
+	if state.Step != StepDone {
+		if state.AmiCreated {
+			err := i.clients.Copy.DeregisterImage(state.AmiId)
+			if err != nil && !aws.IsNotFound(err) {
+				return fmt.Errorf("error deregistering temporary ami %s: %v", state.AmiId, err)
+			}
+		}
+		if state.SnapshotCopyCreated {
+			err := i.clients.Copy.DeleteSnapshot(state.SnapshotCopyId)
+			if err != nil && !aws.IsNotFound(err) {
+				return fmt.Errorf("error deleting temporary snapshot copy %s: %v", state.SnapshotCopyId, err)
+			}
+		}
+	}
+
+	if err := i.deleteEventsConfigMap(); err != nil {
+		return err
+	}
+
+	return i.store.Delete()
+}
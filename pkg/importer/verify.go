@@ -0,0 +1,112 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/aws"
+	"kubevirt.io/kubevirt-cloud-import/pkg/client/cdi"
+	"kubevirt.io/kubevirt-cloud-import/pkg/disk"
+)
+
+// sourceDigest is the record of an exported image taken for verification.
+type sourceDigest struct {
+	object *aws.S3Object
+	digest *disk.Digest
+	err    error
+}
+
+// errDigestStopped is the error of a digest stopped before it completed.
+var errDigestStopped = errors.New("digest of the exported image stopped")
+
+// stoppableReader fails reads with errDigestStopped once stop is closed.
+type stoppableReader struct {
+	r    io.Reader
+	stop <-chan struct{}
+}
+
+func (r *stoppableReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.stop:
+		return 0, errDigestStopped
+	default:
+	}
+	return r.r.Read(p)
+}
+
+// digestExportedImage records the ETag and size of the exported object and
+// streams it to compute the virtual size and content hash of the disk. The
+// stream is abandoned once stop is closed.
+func digestExportedImage(s3Cli AWSClient, bucket string, key string, format string, stop <-chan struct{}) sourceDigest {
+	object, err := s3Cli.HeadS3Object(bucket, key)
+	if err != nil {
+		return sourceDigest{err: err}
+	}
+
+	body, err := s3Cli.OpenS3Object(bucket, key)
+	if err != nil {
+		return sourceDigest{err: err}
+	}
+	defer body.Close()
+
+	digest, err := disk.ComputeDigest(format, &stoppableReader{r: body, stop: stop})
+	if err != nil {
+		return sourceDigest{err: err}
+	}
+	if digest.StreamSize != object.Size {
+		return sourceDigest{err: fmt.Errorf("read %d bytes of s3://%s/%s, expected %d", digest.StreamSize, bucket, key, object.Size)}
+	}
+	return sourceDigest{object: object, digest: digest}
+}
+
+// ErrVerificationFailed is wrapped by the error of an import whose pvc does
+// not match the export.
+var ErrVerificationFailed = errors.New("verification failed")
+
+// verifyImportedDisk runs the verification job against the imported pvc and
+// records the source digest and the outcome as annotations of the pvc.
+func verifyImportedDisk(log logr.Logger, cdiCli CDIClient, source sourceDigest, pvcName string, pvcNamespace string, image string, timeout time.Duration, pollInterval time.Duration) error {
+	annotations := map[string]string{
+		cdi.AnnSourceETag: source.object.ETag,
+		cdi.AnnSourceSize: strconv.FormatInt(source.object.Size, 10),
+	}
+	annotations[cdi.AnnSourceVirtualSize] = strconv.FormatInt(source.digest.VirtualSize, 10)
+	annotations[cdi.AnnSourceSHA256] = source.digest.SHA256
+
+	jobName, err := cdiCli.CreateVerificationJob(pvcName, pvcNamespace, image, source.digest.VirtualSize, source.digest.SHA256)
+	if err != nil {
+		return err
+	}
+	log.Info("Created Job to verify pvc", "job", jobName)
+
+	succeeded, message, err := cdiCli.WaitForJobCompletion(jobName, pvcNamespace, timeout, pollInterval)
+	if err != nil {
+		return err
+	}
+
+	if succeeded {
+		annotations[cdi.AnnVerification] = cdi.VerificationPassed
+	} else {
+		annotations[cdi.AnnVerification] = cdi.VerificationFailed
+	}
+	annotations[cdi.AnnVerificationMessage] = message
+
+	err = cdiCli.AnnotatePvc(pvcName, pvcNamespace, annotations)
+	if err != nil {
+		return err
+	}
+
+	err = cdiCli.DeleteJob(jobName, pvcNamespace)
+	if err != nil {
+		return err
+	}
+
+	if !succeeded {
+		return fmt.Errorf("%w: pvc %s/%s does not match the exported image: %s", ErrVerificationFailed, pvcNamespace, pvcName, message)
+	}
+	return nil
+}
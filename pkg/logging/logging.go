@@ -0,0 +1,236 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// The keys entries about an import carry, so that a log pipeline can index
+// imports by the resources they act on.
+const (
+	// KeyAmi is the AMI being imported.
+	KeyAmi = "ami"
+	// KeyCopyAmi is the copy of the AMI made in the client's account.
+	KeyCopyAmi = "copyAmi"
+	// KeyTaskId is the export image task.
+	KeyTaskId = "taskId"
+	// KeyDataVolume is the DataVolume importing the export.
+	KeyDataVolume = "dv"
+	// KeyStep is the step of the import running.
+	KeyStep = "step"
+	// KeyPvc is the pvc imported into, and KeyNamespace its namespace.
+	KeyPvc       = "pvc"
+	KeyNamespace = "namespace"
+	// KeySnapshot is the snapshot being imported or copied.
+	KeySnapshot = "snapshot"
+)
+
+// The formats entries are written in.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+const textTimeFormat = "2006/01/02 15:04:05"
+
+// ParseFormat validates a log format.
+func ParseFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unsupported log format %q, must be one of %s, %s", format, FormatText, FormatJSON)
+}
+
+// sink writes the entries of a logger and all the loggers derived from it.
+type sink struct {
+	mu        sync.Mutex
+	w         io.Writer
+	format    string
+	verbosity int
+}
+
+type logger struct {
+	sink   *sink
+	name   string
+	level  int
+	values []interface{}
+}
+
+// New returns a logger writing entries to w in format. Info entries of a
+// level above verbosity are dropped, errors are always written.
+func New(w io.Writer, format string, verbosity int) logr.Logger {
+	return &logger{sink: &sink{w: w, format: format, verbosity: verbosity}}
+}
+
+func (l *logger) Enabled() bool {
+	return l.level <= l.sink.verbosity
+}
+
+func (l *logger) Info(msg string, keysAndValues ...interface{}) {
+	if !l.Enabled() {
+		return
+	}
+	l.sink.write(l, "info", msg, nil, keysAndValues)
+}
+
+func (l *logger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.sink.write(l, "error", msg, err, keysAndValues)
+}
+
+func (l *logger) V(level int) logr.Logger {
+	derived := *l
+	derived.level += level
+	return &derived
+}
+
+func (l *logger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	derived := *l
+	derived.values = append(append([]interface{}{}, l.values...), keysAndValues...)
+	return &derived
+}
+
+func (l *logger) WithName(name string) logr.Logger {
+	derived := *l
+	if derived.name != "" {
+		name = derived.name + "." + name
+	}
+	derived.name = name
+	return &derived
+}
+
+func (s *sink) write(l *logger, level string, msg string, err error, keysAndValues []interface{}) {
+	values := append(append([]interface{}{}, l.values...), keysAndValues...)
+	if len(values)%2 != 0 {
+		values = append(values, "(MISSING)")
+	}
+
+	var buf bytes.Buffer
+	now := time.Now()
+	if s.format == FormatJSON {
+		buf.WriteString(`{"ts":`)
+		writeJSON(&buf, now.UTC().Format(time.RFC3339Nano))
+		buf.WriteString(`,"level":`)
+		writeJSON(&buf, level)
+		if level == "info" {
+			buf.WriteString(`,"v":`)
+			buf.WriteString(strconv.Itoa(l.level))
+		}
+		if l.name != "" {
+			buf.WriteString(`,"logger":`)
+			writeJSON(&buf, l.name)
+		}
+		buf.WriteString(`,"msg":`)
+		writeJSON(&buf, msg)
+		for i := 0; i < len(values); i += 2 {
+			buf.WriteByte(',')
+			writeJSON(&buf, fmt.Sprint(values[i]))
+			buf.WriteByte(':')
+			writeJSON(&buf, jsonValue(values[i+1]))
+		}
+		if err != nil {
+			buf.WriteString(`,"error":`)
+			writeJSON(&buf, err.Error())
+		}
+		buf.WriteString("}\n")
+	} else {
+		buf.WriteString(now.Format(textTimeFormat))
+		if level == "error" {
+			buf.WriteString(" ERROR")
+		}
+		if l.name != "" {
+			buf.WriteString(" [" + l.name + "]")
+		}
+		buf.WriteString(" " + msg)
+		for i := 0; i < len(values); i += 2 {
+			fmt.Fprintf(&buf, " %v=%s", values[i], textValue(values[i+1]))
+		}
+		if err != nil {
+			buf.WriteString(" error=" + strconv.Quote(err.Error()))
+		}
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(buf.Bytes())
+}
+
+// jsonValue returns the value an entry's value is encoded as, the message
+// of errors and the string form of Stringers, such as durations.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(encoded)
+}
+
+// textValue quotes values with spaces or quotes, so that entries stay
+// parseable as key=value pairs.
+func textValue(value interface{}) string {
+	s := fmt.Sprint(jsonValue(value))
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = New(os.Stderr, FormatText, 0)
+)
+
+// Default returns the logger clients and imports log to unless given one.
+func Default() logr.Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// SetDefault replaces the default logger. Clients and imports created
+// before keep the logger they were created with.
+func SetDefault(l logr.Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = l
+}
+
+// stdLogWriter writes every line of the standard logger as an info entry.
+type stdLogWriter struct {
+	log logr.Logger
+}
+
+func (w stdLogWriter) Write(p []byte) (int, error) {
+	w.log.Info(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// RedirectStdLog writes what is logged through the standard log package as
+// entries of l, so that every line follows the format of l.
+func RedirectStdLog(l logr.Logger) {
+	log.SetFlags(0)
+	log.SetOutput(stdLogWriter{log: l})
+}
@@ -0,0 +1,17 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds the metrics of the process.
+var Registry = prometheus.NewRegistry()
+
+// Handler serves the metrics of Registry in the Prometheus exposition
+// format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	testImports = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "test_imports_total",
+		Help: "Number of imports, by status.",
+	}, []string{"status"})
+	testDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "test_duration_seconds",
+		Help:    "Duration of imports.",
+		Buckets: []float64{1, 10},
+	}, []string{"status"})
+)
+
+const wantExposition = `# HELP test_duration_seconds Duration of imports.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{status="succeeded",le="1"} 0
+test_duration_seconds_bucket{status="succeeded",le="10"} 1
+test_duration_seconds_bucket{status="succeeded",le="+Inf"} 2
+test_duration_seconds_sum{status="succeeded"} 25
+test_duration_seconds_count{status="succeeded"} 2
+# HELP test_imports_total Number of imports, by status.
+# TYPE test_imports_total counter
+test_imports_total{status="failed"} 1
+test_imports_total{status="succeeded"} 2
+`
+
+func TestHandler(t *testing.T) {
+	testImports.WithLabelValues("succeeded").Add(2)
+	testImports.WithLabelValues("failed").Inc()
+	testDuration.WithLabelValues("succeeded").Observe(5)
+	testDuration.WithLabelValues("succeeded").Observe(20)
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want the text exposition format", contentType)
+	}
+	body, err := ioutil.ReadAll(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != wantExposition {
+		t.Errorf("exposition =\n%s\nwant\n%s", body, wantExposition)
+	}
+}
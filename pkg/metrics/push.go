@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const pushTimeout = 30 * time.Second
+
+// Push replaces the metrics of the group job and grouping on the
+// Pushgateway at gatewayUrl with those gathered from g.
+func Push(gatewayUrl string, job string, grouping map[string]string, g prometheus.Gatherer) error {
+	pusher := push.New(gatewayUrl, job).
+		Gatherer(g).
+		Client(&http.Client{Timeout: pushTimeout})
+	for label, value := range grouping {
+		pusher = pusher.Grouping(label, value)
+	}
+	return pusher.Push()
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+func TestPush(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	promauto.With(registry).NewGauge(prometheus.GaugeOpts{
+		Name: "test_imports_in_flight",
+		Help: "Number of imports running.",
+	}).Set(3)
+
+	var method, path, body string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		method, path, body = req.Method, req.URL.EscapedPath(), string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	err := Push(gateway.URL, "import-ami", map[string]string{"instance": "import-pod"}, registry)
+	if err != nil {
+		t.Fatalf("Push() returned error: %v", err)
+	}
+	if method != http.MethodPut {
+		t.Errorf("method = %s, want %s so that the group is replaced", method, http.MethodPut)
+	}
+	if want := "/metrics/job/import-ami/instance/import-pod"; path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	if !strings.Contains(body, "test_imports_in_flight") {
+		t.Errorf("pushed body does not contain test_imports_in_flight")
+	}
+}
+
+func TestPushError(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer gateway.Close()
+
+	if err := Push(gateway.URL, "import-ami", nil, prometheus.NewRegistry()); err == nil {
+		t.Error("Push() succeeded with the gateway rejecting the metrics")
+	}
+}
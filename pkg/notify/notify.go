@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+)
+
+// The payloads a notification is sent as.
+const (
+	// FormatGeneric posts the result document of the import as is.
+	FormatGeneric = "generic"
+	// FormatSlack posts a Slack incoming webhook message.
+	FormatSlack = "slack"
+	// FormatTeams posts a Microsoft Teams incoming webhook message card.
+	FormatTeams = "teams"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the body, keyed with the
+// secret of the notifier, as sha256=<hex>.
+const SignatureHeader = "X-Cloud-Import-Signature-256"
+
+const requestTimeout = 30 * time.Second
+
+// ParseFormat validates a notification format.
+func ParseFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", FormatGeneric:
+		return FormatGeneric, nil
+	case FormatSlack:
+		return FormatSlack, nil
+	case FormatTeams:
+		return FormatTeams, nil
+	}
+	return "", fmt.Errorf("unsupported notification format %q, must be one of %s, %s, %s", format, FormatGeneric, FormatSlack, FormatTeams)
+}
+
+// Options configure a notifier.
+type Options struct {
+	// Url is the webhook the result of every import is posted to.
+	Url string
+	// Format is the payload posted, FormatGeneric by default.
+	Format string
+	// Template, when set, renders the payload from the result document in
+	// place of Format. It must render JSON.
+	Template string
+	// Secret, when set, signs every body in SignatureHeader.
+	Secret []byte
+	// Retry reposts notifications failing with a throttling, server or
+	// network error. Defaults to retry.DefaultPolicy.
+	Retry retry.Policy
+}
+
+// Notifier posts the result of imports to a webhook.
+type Notifier struct {
+	opts     Options
+	template *template.Template
+	client   *http.Client
+}
+
+// New returns a notifier posting to opts.Url.
+func New(opts Options) (*Notifier, error) {
+	if opts.Url == "" {
+		return nil, fmt.Errorf("a notification url is required")
+	}
+	format, err := ParseFormat(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Retry.MaxAttempts == 0 {
+		opts.Retry = retry.DefaultPolicy()
+	}
+
+	text := opts.Template
+	if text == "" {
+		text = formatTemplates[format]
+	}
+	n := &Notifier{opts: opts, client: &http.Client{
+		Timeout: requestTimeout,
+		// a redirect is reported rather than followed, it may lead anywhere
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+	if text != "" {
+		n.template, err = template.New("notification").Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification template: %v", err)
+		}
+	}
+	return n, nil
+}
+
+// Payload returns the body posted for result.
+func (n *Notifier) Payload(result *importer.Result) ([]byte, error) {
+	if n.template == nil {
+		return json.Marshal(result)
+	}
+
+	var buf bytes.Buffer
+	if err := n.template.Execute(&buf, result); err != nil {
+		return nil, fmt.Errorf("error rendering notification: %v", err)
+	} else if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("notification template did not render json: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign returns the value of SignatureHeader for body.
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// statusError is a response other than 2xx, classified for retries by its
+// status code.
+type statusError struct {
+	url    string
+	status int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s responded with %d %s: %s", e.url, e.status, http.StatusText(e.status), e.body)
+}
+
+func (e *statusError) HTTPStatusCode() int {
+	return e.status
+}
+
+// Notify posts result, retrying transient failures. A nil notifier posts
+// nothing.
+func (n *Notifier) Notify(result *importer.Result) error {
+	if n == nil {
+		return nil
+	}
+	body, err := n.Payload(result)
+	if err != nil {
+		return err
+	}
+	return n.opts.Retry.Do("notification", nil, func() error {
+		return n.post(body)
+	})
+}
+
+func (n *Notifier) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, n.opts.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.opts.Secret) != 0 {
+		req.Header.Set(SignatureHeader, Sign(n.opts.Secret, body))
+	}
+
+	// the path of webhook urls is often their secret, errors only name the
+	// host
+	host := req.URL.Scheme + "://" + req.URL.Host
+	resp, err := n.client.Do(req)
+	if urlErr, ok := err.(*url.Error); ok {
+		urlErr.URL = host
+		return urlErr
+	} else if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return &statusError{url: host, status: resp.StatusCode, body: strings.TrimSpace(string(message))}
+	}
+	return nil
+}
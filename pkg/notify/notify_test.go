@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+	"kubevirt.io/kubevirt-cloud-import/pkg/retry"
+)
+
+func TestSign(t *testing.T) {
+	// RFC 4231 test case 2
+	got := Sign([]byte("Jefe"), []byte("what do ya want for nothing?"))
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{format: "", want: FormatGeneric},
+		{format: "generic", want: FormatGeneric},
+		{format: "Slack", want: FormatSlack},
+		{format: "teams", want: FormatTeams},
+		{format: "email", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.format)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseFormat(%q) = %q, want an error", tt.format, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseFormat(%q) returned error: %v", tt.format, err)
+		} else if got != tt.want {
+			t.Errorf("ParseFormat(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	result := &importer.Result{Status: importer.ResultSucceeded, SourceAmiId: "ami-1", PvcName: "disk", PvcNamespace: "default"}
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantErr   bool
+		wantPosts int
+	}{
+		{name: "delivered", statuses: []int{http.StatusOK}, wantPosts: 1},
+		{name: "server error retried", statuses: []int{http.StatusServiceUnavailable, http.StatusNoContent}, wantPosts: 2},
+		{name: "client error not retried", statuses: []int{http.StatusForbidden}, wantErr: true, wantPosts: 1},
+	}
+
+	for _, tt := range tests {
+		var posts int
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := ioutil.ReadAll(req.Body)
+			if signature := req.Header.Get(SignatureHeader); signature != Sign([]byte("key"), body) {
+				t.Errorf("%s: %s = %q, want the signature of the body", tt.name, SignatureHeader, signature)
+			}
+			decoded := &importer.Result{}
+			if err := json.Unmarshal(body, decoded); err != nil || decoded.SourceAmiId != "ami-1" {
+				t.Errorf("%s: posted %s, want the result document", tt.name, body)
+			}
+			w.WriteHeader(tt.statuses[posts])
+			posts++
+		}))
+
+		notifier, err := New(Options{
+			Url:    webhook.URL + "/hooks/secret-token",
+			Secret: []byte("key"),
+			Retry:  retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = notifier.Notify(result)
+		webhook.Close()
+
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: Notify() succeeded, want an error", tt.name)
+		} else if !tt.wantErr && err != nil {
+			t.Errorf("%s: Notify() returned error: %v", tt.name, err)
+		}
+		if err != nil && strings.Contains(err.Error(), "secret-token") {
+			t.Errorf("%s: error %q reveals the path of the webhook url", tt.name, err)
+		}
+		if posts != tt.wantPosts {
+			t.Errorf("%s: %d posts, want %d", tt.name, posts, tt.wantPosts)
+		}
+	}
+}
+
+func TestNilNotifier(t *testing.T) {
+	var notifier *Notifier
+	if err := notifier.Notify(&importer.Result{}); err != nil {
+		t.Errorf("Notify() of a nil notifier returned error: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+)
+
+// templateFuncs are available to notification templates, which are executed
+// against the result document of the import.
+var templateFuncs = template.FuncMap{
+	// json encodes a value, such as a string to embed in the payload.
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	"summary":   Summary,
+	"succeeded": func(result *importer.Result) bool { return result.Status == importer.ResultSucceeded },
+}
+
+// Summary describes the outcome of an import in a sentence.
+func Summary(result *importer.Result) string {
+	source := result.SourceAmiId
+	if source == "" {
+		source = result.SnapshotId
+	}
+	pvc := fmt.Sprintf("%s/%s", result.PvcNamespace, result.PvcName)
+
+	switch result.Status {
+	case importer.ResultSucceeded:
+		return fmt.Sprintf("Import of %s into pvc %s succeeded in %.0fs", source, pvc, result.DurationSeconds)
+	case importer.ResultCancelled:
+		return fmt.Sprintf("Import of %s into pvc %s was cancelled", source, pvc)
+	}
+	if result.FailedStep != "" {
+		return fmt.Sprintf("Import of %s into pvc %s failed in step %s: %s", source, pvc, result.FailedStep, result.Error)
+	}
+	return fmt.Sprintf("Import of %s into pvc %s failed: %s", source, pvc, result.Error)
+}
+
+// formatTemplates render the payload of each format. The generic format
+// posts the result document without a template.
+var formatTemplates = map[string]string{
+	FormatSlack: `{
+  "text": {{ summary . | json }},
+  "attachments": [{
+    "color": {{ if succeeded . }}"good"{{ else }}"danger"{{ end }},
+    "fields": [
+      {"title": "Status", "value": {{ .Status | json }}, "short": true},
+      {"title": "Pvc", "value": {{ printf "%s/%s" .PvcNamespace .PvcName | json }}, "short": true}
+      {{- with .SourceAmiId }},
+      {"title": "AMI", "value": {{ json . }}, "short": true}{{ end }}
+      {{- with .SnapshotId }},
+      {"title": "Snapshot", "value": {{ json . }}, "short": true}{{ end }}
+      {{- with .CopiedAmiId }},
+      {"title": "Copied AMI", "value": {{ json . }}, "short": true}{{ end }}
+      {{- with .ExportTaskId }},
+      {"title": "Export task", "value": {{ json . }}, "short": true}{{ end }}
+      {{- with .ErrorCode }},
+      {"title": "Error code", "value": {{ json . }}, "short": true}{{ end }}
+      {{- with .TraceId }},
+      {"title": "Trace", "value": {{ json . }}, "short": true}{{ end }}
+    ]
+  }]
+}`,
+	FormatTeams: `{
+  "@type": "MessageCard",
+  "@context": "https://schema.org/extensions",
+  "summary": {{ summary . | json }},
+  "themeColor": {{ if succeeded . }}"2EB886"{{ else }}"D00000"{{ end }},
+  "title": {{ summary . | json }},
+  "sections": [{
+    "facts": [
+      {"name": "Status", "value": {{ .Status | json }}},
+      {"name": "Pvc", "value": {{ printf "%s/%s" .PvcNamespace .PvcName | json }}}
+      {{- with .SourceAmiId }},
+      {"name": "AMI", "value": {{ json . }}}{{ end }}
+      {{- with .SnapshotId }},
+      {"name": "Snapshot", "value": {{ json . }}}{{ end }}
+      {{- with .CopiedAmiId }},
+      {"name": "Copied AMI", "value": {{ json . }}}{{ end }}
+      {{- with .ExportTaskId }},
+      {"name": "Export task", "value": {{ json . }}}{{ end }}
+      {{- with .ErrorCode }},
+      {"name": "Error code", "value": {{ json . }}}{{ end }}
+      {{- with .TraceId }},
+      {"name": "Trace", "value": {{ json . }}}{{ end }}
+    ]
+  }]
+}`,
+}
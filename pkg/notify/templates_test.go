@@ -0,0 +1,222 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"kubevirt.io/kubevirt-cloud-import/pkg/importer"
+)
+
+var (
+	succeededResult = &importer.Result{
+		Status:          importer.ResultSucceeded,
+		SourceAmiId:     "ami-1",
+		CopiedAmiId:     "ami-2",
+		ExportTaskId:    "export-ami-2",
+		PvcName:         "disk",
+		PvcNamespace:    "default",
+		DurationSeconds: 754.4,
+		TraceId:         "4bf92f3577b34da6a3ce929d0e0e4736",
+	}
+	failedResult = &importer.Result{
+		Status:       importer.ResultFailed,
+		SnapshotId:   "snap-1",
+		PvcName:      "disk",
+		PvcNamespace: "default",
+		FailedStep:   importer.StepExport,
+		ErrorCode:    "InvalidParameter",
+		Error:        `role "vmimport" does not exist`,
+	}
+)
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *importer.Result
+		want   string
+	}{
+		{name: "succeeded", result: succeededResult, want: "Import of ami-1 into pvc default/disk succeeded in 754s"},
+		{name: "failed in a step", result: failedResult, want: `Import of snap-1 into pvc default/disk failed in step export: role "vmimport" does not exist`},
+		{
+			name:   "failed before the steps",
+			result: &importer.Result{Status: importer.ResultFailed, SourceAmiId: "ami-1", PvcName: "disk", PvcNamespace: "default", Error: "no credentials"},
+			want:   "Import of ami-1 into pvc default/disk failed: no credentials",
+		},
+		{
+			name:   "cancelled",
+			result: &importer.Result{Status: importer.ResultCancelled, SourceAmiId: "ami-1", PvcName: "disk", PvcNamespace: "default"},
+			want:   "Import of ami-1 into pvc default/disk was cancelled",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := Summary(tt.result); got != tt.want {
+			t.Errorf("%s: Summary() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// slackMessage and teamsCard are the parts of the payloads the tests check.
+type slackMessage struct {
+	Text        string `json:"text"`
+	Attachments []struct {
+		Color  string `json:"color"`
+		Fields []struct {
+			Title string `json:"title"`
+			Value string `json:"value"`
+		} `json:"fields"`
+	} `json:"attachments"`
+}
+
+type teamsCard struct {
+	Type       string `json:"@type"`
+	Summary    string `json:"summary"`
+	ThemeColor string `json:"themeColor"`
+	Sections   []struct {
+		Facts []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"facts"`
+	} `json:"sections"`
+}
+
+func TestSlackPayload(t *testing.T) {
+	tests := []struct {
+		result     *importer.Result
+		wantColor  string
+		wantFields map[string]string
+	}{
+		{
+			result:     succeededResult,
+			wantColor:  "good",
+			wantFields: map[string]string{"Status": "Succeeded", "Pvc": "default/disk", "AMI": "ami-1", "Copied AMI": "ami-2", "Export task": "export-ami-2", "Trace": succeededResult.TraceId},
+		},
+		{
+			result:     failedResult,
+			wantColor:  "danger",
+			wantFields: map[string]string{"Status": "Failed", "Pvc": "default/disk", "Snapshot": "snap-1", "Error code": "InvalidParameter"},
+		},
+	}
+
+	notifier, err := New(Options{Url: "https://hooks.slack.com/services/T0/B0/X", Format: FormatSlack})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		payload, err := notifier.Payload(tt.result)
+		if err != nil {
+			t.Fatalf("Payload() returned error: %v", err)
+		}
+		message := slackMessage{}
+		if err := json.Unmarshal(payload, &message); err != nil {
+			t.Fatalf("Payload() = %s, not a slack message: %v", payload, err)
+		}
+
+		if message.Text != Summary(tt.result) {
+			t.Errorf("text = %q, want %q", message.Text, Summary(tt.result))
+		}
+		if len(message.Attachments) != 1 || message.Attachments[0].Color != tt.wantColor {
+			t.Fatalf("attachments = %+v, want one colored %s", message.Attachments, tt.wantColor)
+		}
+		fields := map[string]string{}
+		for _, field := range message.Attachments[0].Fields {
+			fields[field.Title] = field.Value
+		}
+		if !equalFields(fields, tt.wantFields) {
+			t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+		}
+	}
+}
+
+func TestTeamsPayload(t *testing.T) {
+	tests := []struct {
+		result    *importer.Result
+		wantColor string
+		wantFacts map[string]string
+	}{
+		{
+			result:    succeededResult,
+			wantColor: "2EB886",
+			wantFacts: map[string]string{"Status": "Succeeded", "Pvc": "default/disk", "AMI": "ami-1", "Copied AMI": "ami-2", "Export task": "export-ami-2", "Trace": succeededResult.TraceId},
+		},
+		{
+			result:    failedResult,
+			wantColor: "D00000",
+			wantFacts: map[string]string{"Status": "Failed", "Pvc": "default/disk", "Snapshot": "snap-1", "Error code": "InvalidParameter"},
+		},
+	}
+
+	notifier, err := New(Options{Url: "https://example.webhook.office.com/webhookb2/x", Format: FormatTeams})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		payload, err := notifier.Payload(tt.result)
+		if err != nil {
+			t.Fatalf("Payload() returned error: %v", err)
+		}
+		card := teamsCard{}
+		if err := json.Unmarshal(payload, &card); err != nil {
+			t.Fatalf("Payload() = %s, not a message card: %v", payload, err)
+		}
+
+		if card.Type != "MessageCard" || card.Summary != Summary(tt.result) || card.ThemeColor != tt.wantColor {
+			t.Errorf("card = %+v, want a %s MessageCard summarizing the import", card, tt.wantColor)
+		}
+		if len(card.Sections) != 1 {
+			t.Fatalf("sections = %+v, want one", card.Sections)
+		}
+		facts := map[string]string{}
+		for _, fact := range card.Sections[0].Facts {
+			facts[fact.Name] = fact.Value
+		}
+		if !equalFields(facts, tt.wantFacts) {
+			t.Errorf("facts = %v, want %v", facts, tt.wantFacts)
+		}
+	}
+}
+
+func TestTemplatePayload(t *testing.T) {
+	notifier, err := New(Options{Url: "https://hooks.example.com", Template: `{"message": {{ summary . | json }}, "ok": {{ succeeded . }}}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := notifier.Payload(failedResult)
+	if err != nil {
+		t.Fatalf("Payload() returned error: %v", err)
+	}
+	message := struct {
+		Message string `json:"message"`
+		Ok      bool   `json:"ok"`
+	}{}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		t.Fatalf("Payload() = %s, not json: %v", payload, err)
+	}
+	if message.Message != Summary(failedResult) || message.Ok {
+		t.Errorf("Payload() = %s, want the summary of a failure", payload)
+	}
+
+	notifier, err = New(Options{Url: "https://hooks.example.com", Template: `{{ summary . }}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload, err := notifier.Payload(failedResult); err == nil {
+		t.Errorf("Payload() = %s, want an error for a template not rendering json", payload)
+	}
+
+	if _, err := New(Options{Url: "https://hooks.example.com", Template: `{{ summary . `}); err == nil {
+		t.Error("New() succeeded with an invalid template")
+	}
+}
+
+func equalFields(got map[string]string, want map[string]string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for key, value := range want {
+		if got[key] != value {
+			return false
+		}
+	}
+	return true
+}
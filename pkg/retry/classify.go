@@ -0,0 +1,121 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/aws/smithy-go"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Class is the kind of failure an error represents.
+type Class int
+
+const (
+	// Permanent errors fail the same way when retried.
+	Permanent Class = iota
+	// Throttling errors are rate limits of an API.
+	Throttling
+	// ServerError errors are internal and availability errors of a service.
+	ServerError
+	// Network errors are failures to reach a service.
+	Network
+)
+
+func (c Class) String() string {
+	switch c {
+	case Throttling:
+		return "throttling"
+	case ServerError:
+		return "server error"
+	case Network:
+		return "network error"
+	}
+	return "permanent"
+}
+
+var throttlingCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"RequestThrottled":                       true,
+	"RequestThrottledException":              true,
+	"RequestLimitExceeded":                   true,
+	"TooManyRequestsException":               true,
+	"ProvisionedThroughputExceededException": true,
+	"BandwidthLimitExceeded":                 true,
+	"EC2ThrottledException":                  true,
+	"PriorRequestNotComplete":                true,
+	"SlowDown":                               true,
+}
+
+var serverErrorCodes = map[string]bool{
+	"InternalError":               true,
+	"InternalFailure":             true,
+	"InternalServerError":         true,
+	"InternalServiceException":    true,
+	"ServiceUnavailable":          true,
+	"ServiceUnavailableException": true,
+	"Unavailable":                 true,
+	"RequestTimeout":              true,
+	"RequestTimeoutException":     true,
+}
+
+// httpStatusError is implemented by the response errors of the AWS SDK.
+type httpStatusError interface {
+	HTTPStatusCode() int
+}
+
+// Classify returns the class of err. Errors of AWS, Kubernetes and the
+// network are recognized, anything else is Permanent.
+func Classify(err error) Class {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return Permanent
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if throttlingCodes[apiErr.ErrorCode()] {
+			return Throttling
+		} else if serverErrorCodes[apiErr.ErrorCode()] {
+			return ServerError
+		}
+	}
+
+	var statusErr httpStatusError
+	if errors.As(err, &statusErr) {
+		switch code := statusErr.HTTPStatusCode(); {
+		case code == 429:
+			return Throttling
+		case code >= 500:
+			return ServerError
+		}
+	}
+
+	if apiErr != nil && apiErr.ErrorFault() == smithy.FaultServer {
+		return ServerError
+	}
+
+	switch {
+	case k8serrors.IsTooManyRequests(err):
+		return Throttling
+	case k8serrors.IsServerTimeout(err), k8serrors.IsTimeout(err), k8serrors.IsInternalError(err),
+		k8serrors.IsServiceUnavailable(err), k8serrors.IsUnexpectedServerError(err):
+		return ServerError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return Network
+	}
+
+	return Permanent
+}
+
+// Retryable reports whether retrying the call that failed with err may
+// succeed.
+func Retryable(err error) bool {
+	return Classify(err) != Permanent
+}
@@ -0,0 +1,64 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// statusError is an error carrying the status code of its response, like
+// those of the AWS SDK.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d", e.code)
+}
+
+func (e *statusError) HTTPStatusCode() int {
+	return e.code
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{name: "nil", err: nil, want: Permanent},
+		{name: "plain", err: errors.New("invalid ami"), want: Permanent},
+		{name: "cancelled", err: fmt.Errorf("call: %w", context.Canceled), want: Permanent},
+		{name: "throttling code", err: &smithy.GenericAPIError{Code: "RequestLimitExceeded"}, want: Throttling},
+		{name: "wrapped throttling code", err: fmt.Errorf("describe images: %w", &smithy.GenericAPIError{Code: "SlowDown"}), want: Throttling},
+		{name: "server error code", err: &smithy.GenericAPIError{Code: "InternalError"}, want: ServerError},
+		{name: "server fault", err: &smithy.GenericAPIError{Code: "Unknown", Fault: smithy.FaultServer}, want: ServerError},
+		{name: "client fault", err: &smithy.GenericAPIError{Code: "InvalidAMIID.NotFound", Fault: smithy.FaultClient}, want: Permanent},
+		{name: "status 429", err: &statusError{code: 429}, want: Throttling},
+		{name: "status 503", err: &statusError{code: 503}, want: ServerError},
+		{name: "status 403", err: &statusError{code: 403}, want: Permanent},
+		{name: "kubernetes too many requests", err: k8serrors.NewTooManyRequests("slow down", 1), want: Throttling},
+		{name: "kubernetes internal error", err: k8serrors.NewInternalError(errors.New("etcd")), want: ServerError},
+		{name: "kubernetes unavailable", err: k8serrors.NewServiceUnavailable("restarting"), want: ServerError},
+		{name: "kubernetes timeout", err: k8serrors.NewTimeoutError("slow", 1), want: ServerError},
+		{name: "kubernetes not found", err: k8serrors.NewNotFound(schema.GroupResource{Resource: "persistentvolumeclaims"}, "disk"), want: Permanent},
+		{name: "network", err: fmt.Errorf("get: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), want: Network},
+		{name: "unexpected eof", err: fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), want: Network},
+	}
+
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("%s: Classify(%v) = %s, want %s", tt.name, tt.err, got, tt.want)
+		}
+		if got, want := Retryable(tt.err), tt.want != Permanent; got != want {
+			t.Errorf("%s: Retryable(%v) = %v, want %v", tt.name, tt.err, got, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package retry
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+)
+
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = 2 * time.Second
+	DefaultMaxBackoff     = 2 * time.Minute
+	DefaultMultiplier     = 2.0
+	DefaultJitter         = 0.2
+)
+
+// ErrStopped is returned by Do when it is stopped while waiting to retry.
+var ErrStopped = errors.New("stopped while waiting to retry")
+
+// ErrTimeout is wrapped by the errors of waits that run out of time. It is
+// not retried, the wait's timeout already covers transient failures.
+var ErrTimeout = errors.New("timed out")
+
+var (
+	randMu sync.Mutex
+	random = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Policy retries calls failing with retryable errors with exponential
+// backoff.
+type Policy struct {
+	// MaxAttempts is the number of calls made before giving up, including
+	// the first.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries.
+	MaxBackoff time.Duration
+	// Multiplier grows the wait after each retry.
+	Multiplier float64
+	// Jitter randomizes each wait by up to this fraction of it, so that
+	// concurrent clients do not retry in lockstep.
+	Jitter float64
+	// Log is the logger retries are logged to. Defaults to
+	// logging.Default().
+	Log logr.Logger
+}
+
+// DefaultPolicy is the policy used when none is configured.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		Multiplier:     DefaultMultiplier,
+		Jitter:         DefaultJitter,
+	}
+}
+
+// Backoff returns the wait before retry number retry, counting from 1.
+func (p Policy) Backoff(retry int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		randMu.Lock()
+		backoff += backoff * p.Jitter * (2*random.Float64() - 1)
+		randMu.Unlock()
+	}
+	return time.Duration(backoff)
+}
+
+func (p Policy) logger() logr.Logger {
+	if p.Log == nil {
+		return logging.Default()
+	}
+	return p.Log
+}
+
+// Do calls fn until it succeeds, fails with an error that is not
+// retryable, or MaxAttempts calls failed. Closing stop abandons the wait
+// for the next retry.
+func (p Policy) Do(name string, stop <-chan struct{}, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		class := Classify(err)
+		if class == Permanent || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		backoff := p.Backoff(attempt)
+		p.logger().Error(err, "Retrying "+name, "class", class, "backoff", backoff.Round(time.Millisecond), "attempt", attempt+1, "maxAttempts", p.MaxAttempts)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-stop:
+			timer.Stop()
+			return ErrStopped
+		case <-timer.C:
+		}
+	}
+}
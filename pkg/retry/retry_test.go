@@ -0,0 +1,89 @@
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Multiplier: 2}
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{retry: 1, want: time.Second},
+		{retry: 2, want: 2 * time.Second},
+		{retry: 3, want: 4 * time.Second},
+		{retry: 4, want: 8 * time.Second},
+		{retry: 5, want: 10 * time.Second},
+		{retry: 20, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Backoff(tt.retry); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.retry, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := Policy{InitialBackoff: time.Second, Multiplier: 2, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		got := policy.Backoff(2)
+		if got < 1600*time.Millisecond || got > 2400*time.Millisecond {
+			t.Fatalf("Backoff(2) = %s, want within 20%% of 2s", got)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	throttled := &smithy.GenericAPIError{Code: "Throttling"}
+	permanent := errors.New("invalid ami")
+	tests := []struct {
+		name      string
+		errs      []error
+		want      error
+		wantCalls int
+	}{
+		{name: "succeeds", errs: []error{nil}, wantCalls: 1},
+		{name: "retried until success", errs: []error{throttled, throttled, nil}, wantCalls: 3},
+		{name: "permanent not retried", errs: []error{permanent}, want: permanent, wantCalls: 1},
+		{name: "gives up after max attempts", errs: []error{throttled, throttled, throttled, nil}, want: throttled, wantCalls: 3},
+	}
+
+	policy := Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 1}
+	for _, tt := range tests {
+		calls := 0
+		err := policy.Do("call", nil, func() error {
+			calls++
+			return tt.errs[calls-1]
+		})
+		if err != tt.want {
+			t.Errorf("%s: Do() = %v, want %v", tt.name, err, tt.want)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("%s: %d calls, want %d", tt.name, calls, tt.wantCalls)
+		}
+	}
+}
+
+func TestDoStopped(t *testing.T) {
+	stop := make(chan struct{})
+	close(stop)
+
+	policy := Policy{MaxAttempts: 3, InitialBackoff: time.Hour, Multiplier: 1}
+	calls := 0
+	err := policy.Do("call", stop, func() error {
+		calls++
+		return &smithy.GenericAPIError{Code: "Throttling"}
+	})
+	if err != ErrStopped {
+		t.Errorf("Do() = %v, want %v", err, ErrStopped)
+	}
+	if calls != 1 {
+		t.Errorf("%d calls, want 1", calls)
+	}
+}
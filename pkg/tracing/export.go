@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// otlpTracesPath is appended to an OTLP/HTTP endpoint not ending with it.
+	otlpTracesPath = "/v1/traces"
+	exportTimeout  = 30 * time.Second
+)
+
+// NewOTLPExporter exports spans to an OTLP/HTTP endpoint, such as
+// http://otel-collector:4318. headers are added to every request.
+func NewOTLPExporter(endpoint string, headers map[string]string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("endpoint %s has no host", endpoint)
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(path, otlpTracesPath) {
+		path += otlpTracesPath
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(path),
+		otlptracehttp.WithHeaders(headers),
+		otlptracehttp.WithTimeout(exportTimeout),
+	}
+	switch u.Scheme {
+	case "http":
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("endpoint %s must be an http or https url", endpoint)
+	}
+	return otlptracehttp.New(context.Background(), opts...)
+}
+
+// fileExporter closes the file the stdout exporter writes to once it is
+// shut down.
+type fileExporter struct {
+	*stdouttrace.Exporter
+	file *os.File
+}
+
+// NewFileExporter appends spans to path as JSON, one span per line.
+func NewFileExporter(path string) (sdktrace.SpanExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileExporter{Exporter: exporter, file: file}, nil
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	if err := e.Exporter.Shutdown(ctx); err != nil {
+		return err
+	}
+	return e.file.Close()
+}
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		wantPath string
+	}{
+		{endpoint: "", wantPath: "/v1/traces"},
+		{endpoint: "/", wantPath: "/v1/traces"},
+		{endpoint: "/otlp", wantPath: "/otlp/v1/traces"},
+		{endpoint: "/v1/traces", wantPath: "/v1/traces"},
+	}
+
+	for _, tt := range tests {
+		var path, authorization, contentType string
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			path, authorization, contentType = req.URL.Path, req.Header.Get("Authorization"), req.Header.Get("Content-Type")
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		exporter, err := NewOTLPExporter(collector.URL+tt.endpoint, map[string]string{"Authorization": "Bearer token"})
+		if err != nil {
+			t.Fatalf("NewOTLPExporter(%q) returned error: %v", tt.endpoint, err)
+		}
+		tracer := NewTracer(exporter)
+		tracer.Start(nil, "import", SpanKindInternal).End(nil)
+		tracer.Shutdown()
+		collector.Close()
+
+		if path != tt.wantPath {
+			t.Errorf("%q: spans posted to %q, want %q", tt.endpoint, path, tt.wantPath)
+		}
+		if authorization != "Bearer token" {
+			t.Errorf("%q: Authorization = %q, want the header given", tt.endpoint, authorization)
+		}
+		if contentType != "application/x-protobuf" {
+			t.Errorf("%q: Content-Type = %q, want OTLP protobuf", tt.endpoint, contentType)
+		}
+	}
+}
+
+func TestOTLPExporterInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"otel-collector:4318", "grpc://otel-collector:4317", "http://"} {
+		if _, err := NewOTLPExporter(endpoint, nil); err == nil {
+			t.Errorf("NewOTLPExporter(%q) succeeded, want an error", endpoint)
+		}
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.json")
+
+	// every tracer appends its spans to the file
+	for _, name := range []string{"first", "second"} {
+		exporter, err := NewFileExporter(path)
+		if err != nil {
+			t.Fatalf("NewFileExporter() returned error: %v", err)
+		}
+		tracer := NewTracer(exporter)
+		tracer.Start(nil, name, SpanKindInternal).End(nil)
+		tracer.Shutdown()
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		span := struct{ Name string }{}
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("line %q is not a json span: %v", scanner.Text(), err)
+		}
+		names = append(names, span.Name)
+	}
+	if len(names) != 2 || names[0] != "first" || names[1] != "second" {
+		t.Errorf("spans in file = %v, want [first second]", names)
+	}
+}
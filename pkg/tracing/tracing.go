@@ -0,0 +1,204 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"kubevirt.io/kubevirt-cloud-import/pkg/logging"
+)
+
+// ServiceName is the service spans are recorded for.
+const ServiceName = "import-ami"
+
+// The kinds of span recorded.
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindClient   = trace.SpanKindClient
+)
+
+const (
+	instrumentationName = "kubevirt.io/kubevirt-cloud-import"
+	shutdownTimeout     = 30 * time.Second
+)
+
+func init() {
+	// tracing never fails an import, export errors are only logged
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logging.Default().Error(err, "Error encountered exporting spans")
+	}))
+}
+
+// Tracer records spans and hands them to an exporter in batches.
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// NewTracer returns a tracer exporting spans with exporter every few
+// seconds, and whenever enough have ended. Shutdown flushes the spans left.
+func NewTracer(exporter sdktrace.SpanExporter) *Tracer {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName))),
+	)
+	return &Tracer{provider: provider, tracer: provider.Tracer(instrumentationName)}
+}
+
+// Shutdown exports the spans left and shuts the exporter down. Shutting down
+// a nil tracer does nothing.
+func (t *Tracer) Shutdown() {
+	if t == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := t.provider.Shutdown(ctx); err != nil {
+		logging.Default().Error(err, "Error encountered shutting down tracer")
+	}
+}
+
+// Span is a span being recorded. A nil *Span records nothing, so that code
+// runs the same with tracing disabled.
+type Span struct {
+	span trace.Span
+}
+
+// Start starts a span named name, a child of parent or the root of a new
+// trace when parent is nil.
+func (t *Tracer) Start(parent *Span, name string, kind trace.SpanKind) *Span {
+	if t == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	if parent != nil {
+		ctx = trace.ContextWithSpan(ctx, parent.span)
+	}
+	_, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+	return &Span{span: span}
+}
+
+// SetAttribute sets key to value, a string, bool, int, int64 or float64.
+// Empty strings are not recorded.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			s.span.SetAttributes(attribute.String(key, v))
+		}
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case float64:
+		s.span.SetAttributes(attribute.Float64(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(value)))
+	}
+}
+
+// End ends the span, with an error status when err is not nil.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// TraceId returns the id of the trace the span belongs to, in hex.
+func (s *Span) TraceId() string {
+	if s == nil {
+		return ""
+	}
+	return s.span.SpanContext().TraceID().String()
+}
+
+// Scope is the span the calls of a single import are recorded under. It
+// follows the import from step to step, so that clients shared by the steps
+// parent their calls to the step running.
+type Scope struct {
+	tracer *Tracer
+
+	mu      sync.Mutex
+	current *Span
+}
+
+// NewScope returns a scope recording spans with t. A nil tracer returns a
+// nil scope, which records nothing.
+func (t *Tracer) NewScope() *Scope {
+	if t == nil {
+		return nil
+	}
+	return &Scope{tracer: t}
+}
+
+// Tracer returns the tracer of the scope.
+func (s *Scope) Tracer() *Tracer {
+	if s == nil {
+		return nil
+	}
+	return s.tracer
+}
+
+// Current returns the span calls are recorded under.
+func (s *Scope) Current() *Span {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// SetCurrent makes span the parent of the calls recorded from now on.
+func (s *Scope) SetCurrent(span *Span) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = span
+}
+
+// StartChild starts a span under the current span of the scope.
+func (s *Scope) StartChild(name string, kind trace.SpanKind) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.Start(s.Current(), name, kind)
+}
+
+type scopeKey struct{}
+
+// WithScope returns a context carrying scope, through which the calls made
+// with it are recorded.
+func WithScope(ctx context.Context, scope *Scope) context.Context {
+	if scope == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFromContext returns the scope carried by ctx, or nil.
+func ScopeFromContext(ctx context.Context) *Scope {
+	scope, _ := ctx.Value(scopeKey{}).(*Scope)
+	return scope
+}
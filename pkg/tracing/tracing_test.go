@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingExporter keeps the spans exported past the shutdown of the
+// tracer, which flushes them.
+type recordingExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+func (e recordingExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestScope(t *testing.T) {
+	exporter := recordingExporter{tracetest.NewInMemoryExporter()}
+	tracer := NewTracer(exporter)
+	scope := tracer.NewScope()
+
+	root := tracer.Start(nil, "import", SpanKindInternal)
+	root.SetAttribute("import.ami_id", "ami-1")
+	root.SetAttribute("import.snapshot_id", "")
+	scope.SetCurrent(root)
+
+	step := scope.StartChild("export", SpanKindInternal)
+	scope.SetCurrent(step)
+	call := ScopeFromContext(WithScope(context.Background(), scope)).StartChild("EC2.ExportImage", SpanKindClient)
+	call.SetAttribute("http.status_code", 400)
+	call.End(errors.New("InvalidParameter"))
+	step.End(nil)
+	scope.SetCurrent(root)
+	root.End(nil)
+	tracer.Shutdown()
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	if len(spans) != 3 {
+		t.Fatalf("exported spans %v, want import, export and EC2.ExportImage", spans)
+	}
+
+	importSpan, exportSpan, callSpan := spans["import"], spans["export"], spans["EC2.ExportImage"]
+	if importSpan.Parent.IsValid() {
+		t.Errorf("import span has parent %s, want none", importSpan.Parent.SpanID())
+	}
+	if exportSpan.Parent.SpanID() != importSpan.SpanContext.SpanID() {
+		t.Errorf("export span is not a child of the import span")
+	}
+	if callSpan.Parent.SpanID() != exportSpan.SpanContext.SpanID() {
+		t.Errorf("call span is not a child of the export span")
+	}
+	if callSpan.SpanContext.TraceID() != importSpan.SpanContext.TraceID() {
+		t.Errorf("call span is not in the trace of the import")
+	}
+	if root.TraceId() != importSpan.SpanContext.TraceID().String() {
+		t.Errorf("TraceId() = %s, want %s", root.TraceId(), importSpan.SpanContext.TraceID())
+	}
+
+	if callSpan.SpanKind != trace.SpanKindClient {
+		t.Errorf("call span kind = %s, want %s", callSpan.SpanKind, trace.SpanKindClient)
+	}
+	if callSpan.Status.Code != codes.Error || callSpan.Status.Description != "InvalidParameter" {
+		t.Errorf("call span status = %+v, want the error", callSpan.Status)
+	}
+	if exportSpan.Status.Code != codes.Unset {
+		t.Errorf("export span status = %+v, want unset", exportSpan.Status)
+	}
+
+	wantAttributes := []attribute.KeyValue{attribute.String("import.ami_id", "ami-1")}
+	if len(importSpan.Attributes) != 1 || importSpan.Attributes[0] != wantAttributes[0] {
+		t.Errorf("import span attributes = %v, want %v", importSpan.Attributes, wantAttributes)
+	}
+	if len(callSpan.Attributes) != 1 || callSpan.Attributes[0] != attribute.Int("http.status_code", 400) {
+		t.Errorf("call span attributes = %v, want the status code", callSpan.Attributes)
+	}
+
+	service, ok := importSpan.Resource.Set().Value("service.name")
+	if !ok || service.AsString() != ServiceName {
+		t.Errorf("service.name = %v, want %s", service.AsString(), ServiceName)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	scope := tracer.NewScope()
+	span := scope.StartChild("import", SpanKindInternal)
+	span.SetAttribute("import.ami_id", "ami-1")
+	span.End(nil)
+	tracer.Shutdown()
+
+	if scope != nil || span != nil || span.TraceId() != "" {
+		t.Errorf("nil tracer recorded span %v in scope %v", span, scope)
+	}
+}